@@ -0,0 +1,79 @@
+package locker
+
+import "time"
+
+// A Backend defines a storage of the distributed lock state.
+// It is used by the Distributed lock and can be implemented
+// to keep the state in any other place.
+type Backend interface {
+	// Acquire tries to take the lock by the key for the token
+	// and returns true if it succeeded with its fencing token.
+	// The lock must expire after the ttl if it is not refreshed.
+	// The fencing token must increase with each new owner of the lock.
+	Acquire(key, token string, ttl time.Duration) (uint64, bool, error)
+	// Release releases the lock by the key. It returns InvalidIntent
+	// if the lock is not held by the token.
+	Release(key, token string) error
+	// Refresh extends the lock by the key for the ttl. It returns
+	// InvalidIntent if the lock is not held by the token.
+	Refresh(key, token string, ttl time.Duration) error
+	// Inspect returns the current state of the lock by the key.
+	Inspect(key string) (Lease, error)
+}
+
+// A Waiter is a Backend that can notify about a possible chance
+// to take the lock instead of periodic attempts.
+type Waiter interface {
+	// Wait blocks until the lock by the key is probably available
+	// for the token or the Breaker is done. The Backend can return
+	// earlier without an error, the caller will try again.
+	Wait(breaker Breaker, key, token string) error
+}
+
+// A Lister is a Backend that can enumerate its locks,
+// e.g. to find stuck ones.
+type Lister interface {
+	// List returns the keys of the locks with the prefix
+	// in no particular order. A lock can be released at any moment,
+	// so its state should be checked by the Inspect method.
+	List(prefix string) ([]string, error)
+}
+
+// A Validator is a Backend that knows for how long the lock is valid
+// better than its ttl, e.g. the Redlock accounts the time spent
+// on the majority of servers and the clock drift between them.
+// The Distributed lock considers the lock lost after the validity.
+type Validator interface {
+	// AcquireValidity works like Acquire, but returns the time remaining
+	// before the lock expires instead of the flag. The validity is not
+	// positive if the lock is not taken.
+	AcquireValidity(key, token string, ttl time.Duration) (uint64, time.Duration, error)
+	// RefreshValidity works like Refresh and returns the time remaining
+	// before the lock expires.
+	RefreshValidity(key, token string, ttl time.Duration) (time.Duration, error)
+}
+
+// Lease describes the state of the distributed lock.
+type Lease struct {
+	// Key is the name of the lock.
+	Key string
+	// Token is the token of the lock owner.
+	// It is empty if the lock is free.
+	Token string
+	// TTL is the time remaining before the lock expires.
+	TTL time.Duration
+	// Fence is the fencing token of the lock owner.
+	Fence uint64
+}
+
+// Held returns true if the lock is held by someone.
+func (lease Lease) Held() bool {
+	return lease.Token != ""
+}
+
+// Owner returns the id of the lock owner encoded into its token
+// by the Distributed lock, see DistributedWithOwner, or an empty string
+// if the token doesn't contain it.
+func (lease Lease) Owner() string {
+	return ownerOf(lease.Token)
+}
@@ -0,0 +1,164 @@
+package locker_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+	"github.com/kamilsk/locker/internal/etcd"
+	"github.com/kamilsk/locker/internal/memcache"
+	"github.com/kamilsk/locker/internal/redis"
+)
+
+func TestBackend(t *testing.T) {
+	redisServer, err := redis.NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer redisServer.Close()
+
+	memcacheServer, err := memcache.NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer memcacheServer.Close()
+
+	etcdServer := httptest.NewServer(etcd.NewServer())
+	defer etcdServer.Close()
+
+	nodes, _, stop := raftGroup(t, 3)
+	defer stop()
+
+	backends := map[string]Backend{
+		"etcd":     EtcdBackend(etcdServer.URL),
+		"memcache": MemcacheBackend(memcacheServer.Addr()),
+		"memory":   MemoryBackend(),
+		"raft":     RaftBackend(nodes[0]),
+		"redis":    RedisBackend(redisServer.Addr()),
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			testBackend(t, backend)
+		})
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	backend := MemoryBackend()
+
+	t.Run("expired lock", func(t *testing.T) {
+		if _, acquired, err := backend.Acquire(t.Name(), "first", time.Millisecond); err != nil || !acquired {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+		time.Sleep(2 * time.Millisecond)
+		if _, acquired, err := backend.Acquire(t.Name(), "second", time.Minute); err != nil || !acquired {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+		if err := backend.Refresh(t.Name(), "first", time.Minute); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+
+	t.Run("wait for release", func(t *testing.T) {
+		first := Distributed(time.Minute, DistributedWithKey(t.Name()), DistributedWithBackend(backend))
+		second := Distributed(time.Minute, DistributedWithKey(t.Name()), DistributedWithBackend(backend))
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 5*time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			_ = first.Unlock(ctx)
+		}()
+		if err := second.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+}
+
+func testBackend(t *testing.T, backend Backend) {
+	key := t.Name()
+
+	if lease, err := backend.Inspect(key); err != nil || lease.Held() {
+		t.Error("the lock must be free")
+		t.FailNow()
+	}
+	fence, acquired, err := backend.Acquire(key, "first", time.Minute)
+	if err != nil || !acquired || fence == 0 {
+		t.Error("the lock must be acquired")
+		t.FailNow()
+	}
+	if _, acquired, err := backend.Acquire(key, "second", time.Minute); err != nil || acquired {
+		t.Error("the lock must be busy")
+		t.FailNow()
+	}
+	if lease, err := backend.Inspect(key); err != nil || lease.Token != "first" || lease.TTL <= 0 || lease.Fence != fence {
+		t.Errorf("unexpected lease %+v", lease)
+		t.FailNow()
+	}
+	if lister, is := backend.(Lister); is {
+		keys, err := lister.List(key)
+		if err != nil || len(keys) != 1 || keys[0] != key {
+			t.Errorf("unexpected keys %v", keys)
+			t.FailNow()
+		}
+		if keys, err := lister.List(key + "/unknown"); err != nil || len(keys) != 0 {
+			t.Errorf("unexpected keys %v", keys)
+			t.FailNow()
+		}
+	}
+	if err := backend.Refresh(key, "first", time.Minute); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := backend.Refresh(key, "unknown", time.Minute); err != InvalidIntent {
+		t.Error("unexpected error value")
+		t.FailNow()
+	}
+	if err := backend.Release(key, "unknown"); err != InvalidIntent {
+		t.Error("unexpected error value")
+		t.FailNow()
+	}
+	if err := backend.Release(key, "first"); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := backend.Release(key, "second"); err != nil && err != InvalidIntent {
+		t.Error("unexpected error value")
+		t.FailNow()
+	}
+	if lease, err := backend.Inspect(key); err != nil || lease.Held() {
+		t.Error("the lock must be free")
+		t.FailNow()
+	}
+
+	next, acquired, err := backend.Acquire(key, "third", time.Minute)
+	if err != nil || !acquired || next <= fence {
+		t.Error("the fencing token must increase")
+		t.FailNow()
+	}
+	if err := backend.Release(key, "third"); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,279 @@
+// Package breaker provides implementations of the Breaker
+// to interrupt waiting for locks by a timeout, a deadline,
+// an OS signal, a closed channel or a context.Context,
+// and combinators of them.
+//
+//  br := breaker.Multiplex(
+//  	breaker.BreakByTimeout(time.Minute),
+//  	breaker.BreakBySignal(os.Interrupt, syscall.SIGTERM),
+//  )
+//  defer br.Close()
+//
+//  if err := lock.Lock(br); err != nil {
+//  	log.Printf("the lock is not taken: %v", br.Err())
+//  	return
+//  }
+//  defer lock.MustUnlock()
+//
+// Each breaker must be closed to release its resources, e.g. timers,
+// goroutines or signal subscriptions.
+package breaker
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/kamilsk/locker"
+)
+
+// Error defines the package errors.
+type Error string
+
+// Error returns the string representation of the error.
+func (err Error) Error() string {
+	return string(err)
+}
+
+// Closed is the reason of the breaker closed by the Close method.
+const Closed Error = "breaker closed"
+
+// Expired is the reason of the breaker fired by a timeout or a deadline.
+const Expired Error = "breaker expired"
+
+// Released is the reason of the breaker fired by a closed channel.
+const Released Error = "channel closed"
+
+// Vacuous is the reason of the breaker waiting for all of no breakers.
+const Vacuous Error = "no breakers to wait for"
+
+// A SignalError is the reason of the breaker fired by an OS signal.
+type SignalError struct {
+	Signal os.Signal
+}
+
+// Error returns the string representation of the error.
+func (err SignalError) Error() string {
+	return "signal received: " + err.Signal.String()
+}
+
+// A Breaker carries a cancellation signal to break an action execution
+// and reports the reason of the cancellation by the Err method.
+// It implements the BreakCloser.
+type Breaker struct {
+	signal   chan struct{}
+	deadline time.Time
+
+	once    sync.Once
+	mu      sync.Mutex
+	err     error
+	release func()
+}
+
+// BreakByTimeout returns a new Breaker which is done after the timeout.
+func BreakByTimeout(timeout time.Duration) *Breaker {
+	return BreakByDeadline(time.Now().Add(timeout))
+}
+
+// BreakByDeadline returns a new Breaker which is done at the deadline.
+func BreakByDeadline(deadline time.Time) *Breaker {
+	breaker := newBreaker(deadline)
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	timer := time.AfterFunc(time.Until(deadline), func() { breaker.fire(Expired) })
+	breaker.release = func() { timer.Stop() }
+	return breaker
+}
+
+// BreakBySignal returns a new Breaker which is done when the process
+// receives one of the OS signals. The signals are not delivered
+// to the process anymore since then.
+func BreakBySignal(signals ...os.Signal) *Breaker {
+	breaker, received := newBreaker(time.Time{}), make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	breaker.release = func() { signal.Stop(received) }
+	go func() {
+		select {
+		case sig := <-received:
+			breaker.fire(SignalError{Signal: sig})
+		case <-breaker.signal:
+		}
+	}()
+	return breaker
+}
+
+// BreakByChannel returns a new Breaker which is done
+// when the channel is closed.
+func BreakByChannel(channel <-chan struct{}) *Breaker {
+	breaker := newBreaker(time.Time{})
+	go func() {
+		select {
+		case <-channel:
+			breaker.fire(Released)
+		case <-breaker.signal:
+		}
+	}()
+	return breaker
+}
+
+// BreakByContext returns a new Breaker which is done with the context.
+// The cancel function is called on the Close, it could be nil.
+//
+//  br := breaker.BreakByContext(context.WithTimeout(req.Context(), time.Second))
+//  defer br.Close()
+//
+func BreakByContext(ctx context.Context, cancel context.CancelFunc) *Breaker {
+	deadline, _ := ctx.Deadline()
+	breaker := newBreaker(deadline)
+	if cancel != nil {
+		breaker.release = func() { cancel() }
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			breaker.fire(ctx.Err())
+		case <-breaker.signal:
+		}
+	}()
+	return breaker
+}
+
+// Multiplex returns a new Breaker which is done when any of the breakers
+// is done. It reports the reason of the breaker fired first.
+// It is done only by the Close if there are no breakers.
+// The breakers are closed on its Close if they are the BreakCloser.
+func Multiplex(breakers ...locker.Breaker) *Breaker {
+	breaker := combine(breakers)
+	for _, br := range breakers {
+		if deadline, is := deadlineOf(br); is && (breaker.deadline.IsZero() || deadline.Before(breaker.deadline)) {
+			breaker.deadline = deadline
+		}
+	}
+	go breaker.watch(breakers, 1)
+	return breaker
+}
+
+// All returns a new Breaker which is done when all of the breakers
+// are done. It reports the reason of the breaker fired last.
+// It is done immediately with the Vacuous reason if there are no breakers.
+// The breakers are closed on its Close if they are the BreakCloser.
+func All(breakers ...locker.Breaker) *Breaker {
+	breaker := combine(breakers)
+	if len(breakers) == 0 {
+		breaker.fire(Vacuous)
+		return breaker
+	}
+	for _, br := range breakers {
+		deadline, is := deadlineOf(br)
+		if !is {
+			breaker.deadline = time.Time{}
+			break
+		}
+		if deadline.After(breaker.deadline) {
+			breaker.deadline = deadline
+		}
+	}
+	go breaker.watch(breakers, len(breakers))
+	return breaker
+}
+
+// Done returns a channel that's closed when a cancellation signal occurred.
+func (breaker *Breaker) Done() <-chan struct{} {
+	return breaker.signal
+}
+
+// Deadline returns the time when the Breaker will be done by a timeout.
+// It is used by the locks ordering waiters by their deadlines.
+func (breaker *Breaker) Deadline() (time.Time, bool) {
+	return breaker.deadline, !breaker.deadline.IsZero()
+}
+
+// Err returns the reason of the cancellation
+// or nil if the Breaker is not done yet.
+func (breaker *Breaker) Err() error {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.err
+}
+
+// Close closes the Done channel and releases resources associated with it.
+// The reason is Closed if the Breaker is not done yet.
+func (breaker *Breaker) Close() {
+	breaker.fire(Closed)
+}
+
+func newBreaker(deadline time.Time) *Breaker {
+	return &Breaker{signal: make(chan struct{}), deadline: deadline}
+}
+
+// fire closes the Done channel with the reason
+// and releases resources once.
+func (breaker *Breaker) fire(reason error) {
+	breaker.once.Do(func() {
+		breaker.mu.Lock()
+		breaker.err = reason
+		release := breaker.release
+		breaker.mu.Unlock()
+		close(breaker.signal)
+		if release != nil {
+			release()
+		}
+	})
+}
+
+// combine returns a new Breaker closing the breakers on the release.
+func combine(breakers []locker.Breaker) *Breaker {
+	breaker := newBreaker(time.Time{})
+	breaker.release = func() {
+		for _, br := range breakers {
+			if closer, is := br.(locker.BreakCloser); is {
+				closer.Close()
+			}
+		}
+	}
+	return breaker
+}
+
+// watch waits until the number of the breakers are done
+// and fires with the reason of the last one.
+func (breaker *Breaker) watch(breakers []locker.Breaker, number int) {
+	cases := make([]reflect.SelectCase, 0, len(breakers)+1)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(breaker.signal)})
+	for _, br := range breakers {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(br.Done())})
+	}
+	for {
+		chosen, _, _ := reflect.Select(cases)
+		if chosen == 0 {
+			return
+		}
+		if number--; number == 0 {
+			breaker.fire(reasonOf(breakers[chosen-1]))
+			return
+		}
+		// the closed channel is ready forever, so disable it
+		cases[chosen].Chan = reflect.Value{}
+	}
+}
+
+// reasonOf returns the reason of the cancellation of the Breaker
+// if it reports one or Closed otherwise.
+func reasonOf(breaker locker.Breaker) error {
+	if breaker, is := breaker.(interface{ Err() error }); is {
+		if err := breaker.Err(); err != nil {
+			return err
+		}
+	}
+	return Closed
+}
+
+// deadlineOf returns the deadline of the Breaker if it has one.
+func deadlineOf(breaker locker.Breaker) (time.Time, bool) {
+	if breaker, is := breaker.(interface{ Deadline() (time.Time, bool) }); is {
+		return breaker.Deadline()
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,159 @@
+package breaker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker/breaker"
+
+	"github.com/kamilsk/locker"
+)
+
+func TestBreaker(t *testing.T) {
+	t.Run("by timeout", func(t *testing.T) {
+		br := BreakByTimeout(10 * time.Millisecond)
+		defer br.Close()
+
+		if deadline, is := br.Deadline(); !is || deadline.IsZero() {
+			t.Error("the deadline is expected")
+			t.FailNow()
+		}
+		if br.Err() != nil {
+			t.Error("the breaker must not be done yet")
+			t.FailNow()
+		}
+		wait(t, br)
+		if br.Err() != Expired {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+	})
+
+	t.Run("by deadline in the past", func(t *testing.T) {
+		br := BreakByDeadline(time.Now().Add(-time.Second))
+		wait(t, br)
+		br.Close()
+		if br.Err() != Expired {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+	})
+
+	t.Run("by channel", func(t *testing.T) {
+		channel := make(chan struct{})
+		br := BreakByChannel(channel)
+		defer br.Close()
+
+		close(channel)
+		wait(t, br)
+		if br.Err() != Released {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+	})
+
+	t.Run("by context", func(t *testing.T) {
+		br := BreakByContext(context.WithCancel(context.Background()))
+		br.Close()
+		wait(t, br)
+		if br.Err() != Closed {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		br = BreakByContext(ctx, nil)
+		defer br.Close()
+		cancel()
+		wait(t, br)
+		if br.Err() != context.Canceled {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+	})
+
+	t.Run("multiplex", func(t *testing.T) {
+		timeout, channel := BreakByTimeout(time.Hour), make(chan struct{})
+		br := Multiplex(timeout, BreakByChannel(channel), context.Background())
+		defer br.Close()
+
+		if deadline, _ := br.Deadline(); !deadline.Equal(deadlineOf(timeout)) {
+			t.Error("the earliest deadline is expected")
+			t.FailNow()
+		}
+		close(channel)
+		wait(t, br)
+		if br.Err() != Released {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+		// the breakers are released with the multiplexed one
+		wait(t, timeout)
+	})
+
+	t.Run("all", func(t *testing.T) {
+		first, second := make(chan struct{}), BreakByContext(context.WithCancel(context.Background()))
+		br := All(BreakByChannel(first), second)
+		defer br.Close()
+
+		if _, is := br.Deadline(); is {
+			t.Error("unexpected deadline")
+			t.FailNow()
+		}
+		close(first)
+		select {
+		case <-br.Done():
+			t.Error("the breaker must wait for all of the breakers")
+			t.FailNow()
+		case <-time.After(10 * time.Millisecond):
+		}
+		second.Close()
+		wait(t, br)
+		if br.Err() != Closed {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+	})
+
+	t.Run("without breakers", func(t *testing.T) {
+		br := All()
+		wait(t, br)
+		if br.Err() != Vacuous {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+		if _, is := br.Deadline(); is {
+			t.Error("unexpected deadline")
+			t.FailNow()
+		}
+
+		br = Multiplex()
+		select {
+		case <-br.Done():
+			t.Error("the breaker must be done only by the close")
+			t.FailNow()
+		case <-time.After(10 * time.Millisecond):
+		}
+		br.Close()
+		wait(t, br)
+		if br.Err() != Closed {
+			t.Errorf("unexpected reason %v", br.Err())
+			t.FailNow()
+		}
+	})
+}
+
+func wait(t *testing.T, br locker.Breaker) {
+	select {
+	case <-br.Done():
+	case <-time.After(time.Second):
+		t.Error("the breaker must be done")
+		t.FailNow()
+	}
+}
+
+func deadlineOf(br *Breaker) time.Time {
+	deadline, _ := br.Deadline()
+	return deadline
+}
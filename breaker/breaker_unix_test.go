@@ -0,0 +1,27 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package breaker_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	. "github.com/kamilsk/locker/breaker"
+)
+
+func TestBreakBySignal(t *testing.T) {
+	br := BreakBySignal(syscall.SIGUSR1)
+	defer br.Close()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	wait(t, br)
+	if reason, is := br.Err().(SignalError); !is || reason.Signal != syscall.SIGUSR1 {
+		t.Errorf("unexpected reason %v", br.Err())
+		t.FailNow()
+	}
+}
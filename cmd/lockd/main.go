@@ -0,0 +1,61 @@
+// Command lockd runs a standalone lock server which hosts interruptible
+// mutexes, semaphores and keyed sets of mutexes behind an HTTP/JSON API.
+// Use the github.com/kamilsk/locker/lockd package to work with it.
+//
+//  $ lockd -addr :8080 -max-wait 30s -max-ttl 5m -max-capacity 1024
+//
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kamilsk/locker/lockd"
+)
+
+func main() {
+	var (
+		addr        = flag.String("addr", ":8080", "address to listen on")
+		maxWait     = flag.Duration("max-wait", 30*time.Second, "upper bound of a single long-poll request")
+		maxTTL      = flag.Duration("max-ttl", 5*time.Minute, "upper bound of a session ttl")
+		maxCapacity = flag.Uint("max-capacity", 1024, "upper bound of a set capacity")
+	)
+	flag.Parse()
+
+	server := &http.Server{
+		Addr: *addr,
+		Handler: lockd.NewServer(
+			lockd.ServerWithMaxWait(*maxWait),
+			lockd.ServerWithMaxTTL(*maxTTL),
+			lockd.ServerWithMaxCapacity(uint32(*maxCapacity)),
+		),
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		// active long-poll requests delay the shutdown up to the max wait,
+		// so their connections are closed after a short grace period
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			_ = server.Close()
+		}
+	}()
+
+	log.Printf("lockd is listening on %s", *addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-shutdown
+}
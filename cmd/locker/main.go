@@ -0,0 +1,179 @@
+// Command locker inspects and manages locks kept by a storage
+// of the Distributed lock or by the lockd server, e.g. to find
+// and force-release a stuck lock.
+//
+//  $ export LOCKER_BACKEND=redis://127.0.0.1:6379
+//  $ locker list jobs:
+//  $ locker inspect jobs:cleanup
+//  $ locker release jobs:cleanup
+//  $ locker extend -ttl 5m jobs:cleanup
+//  $ locker -backend http://127.0.0.1:8080 -json list | jq .
+//
+// The lock is released and extended by the token of its current holder,
+// so the command doesn't affect the next holder if the lock has been
+// taken by someone else in the meantime. Use the -token flag to act on
+// behalf of a particular holder. The etcd and lockd storages extend
+// the lock only by its own ttl, so they reject the -ttl flag.
+//
+// The run command serializes shell scripts and cron jobs like flock(1):
+// it takes the lock, runs the command while the lock is held, forwards
+// signals to it and exits with its exit code.
+//
+//  $ locker run -key backup -timeout 10m -- pg_dump -f backup.sql app
+//
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `Usage: locker [flags] <command> [arguments]
+
+Commands:
+  list [prefix]                          list held locks
+  inspect <key>                          show the holders of the lock
+  release [-token token] <key>           force-release the lock
+  extend [-token token] [-ttl ttl] <key> extend the lock
+  run -key name [flags] -- command       run the command holding the lock
+
+Flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns its exit code:
+// 0 on success, 1 on failure and 2 on a bad usage.
+// The run command returns the exit code of the executed one.
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("locker", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		_, _ = fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	var (
+		addr    = flags.String("backend", os.Getenv("LOCKER_BACKEND"), "url of the backend, $LOCKER_BACKEND by default")
+		table   = flags.String("table", "locks", "name of the table of the SQL backend")
+		timeout = flags.Duration("timeout", 5*time.Second, "timeout of requests to the backend")
+		asJSON  = flags.Bool("json", false, "print the result in JSON")
+	)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 && flags.Arg(0) == "run" {
+		signals := make(chan os.Signal, len(forwarded))
+		signal.Notify(signals, forwarded...)
+		defer signal.Stop(signals)
+		return runLocked(config{backend: *addr, table: *table, timeout: *timeout}, flags.Args()[1:], signals, stdout, stderr)
+	}
+	if flags.NArg() == 0 || *addr == "" {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := open(*addr, *table, *timeout)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "locker:", err)
+		return 2
+	}
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	var (
+		locks []lock
+		found = true
+	)
+	switch command {
+	case "list":
+		if len(args) > 1 {
+			flags.Usage()
+			return 2
+		}
+		var prefix string
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		locks, err = storage.List(prefix)
+	case "inspect":
+		if len(args) != 1 {
+			flags.Usage()
+			return 2
+		}
+		locks, err = storage.Inspect(args[0])
+		found = len(locks) > 0
+	case "release", "extend":
+		sub := flag.NewFlagSet(command, flag.ContinueOnError)
+		sub.SetOutput(stderr)
+		token := sub.String("token", "", "token of the holder, the current holder by default")
+		ttl := sub.Duration("ttl", 0, "new ttl of the lock (default 1m), not supported by etcd and lockd")
+		if err := sub.Parse(args); err != nil || sub.NArg() != 1 {
+			flags.Usage()
+			return 2
+		}
+		key := sub.Arg(0)
+		if locks, err = storage.Inspect(key); err != nil {
+			break
+		}
+		if command == "release" {
+			err = storage.Release(key, *token)
+		} else if err = storage.Extend(key, *token, *ttl); err == nil {
+			locks, err = storage.Inspect(key)
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "locker: %s: %v\n", command, err)
+		return 1
+	}
+
+	if *asJSON {
+		if locks == nil {
+			locks = []lock{}
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(locks); err != nil {
+			_, _ = fmt.Fprintln(stderr, "locker:", err)
+			return 1
+		}
+		return 0
+	}
+	if !found {
+		_, _ = fmt.Fprintf(stdout, "the lock %q is free\n", args[0])
+		return 0
+	}
+	printLocks(stdout, locks)
+	return 0
+}
+
+func printLocks(output io.Writer, locks []lock) {
+	w := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KEY\tOWNER\tTTL\tFENCE\tSINCE\tTOKEN")
+	for _, l := range locks {
+		fence, since := "-", "-"
+		if l.Fence > 0 {
+			fence = strconv.FormatUint(l.Fence, 10)
+		}
+		if l.Since != nil {
+			since = l.Since.Format(time.RFC3339)
+		}
+		owner := l.Owner
+		if owner == "" {
+			owner = "-"
+		}
+		ttl := time.Duration(l.TTL) * time.Millisecond
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%s\n", l.Key, owner, ttl, fence, since, l.Token)
+	}
+	_ = w.Flush()
+}
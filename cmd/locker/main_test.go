@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/internal/etcd"
+	"github.com/kamilsk/locker/internal/redis"
+	"github.com/kamilsk/locker/lockd"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("redis", func(t *testing.T) {
+		redisServer, err := redis.NewServer()
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		defer redisServer.Close()
+		addr := "redis://" + redisServer.Addr()
+
+		lock := locker.Distributed(time.Minute,
+			locker.DistributedWithKey("jobs:cleanup"),
+			locker.DistributedWithRedis(redisServer.Addr()),
+			locker.DistributedWithOwner("worker"),
+			locker.DistributedWithRefresh(10*time.Millisecond),
+		)
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		defer lock.Unlock(ctx)
+
+		locks := decode(t, "-backend", addr, "-json", "list", "jobs:")
+		if len(locks) != 1 || locks[0].Key != "jobs:cleanup" || locks[0].Owner != "worker" ||
+			locks[0].Token != lock.Holder().Token || locks[0].Fence != lock.Fence() {
+			t.Errorf("unexpected locks %+v", locks)
+			t.FailNow()
+		}
+		if out := execute(t, 0, "-backend", addr, "inspect", "jobs:cleanup"); !strings.Contains(out, "worker") {
+			t.Errorf("unexpected output %q", out)
+			t.FailNow()
+		}
+
+		locks = decode(t, "-backend", addr, "-json", "extend", "-ttl", "1h", "jobs:cleanup")
+		if len(locks) != 1 || locks[0].TTL <= int64(time.Minute/time.Millisecond) {
+			t.Errorf("the lock must be extended: %+v", locks)
+			t.FailNow()
+		}
+
+		execute(t, 1, "-backend", addr, "release", "-token", "unknown", "jobs:cleanup")
+		execute(t, 0, "-backend", addr, "release", "jobs:cleanup")
+		select {
+		case <-lock.Lost().Done():
+		case <-ctx.Done():
+			t.Error("the lock must be lost")
+			t.FailNow()
+		}
+		if out := execute(t, 0, "-backend", addr, "inspect", "jobs:cleanup"); !strings.Contains(out, "free") {
+			t.Errorf("unexpected output %q", out)
+			t.FailNow()
+		}
+		execute(t, 1, "-backend", addr, "release", "jobs:cleanup")
+	})
+
+	t.Run("lockd", func(t *testing.T) {
+		server := httptest.NewServer(lockd.NewServer())
+		defer server.Close()
+
+		client, err := lockd.Dial(server.URL)
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		defer client.Close()
+		if !client.Mutex("jobs:cleanup").TryLock() || !client.Limited("jobs:workers", 4).TryAcquire(2) {
+			t.Error("the locks must be taken")
+			t.FailNow()
+		}
+
+		locks := decode(t, "-backend", server.URL, "-json", "list", "jobs:")
+		if len(locks) != 2 || locks[0].Key != "jobs:cleanup" || locks[1].Key != "jobs:workers" || locks[0].Since == nil {
+			t.Errorf("unexpected locks %+v", locks)
+			t.FailNow()
+		}
+		execute(t, 1, "-backend", server.URL, "extend", "-ttl", "1h", "jobs:workers")
+		execute(t, 0, "-backend", server.URL, "extend", "jobs:workers")
+		execute(t, 0, "-backend", server.URL, "release", "jobs:workers")
+		if !client.Limited("jobs:workers", 4).TryAcquire(4) {
+			t.Error("the semaphore must be released")
+			t.FailNow()
+		}
+	})
+
+	t.Run("etcd", func(t *testing.T) {
+		server := httptest.NewServer(etcd.NewServer())
+		defer server.Close()
+		addr := "etcd://" + strings.TrimPrefix(server.URL, "http://")
+
+		if _, acquired, err := locker.EtcdBackend(server.URL).Acquire("jobs:cleanup", "token:host", time.Minute); err != nil || !acquired {
+			t.Error("the lock must be taken")
+			t.FailNow()
+		}
+		execute(t, 1, "-backend", addr, "extend", "-ttl", "1h", "jobs:cleanup")
+		execute(t, 0, "-backend", addr, "extend", "jobs:cleanup")
+		execute(t, 0, "-backend", addr, "release", "jobs:cleanup")
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		execute(t, 2, "list")
+		execute(t, 2, "-backend", "unknown://", "list")
+		execute(t, 2, "-backend", "redis://127.0.0.1:0", "unknown")
+		execute(t, 2, "-backend", "redis://127.0.0.1:0", "inspect")
+		if out := execute(t, 1, "-backend", "memcache://127.0.0.1:0", "list"); out != "" {
+			t.Errorf("unexpected output %q", out)
+			t.FailNow()
+		}
+	})
+}
+
+func execute(t *testing.T, code int, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	if exit := run(args, &stdout, &stderr); exit != code {
+		t.Errorf("unexpected exit code %d of %v: %s", exit, args, stderr.String())
+		t.FailNow()
+	}
+	return stdout.String()
+}
+
+func decode(t *testing.T, args ...string) []lock {
+	var locks []lock
+	if err := json.Unmarshal([]byte(execute(t, 0, args...)), &locks); err != nil {
+		t.Errorf("unexpected output: %v", err)
+		t.FailNow()
+	}
+	return locks
+}
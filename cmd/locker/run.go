@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/lockd"
+)
+
+// forwarded are the signals passed to the running command.
+var forwarded = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// config contains the global flags of the command.
+type config struct {
+	backend string
+	table   string
+	timeout time.Duration
+}
+
+// runLocked takes the lock, runs the command while the lock is held
+// and returns the exit code of the command. The received signals are
+// forwarded to the command. If the lock is lost, the command is
+// terminated and killed if it doesn't exit during the grace period.
+//
+//  $ locker run -key deploy -backend redis://127.0.0.1:6379 -timeout 1m -- ./deploy.sh production
+//
+// The lockfile in the temporary directory is used by default.
+func runLocked(global config, args []string, signals <-chan os.Signal, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		key      = flags.String("key", "", "name of the lock, required")
+		backend  = flags.String("backend", global.backend, "url of the backend, the lockfile in the temporary directory by default")
+		wait     = flags.Duration("timeout", 0, "time to wait for the lock, forever by default")
+		ttl      = flags.Duration("ttl", time.Minute, "ttl of the lock renewed while the command runs")
+		conflict = flags.Int("conflict-exit-code", 1, "exit code if the lock is not taken during the timeout")
+		grace    = flags.Duration("kill-after", 10*time.Second, "time to wait for the command after termination on the lock loss")
+	)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: locker run -key name [flags] -- command [arguments]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *key == "" || flags.NArg() == 0 || *ttl <= 0 {
+		flags.Usage()
+		return 2
+	}
+	if *backend == "" {
+		*backend = "file://" + filepath.ToSlash(os.TempDir())
+	}
+
+	lock, err := mutexOf(*backend, *key, *ttl, global)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "locker: run:", err)
+		return 2
+	}
+	defer lock.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if *wait > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), *wait)
+	}
+	defer cancel()
+	interrupted, watched := make(chan os.Signal, 1), make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case sig := <-signals:
+			interrupted <- sig
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err = lock.Lock(ctx)
+	cancel()
+	<-watched
+	var sig os.Signal
+	select {
+	case sig = <-interrupted:
+	default:
+	}
+	if err != nil {
+		if sig != nil {
+			return 128 + signum(sig)
+		}
+		if err == locker.Interrupted {
+			_, _ = fmt.Fprintf(stderr, "locker: run: the lock %q is busy\n", *key)
+			return *conflict
+		}
+		_, _ = fmt.Fprintln(stderr, "locker: run:", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), global.timeout)
+		defer cancel()
+		_ = lock.Unlock(ctx)
+	}()
+
+	cmd := exec.Command(flags.Arg(0), flags.Args()[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, stdout, stderr
+	if err := cmd.Start(); err != nil {
+		_, _ = fmt.Fprintln(stderr, "locker: run:", err)
+		if e, is := err.(*exec.Error); is && e.Err == exec.ErrNotFound {
+			return 127
+		}
+		return 126
+	}
+	if sig != nil {
+		// the signal received right before the lock was taken
+		_ = cmd.Process.Signal(sig)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	lost, kill := lock.Lost(), (<-chan time.Time)(nil)
+	for {
+		select {
+		case sig := <-signals:
+			_ = cmd.Process.Signal(sig)
+		case <-lost:
+			lost = nil
+			_, _ = fmt.Fprintf(stderr, "locker: run: the lock %q is lost, the command is terminated\n", *key)
+			if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+				_ = cmd.Process.Kill()
+				break
+			}
+			timer := time.NewTimer(*grace)
+			defer timer.Stop()
+			kill = timer.C
+		case <-kill:
+			_ = cmd.Process.Kill()
+		case err := <-done:
+			return exitCode(err)
+		}
+	}
+}
+
+// mutex is a lock which can be lost while it is held.
+type mutex interface {
+	locker.Locker
+	// Lost returns a channel that's closed when the held lock is lost.
+	Lost() <-chan struct{}
+	// Close releases resources associated with the lock.
+	Close() error
+}
+
+// mutexOf returns the lock by the key kept by the backend.
+func mutexOf(backend, key string, ttl time.Duration, global config) (mutex, error) {
+	if isLockd(backend) {
+		client, err := lockd.Dial(backend, lockd.DialWithTTL(ttl))
+		if err != nil {
+			return nil, err
+		}
+		return &remote{Locker: client.Mutex(key), client: client}, nil
+	}
+	storage, err := backendOf(backend, global.table, global.timeout)
+	if err != nil {
+		return nil, err
+	}
+	lock := locker.Distributed(ttl, locker.DistributedWithKey(key), locker.DistributedWithBackend(storage))
+	return &distributed{Locker: lock, lost: lock.Lost}, nil
+}
+
+// distributed is the mutex based on the Distributed lock.
+type distributed struct {
+	locker.Locker
+	lost func() locker.Breaker
+}
+
+func (lock *distributed) Lost() <-chan struct{} { return lock.lost().Done() }
+
+func (lock *distributed) Close() error { return nil }
+
+// remote is the mutex hosted by the lockd server,
+// it is lost with the session of the client.
+type remote struct {
+	locker.Locker
+	client *lockd.Client
+}
+
+func (lock *remote) Lost() <-chan struct{} { return lock.client.Done() }
+
+func (lock *remote) Close() error { return lock.client.Close() }
+
+// exitCode returns the exit code of the finished command
+// in the shell convention: 128 plus the number of the signal
+// which killed the command.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, is := err.(*exec.ExitError); is {
+		if status, is := e.Sys().(syscall.WaitStatus); is {
+			if status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return status.ExitStatus()
+		}
+	}
+	return 1
+}
+
+func signum(sig os.Signal) int {
+	if sig, is := sig.(syscall.Signal); is {
+		return int(sig)
+	}
+	return int(syscall.SIGINT)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamilsk/locker"
+)
+
+func TestRunLocked(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "locker")
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	global := config{backend: "file://" + dir, table: "locks", timeout: time.Second}
+	backend := locker.LockfileBackend(dir)
+
+	if err := os.Setenv("LOCKER_HELPER", "1"); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer os.Unsetenv("LOCKER_HELPER")
+
+	t.Run("exit code", func(t *testing.T) {
+		var stdout, stderr buffer
+		if code := runLocked(global, helper("-key", "exit", "exit", "3"), nil, &stdout, &stderr); code != 3 {
+			t.Errorf("unexpected exit code %d: %s", code, stderr.String())
+			t.FailNow()
+		}
+		if lease, err := backend.Inspect("exit"); err != nil || lease.Held() {
+			t.Error("the lock must be released")
+			t.FailNow()
+		}
+		if code := run(append([]string{"-backend", global.backend, "run"}, helper("-key", "exit", "exit", "0")...), &stdout, &stderr); code != 0 {
+			t.Errorf("unexpected exit code %d: %s", code, stderr.String())
+			t.FailNow()
+		}
+	})
+
+	t.Run("busy lock", func(t *testing.T) {
+		lock := locker.Distributed(time.Minute, locker.DistributedWithKey("busy"), locker.DistributedWithBackend(backend))
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		defer lock.Unlock(ctx)
+
+		var stdout, stderr buffer
+		args := helper("-key", "busy", "-timeout", "50ms", "-conflict-exit-code", "75", "exit", "0")
+		if code := runLocked(global, args, nil, &stdout, &stderr); code != 75 || !strings.Contains(stderr.String(), "busy") {
+			t.Errorf("unexpected exit code %d: %s", code, stderr.String())
+			t.FailNow()
+		}
+	})
+
+	t.Run("lost lock", func(t *testing.T) {
+		var stdout, stderr buffer
+		exit := make(chan int, 1)
+		go func() {
+			exit <- runLocked(global, helper("-key", "lost", "-ttl", "300ms", "sleep"), nil, &stdout, &stderr)
+		}()
+		stdout.wait(ctx, t, "ready")
+
+		lease, err := backend.Inspect("lost")
+		if err != nil || !lease.Held() {
+			t.Error("the lock must be held while the command runs")
+			t.FailNow()
+		}
+		if err := backend.Release("lost", lease.Token); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if code := <-exit; code == 0 || !strings.Contains(stderr.String(), "lost") {
+			t.Errorf("unexpected exit code %d: %s", code, stderr.String())
+			t.FailNow()
+		}
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the signal can't be sent on the platform")
+		}
+		var stdout, stderr buffer
+		signals, exit := make(chan os.Signal, 1), make(chan int, 1)
+		go func() { exit <- runLocked(global, helper("-key", "signal", "signal"), signals, &stdout, &stderr) }()
+		stdout.wait(ctx, t, "ready")
+
+		signals <- os.Interrupt
+		if code := <-exit; code != 5 {
+			t.Errorf("unexpected exit code %d: %s", code, stderr.String())
+			t.FailNow()
+		}
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		var stdout, stderr buffer
+		if code := runLocked(global, []string{"-key", "unknown", "--", "locker-unknown-command"}, nil, &stdout, &stderr); code != 127 {
+			t.Errorf("unexpected exit code %d: %s", code, stderr.String())
+			t.FailNow()
+		}
+	})
+}
+
+// TestHelperProcess is the command run under the lock.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("LOCKER_HELPER") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	switch args[1] {
+	case "exit":
+		code, _ := strconv.Atoi(args[2])
+		os.Exit(code)
+	case "sleep":
+		fmt.Println("ready")
+		time.Sleep(time.Minute)
+	case "signal":
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		fmt.Println("ready")
+		<-signals
+		os.Exit(5)
+	}
+	os.Exit(1)
+}
+
+// helper returns the arguments of the run command to run the helper
+// process in the mode after the flags.
+func helper(args ...string) []string {
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		i += 2
+	}
+	command := []string{"--", os.Args[0], "-test.run=^TestHelperProcess$", "--"}
+	return append(append(args[:i:i], command...), args[i:]...)
+}
+
+// buffer is a safe for concurrent use bytes.Buffer.
+type buffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// wait waits until the output contains the text.
+func (b *buffer) wait(ctx context.Context, t *testing.T, text string) {
+	for !strings.Contains(b.String(), text) {
+		select {
+		case <-ctx.Done():
+			t.Errorf("the output must contain %q", text)
+			t.FailNow()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
@@ -1,21 +1,401 @@
 package locker
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/kamilsk/locker/internal"
 )
 
-func Distributed(ttl time.Duration) *dlock {
-	return &dlock{}
+// Distributed returns a new instance of distributed mutex.
+// The lock is held no longer than the ttl, so it is released
+// automatically if its owner has crashed. The lock state is kept
+// by a Backend, e.g. RedisBackend, EtcdBackend, MemoryBackend
+// or a custom implementation. While the lock is held, it is renewed
+// in background and the Lost method signals if it failed.
+//
+//  lock := locker.Distributed(time.Minute,
+//  	locker.DistributedWithKey("jobs:cleanup"),
+//  	locker.DistributedWithRedis("127.0.0.1:6379"),
+//  )
+//
+//  if err := lock.Lock(ctx); err != nil {
+//  	return err
+//  }
+//  defer lock.Unlock(context.Background())
+//  // critical section with lock protection
+//  // only one process can be here one moment in time
+//
+func Distributed(ttl time.Duration, options ...DistributedOption) *DistributedLock {
+	lock := &DistributedLock{
+		key:     "locker",
+		ttl:     ttl,
+		refresh: ttl / 3,
+		retry:   50 * time.Millisecond,
+		slot:    make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(lock)
+	}
+	return lock
 }
 
-type dlock struct{}
+// DistributedOption configures the distributed mutex.
+type DistributedOption func(*DistributedLock)
 
-func (lock *dlock) Lock(internal.Breaker) error {
-	return nil
+// DistributedWithKey sets up the name of the lock shared by processes.
+func DistributedWithKey(key string) DistributedOption {
+	return func(lock *DistributedLock) { lock.key = key }
+}
+
+// DistributedWithBackend sets up the storage of the lock state.
+func DistributedWithBackend(backend Backend) DistributedOption {
+	return func(lock *DistributedLock) { lock.backend = backend }
+}
+
+// DistributedWithRefresh sets up the interval of the lock renewal
+// while it is held. By default, the lock is renewed three times
+// per its ttl. The non-positive interval disables the renewal,
+// so the lock is considered lost after the ttl.
+func DistributedWithRefresh(interval time.Duration) DistributedOption {
+	return func(lock *DistributedLock) { lock.refresh = interval }
+}
+
+// DistributedWithRetry sets up the interval between attempts
+// to take the lock while it is in use. It is not used if the Backend
+// implements the Waiter interface.
+func DistributedWithRetry(interval time.Duration) DistributedOption {
+	return func(lock *DistributedLock) { lock.retry = interval }
+}
+
+// DistributedWithOwner sets up the id of the lock owner. It is encoded
+// into the token of the owner, so other processes can find out
+// who holds the lock by the Owner method of its Lease. By default,
+// it is the id carried by the Breaker passed to the Lock method,
+// see WithOwner, or the host and the pid of the process.
+func DistributedWithOwner(id string) DistributedOption {
+	return func(lock *DistributedLock) { lock.owner = id }
+}
+
+// A DistributedLock is the mutex shared by processes, see Distributed.
+type DistributedLock struct {
+	backend Backend
+	key     string
+	owner   string
+	ttl     time.Duration
+	refresh time.Duration
+	retry   time.Duration
+
+	// slot is taken by the session until it is unlocked,
+	// so the next one can't replace it even if it's lost
+	slot    chan struct{}
+	mu      sync.Mutex
+	session *dsession
 }
 
-func (lock *dlock) Unlock(internal.Breaker) error {
+// dsession is a period of the lock ownership.
+type dsession struct {
+	owner string
+	since time.Time
+	token string
+	fence uint64
+	once  sync.Once
+	lost  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newSession(owner, token string, fence uint64) *dsession {
+	return &dsession{
+		owner: owner,
+		since: time.Now(),
+		token: token,
+		fence: fence,
+		lost:  make(chan struct{}),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Done returns a channel that's closed when the ownership is over.
+func (session *dsession) Done() <-chan struct{} {
+	return session.lost
+}
+
+func (session *dsession) close() {
+	session.once.Do(func() { close(session.lost) })
+}
+
+// Lock takes an exclusive lock. If the lock is already in use,
+// the calling goroutine blocks until the lock is available or
+// an error occurred, e.g. if the Breaker is done or the storage
+// is unavailable. The instance holds a single session at a time,
+// so it also waits for the Unlock of the previous one even if
+// that one is lost.
+func (lock *DistributedLock) Lock(breaker Breaker) error {
+	if lock.backend == nil {
+		return CriticalIssue
+	}
+	select {
+	case lock.slot <- struct{}{}:
+	case <-breaker.Done():
+		return Interrupted
+	}
+	if err := lock.acquire(breaker); err != nil {
+		<-lock.slot
+		return err
+	}
 	return nil
 }
+
+// acquire takes the lock in the storage and starts its session.
+func (lock *DistributedLock) acquire(breaker Breaker) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	owner := lock.owner
+	if owner == "" {
+		owner = identify(breaker)
+	}
+	token += ":" + owner
+	for {
+		select {
+		case <-breaker.Done():
+			return Interrupted
+		default:
+		}
+
+		fence, deadline, acquired, err := lock.take(token)
+		if err != nil {
+			_ = lock.backend.Release(lock.key, token)
+			return err
+		}
+		if acquired {
+			session := newSession(owner, token, fence)
+			lock.mu.Lock()
+			lock.session = session
+			lock.mu.Unlock()
+			go session.keepAlive(deadline, lock.refresh, func() (time.Time, error) {
+				return lock.renew(token)
+			})
+			return nil
+		}
+
+		if err := lock.wait(breaker, token); err != nil {
+			// leave the queue if the backend keeps it
+			_ = lock.backend.Release(lock.key, token)
+			return err
+		}
+	}
+}
+
+// Unlock releases an exclusive lock taken by the instance. It returns
+// an error if the lock is not held on entry to Unlock or the Breaker
+// is done. It returns InvalidIntent if the session of the lock has
+// already ended, e.g. its ttl has expired, but the session is over
+// anyway, so the lock can be taken again.
+func (lock *DistributedLock) Unlock(breaker Breaker) error {
+	if lock.backend == nil {
+		return CriticalIssue
+	}
+	select {
+	case <-breaker.Done():
+		return Interrupted
+	default:
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	session := lock.session
+	if session == nil {
+		return InvalidIntent
+	}
+	ended := false
+	select {
+	case <-session.Done():
+		ended = true
+	default:
+	}
+	err := lock.backend.Release(lock.key, session.token)
+	if err != nil && err != InvalidIntent {
+		return err
+	}
+	lock.session = nil
+	session.end()
+	<-lock.slot
+	if ended {
+		return InvalidIntent
+	}
+	return err
+}
+
+// Fence returns the fencing token of the held lock or zero otherwise.
+// The token increases with each new owner of the lock, so a shared
+// storage can reject writes of a previous owner which lost the lock
+// but hasn't noticed it yet, e.g. by the FencingGuard.
+//
+//  if err := lock.Lock(ctx); err != nil {
+//  	return err
+//  }
+//  defer lock.Unlock(context.Background())
+//  storage.Write(lock.Fence(), data)
+//
+func (lock *DistributedLock) Fence() uint64 {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.session == nil {
+		return 0
+	}
+	return lock.session.fence
+}
+
+// Holder returns the owner of the held lock with its tokens
+// or the zero Holder otherwise. The Token is used to release the lock,
+// so it can be released by the Backend in case of emergency.
+func (lock *DistributedLock) Holder() Holder {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	session := lock.session
+	if session == nil {
+		return Holder{}
+	}
+	return Holder{ID: session.owner, Since: session.since, Token: session.token, Fence: session.fence}
+}
+
+// Lost returns a Breaker that is done when the lock is no longer held,
+// e.g. it is released or its renewal failed and the ttl has expired.
+// It is already done if the lock is not held.
+//
+//  if err := lock.Lock(ctx); err != nil {
+//  	return err
+//  }
+//  defer lock.Unlock(context.Background())
+//
+//  for _, job := range jobs {
+//  	select {
+//  	case <-lock.Lost().Done():
+//  		// another process can take the lock at this moment
+//  		return locker.Interrupted
+//  	default:
+//  	}
+//  	job.Do()
+//  }
+//
+func (lock *DistributedLock) Lost() Breaker {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.session == nil {
+		session := &dsession{lost: make(chan struct{})}
+		session.close()
+		return session
+	}
+	return lock.session
+}
+
+// keepAlive renews the session until it is stopped. The ownership is lost
+// if the renewal is rejected or can't be confirmed until the deadline.
+// The renewal returns the deadline of the renewed lease.
+func (session *dsession) keepAlive(deadline time.Time, refresh time.Duration, renew func() (time.Time, error)) {
+	defer close(session.done)
+
+	var tick <-chan time.Time
+	if refresh > 0 {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-session.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			session.close()
+			return
+		case <-tick:
+			timer.Stop()
+		}
+
+		switch next, err := renew(); err {
+		case nil:
+			deadline = next
+		case InvalidIntent:
+			session.close()
+			return
+		}
+	}
+}
+
+// end stops the renewal of the session and marks it as over.
+func (session *dsession) end() {
+	close(session.stop)
+	<-session.done
+	session.close()
+}
+
+// expiry returns the time when the lease requested for the ttl
+// at the start expires by the local clock. The storage could grant it
+// at any moment of the round trip, so the time of the request is counted
+// as a part of the lease and a margin for the clock drift is reserved.
+func expiry(start time.Time, ttl time.Duration) time.Time {
+	return start.Add(ttl - ttl/100 - 2*time.Millisecond)
+}
+
+// take tries to take the lock in the storage for the token
+// and returns the deadline of its lease. It is defined by the storage
+// if it implements the Validator interface.
+func (lock *DistributedLock) take(token string) (uint64, time.Time, bool, error) {
+	start := time.Now()
+	if backend, is := lock.backend.(Validator); is {
+		fence, validity, err := backend.AcquireValidity(lock.key, token, lock.ttl)
+		return fence, time.Now().Add(validity), validity > 0, err
+	}
+	fence, acquired, err := lock.backend.Acquire(lock.key, token, lock.ttl)
+	return fence, expiry(start, lock.ttl), acquired, err
+}
+
+// renew extends the lease of the token in the storage
+// and returns its new deadline.
+func (lock *DistributedLock) renew(token string) (time.Time, error) {
+	start := time.Now()
+	if backend, is := lock.backend.(Validator); is {
+		validity, err := backend.RefreshValidity(lock.key, token, lock.ttl)
+		return time.Now().Add(validity), err
+	}
+	err := lock.backend.Refresh(lock.key, token, lock.ttl)
+	return expiry(start, lock.ttl), err
+}
+
+func (lock *DistributedLock) wait(breaker Breaker, token string) error {
+	if backend, is := lock.backend.(Waiter); is {
+		return backend.Wait(breaker, lock.key, token)
+	}
+	timer := time.NewTimer(lock.retry)
+	defer timer.Stop()
+	select {
+	case <-breaker.Done():
+		return Interrupted
+	case <-timer.C:
+		return nil
+	}
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ownerOf returns the identity of the lock owner encoded into its token
+// or an empty string if the token doesn't contain it.
+func ownerOf(token string) string {
+	if i := strings.IndexByte(token, ':'); i >= 0 {
+		return token[i+1:]
+	}
+	return ""
+}
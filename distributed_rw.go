@@ -0,0 +1,245 @@
+package locker
+
+import (
+	"sync"
+	"time"
+)
+
+// A RWBackend defines a storage of the distributed reader/writer
+// lock state. Each holder is identified by a token and has a lease
+// which expires after the ttl if it is not refreshed.
+type RWBackend interface {
+	// AcquireRead adds the reader by the token if there is
+	// no writer holding or waiting for the lock.
+	AcquireRead(key, token string, ttl time.Duration) (bool, error)
+	// AcquireWrite registers the writer by the token to block
+	// new readers and returns true if there are no readers left.
+	// It returns false if another writer holds or waits for the lock.
+	AcquireWrite(key, token string, ttl time.Duration) (bool, error)
+	// Release removes the reader or the writer by the token.
+	// It returns InvalidIntent if the token is not found.
+	Release(key, token string) error
+	// Refresh extends the lease of the reader or the writer by the token.
+	// It returns InvalidIntent if the token is not found.
+	Refresh(key, token string, ttl time.Duration) error
+}
+
+// DistributedRW returns a new instance of distributed reader/writer mutex.
+// The lock can be held by many readers or by a single writer.
+// A writer waits for readers to drain and blocks new ones meanwhile,
+// so it can't be starved. Each lease is held no longer than the ttl,
+// so it is released automatically if its holder has crashed.
+// While leases are held, they are renewed in background.
+//
+//  lock := locker.DistributedRW(time.Minute,
+//  	locker.DistributedRWWithKey("config"),
+//  	locker.DistributedRWWithRedis("127.0.0.1:6379"),
+//  )
+//
+//  if err := lock.RLock(ctx); err != nil {
+//  	return err
+//  }
+//  defer lock.RUnlock(context.Background())
+//  // many processes can read here one moment in time
+//
+func DistributedRW(ttl time.Duration, options ...DistributedRWOption) *DistributedRWLock {
+	lock := &DistributedRWLock{key: "locker", ttl: ttl, refresh: ttl / 3, retry: 50 * time.Millisecond}
+	for _, option := range options {
+		option(lock)
+	}
+	return lock
+}
+
+// DistributedRWOption configures the distributed reader/writer mutex.
+type DistributedRWOption func(*DistributedRWLock)
+
+// DistributedRWWithKey sets up the name of the lock shared by processes.
+func DistributedRWWithKey(key string) DistributedRWOption {
+	return func(lock *DistributedRWLock) { lock.key = key }
+}
+
+// DistributedRWWithBackend sets up the storage of the lock state.
+func DistributedRWWithBackend(backend RWBackend) DistributedRWOption {
+	return func(lock *DistributedRWLock) { lock.backend = backend }
+}
+
+// DistributedRWWithRefresh sets up the interval of the lease renewal
+// while the lock is held. By default, the lease is renewed three times
+// per its ttl. The non-positive interval disables the renewal.
+func DistributedRWWithRefresh(interval time.Duration) DistributedRWOption {
+	return func(lock *DistributedRWLock) { lock.refresh = interval }
+}
+
+// DistributedRWWithRetry sets up the interval between attempts
+// to take the lock while it is in use.
+func DistributedRWWithRetry(interval time.Duration) DistributedRWOption {
+	return func(lock *DistributedRWLock) { lock.retry = interval }
+}
+
+// A DistributedRWLock is the reader/writer mutex shared by processes,
+// see DistributedRW.
+type DistributedRWLock struct {
+	backend RWBackend
+	key     string
+	ttl     time.Duration
+	refresh time.Duration
+	retry   time.Duration
+
+	mu      sync.Mutex
+	writer  *dsession
+	readers []*dsession
+}
+
+// Lock takes an exclusive lock. If the lock is already in use,
+// the calling goroutine blocks until the lock is available or
+// an error occurred, e.g. if the Breaker is done or the storage
+// is unavailable. New readers are blocked while it waits.
+func (lock *DistributedRWLock) Lock(breaker Breaker) error {
+	session, err := lock.acquire(breaker, true)
+	if err != nil {
+		return err
+	}
+	lock.mu.Lock()
+	lock.writer = session
+	lock.mu.Unlock()
+	return nil
+}
+
+// Unlock releases an exclusive lock. It returns an error
+// if the lock is not held on entry to Unlock, its ttl has expired,
+// or the Breaker is done.
+func (lock *DistributedRWLock) Unlock(breaker Breaker) error {
+	if lock.backend == nil {
+		return CriticalIssue
+	}
+	select {
+	case <-breaker.Done():
+		return Interrupted
+	default:
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.writer == nil {
+		return InvalidIntent
+	}
+	err := lock.release(lock.writer)
+	if err == nil || err == InvalidIntent {
+		lock.writer = nil
+	}
+	return err
+}
+
+// RLock takes a shared lock. If the lock is held or awaited by a writer,
+// the calling goroutine blocks until the lock is available or
+// an error occurred, e.g. if the Breaker is done or the storage
+// is unavailable.
+func (lock *DistributedRWLock) RLock(breaker Breaker) error {
+	session, err := lock.acquire(breaker, false)
+	if err != nil {
+		return err
+	}
+	lock.mu.Lock()
+	lock.readers = append(lock.readers, session)
+	lock.mu.Unlock()
+	return nil
+}
+
+// RUnlock releases a single shared lock. It returns an error
+// if the lock is not held on entry to RUnlock, its ttl has expired,
+// or the Breaker is done.
+func (lock *DistributedRWLock) RUnlock(breaker Breaker) error {
+	if lock.backend == nil {
+		return CriticalIssue
+	}
+	select {
+	case <-breaker.Done():
+		return Interrupted
+	default:
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	last := len(lock.readers) - 1
+	if last < 0 {
+		return InvalidIntent
+	}
+	err := lock.release(lock.readers[last])
+	if err == nil || err == InvalidIntent {
+		lock.readers[last] = nil
+		lock.readers = lock.readers[:last]
+	}
+	return err
+}
+
+// Lost returns a Breaker that is done when the exclusive lock
+// is no longer held, e.g. it is released or its renewal failed
+// and the ttl has expired. It is already done if the lock is not held.
+func (lock *DistributedRWLock) Lost() Breaker {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.writer == nil {
+		session := &dsession{lost: make(chan struct{})}
+		session.close()
+		return session
+	}
+	return lock.writer
+}
+
+// acquire takes the exclusive or the shared lock
+// and starts the renewal of its lease.
+func (lock *DistributedRWLock) acquire(breaker Breaker, exclusive bool) (*dsession, error) {
+	if lock.backend == nil {
+		return nil, CriticalIssue
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case <-breaker.Done():
+			// withdraw the intent of the writer
+			_ = lock.backend.Release(lock.key, token)
+			return nil, Interrupted
+		default:
+		}
+
+		try := lock.backend.AcquireRead
+		if exclusive {
+			try = lock.backend.AcquireWrite
+		}
+		start := time.Now()
+		acquired, err := try(lock.key, token, lock.ttl)
+		if err != nil {
+			_ = lock.backend.Release(lock.key, token)
+			return nil, err
+		}
+		if acquired {
+			session := newSession("", token, 0)
+			go session.keepAlive(expiry(start, lock.ttl), lock.refresh, func() (time.Time, error) {
+				start := time.Now()
+				err := lock.backend.Refresh(lock.key, token, lock.ttl)
+				return expiry(start, lock.ttl), err
+			})
+			return session, nil
+		}
+
+		timer := time.NewTimer(lock.retry)
+		select {
+		case <-breaker.Done():
+			timer.Stop()
+			_ = lock.backend.Release(lock.key, token)
+			return nil, Interrupted
+		case <-timer.C:
+		}
+	}
+}
+
+func (lock *DistributedRWLock) release(session *dsession) error {
+	err := lock.backend.Release(lock.key, session.token)
+	if err == nil || err == InvalidIntent {
+		session.end()
+	}
+	return err
+}
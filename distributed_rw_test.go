@@ -0,0 +1,181 @@
+package locker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+	"github.com/kamilsk/locker/internal/redis"
+)
+
+func TestDistributedRW(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	server, err := redis.NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer server.Close()
+
+	backends := map[string]RWBackend{
+		"memory": MemoryRWBackend(),
+		"redis":  RedisRWBackend(server.Addr()),
+	}
+	for name, backend := range backends {
+		options := func(t *testing.T) []DistributedRWOption {
+			return []DistributedRWOption{
+				DistributedRWWithKey(t.Name()),
+				DistributedRWWithBackend(backend),
+				DistributedRWWithRetry(time.Millisecond),
+			}
+		}
+
+		t.Run(name+" readers and writer", func(t *testing.T) {
+			reader, writer := DistributedRW(time.Minute, options(t)...), DistributedRW(time.Minute, options(t)...)
+			for i := 0; i < 2; i++ {
+				if err := reader.RLock(ctx); err != nil {
+					t.Error("readers must share the lock")
+					t.FailNow()
+				}
+			}
+			if err := writer.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+			another := DistributedRW(time.Minute, options(t)...)
+			if err := another.RLock(ctx); err != nil {
+				t.Error("the interrupted writer must not block readers")
+				t.FailNow()
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- writer.Lock(ctx) }()
+			// wait until the writer blocks new readers
+			for {
+				probe := DistributedRW(time.Minute, options(t)...)
+				err := probe.RLock(breaker.BreakByContext(context.WithTimeout(ctx, 5*time.Millisecond)))
+				if err == Interrupted {
+					break
+				}
+				if err != nil || probe.RUnlock(ctx) != nil || ctx.Err() != nil {
+					t.Error("the writer must block new readers")
+					t.FailNow()
+				}
+			}
+			for i := 0; i < 2; i++ {
+				if err := reader.RUnlock(ctx); err != nil {
+					t.Error("unexpected error")
+					t.FailNow()
+				}
+			}
+			if err := reader.RUnlock(ctx); err != InvalidIntent {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+			select {
+			case <-done:
+				t.Error("the writer must wait for all readers")
+				t.FailNow()
+			case <-time.After(10 * time.Millisecond):
+			}
+			if err := another.RUnlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := <-done; err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := writer.Unlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		})
+
+		t.Run(name+" writer after readers", func(t *testing.T) {
+			reader, writer := DistributedRW(time.Minute, options(t)...), DistributedRW(time.Minute, options(t)...)
+			if err := reader.RLock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			done := make(chan error, 1)
+			go func() { done <- writer.Lock(ctx) }()
+			time.Sleep(5 * time.Millisecond)
+			if err := reader.RUnlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := <-done; err != nil {
+				t.Error("the writer must take the lock after readers")
+				t.FailNow()
+			}
+			if err := reader.RLock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+				t.Error("the writer must exclude readers")
+				t.FailNow()
+			}
+			if err := writer.Unlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			select {
+			case <-writer.Lost().Done():
+			default:
+				t.Error("the breaker must be done after unlock")
+				t.FailNow()
+			}
+			if err := reader.RLock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := reader.RUnlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		})
+
+		t.Run(name+" crashed reader", func(t *testing.T) {
+			crashed := DistributedRW(10*time.Millisecond, append(options(t), DistributedRWWithRefresh(0))...)
+			writer := DistributedRW(time.Minute, options(t)...)
+			if err := crashed.RLock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := writer.Lock(ctx); err != nil {
+				t.Error("the writer must take the lock after the ttl of the reader")
+				t.FailNow()
+			}
+			if err := crashed.RUnlock(ctx); err != InvalidIntent {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+			if err := writer.Unlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("without storage", func(t *testing.T) {
+		lock := DistributedRW(time.Minute)
+		if err := lock.Lock(ctx); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := lock.RLock(ctx); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := lock.RUnlock(ctx); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+}
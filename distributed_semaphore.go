@@ -0,0 +1,298 @@
+package locker
+
+import (
+	"sync"
+	"time"
+)
+
+// A SemaphoreBackend defines a storage of the distributed semaphore state.
+// Each holder of permits is identified by a token and has a lease
+// which expires after the ttl if it is not refreshed.
+type SemaphoreBackend interface {
+	// Acquire adds the weight to the holder by the token if the total weight
+	// of alive holders doesn't exceed the limit. The capacity is used
+	// as the limit if it has not been set yet.
+	Acquire(key, token string, weight, capacity uint32, ttl time.Duration) (bool, error)
+	// Release subtracts the weight from the holder by the token and returns
+	// the total weight before the release. It returns InvalidIntent
+	// if the holder doesn't have enough weight.
+	Release(key, token string, weight uint32) (uint32, error)
+	// Refresh extends the lease of the holder by the token for the ttl.
+	// It returns InvalidIntent if the lease has already expired.
+	Refresh(key, token string, ttl time.Duration) error
+	// State returns the total weight of alive holders and the limit.
+	// The capacity is used as the limit if it has not been set yet.
+	State(key string, capacity uint32) (count, limit uint32, err error)
+	// Resize sets the limit and returns the previous one.
+	// The capacity is used as the previous limit if it has not been set yet.
+	Resize(key string, capacity, limit uint32) (uint32, error)
+}
+
+// DistributedLimited returns a new instance of distributed semaphore.
+// Its permits are shared by processes and held no longer than the ttl,
+// so they are returned automatically if their holder has crashed.
+// While permits are held, they are renewed in background.
+//
+// The capacity is used until the limit is set by the SetCapacity method
+// of any process.
+//
+//  sem := locker.DistributedLimited(10, time.Minute,
+//  	locker.DistributedLimitedWithKey("jobs:workers"),
+//  	locker.DistributedLimitedWithRedis("127.0.0.1:6379"),
+//  )
+//
+//  if err := sem.Acquire(ctx, 1); err != nil {
+//  	return err
+//  }
+//  defer sem.Release(1)
+//  // no more than ten processes can be here one moment in time
+//
+func DistributedLimited(capacity uint, ttl time.Duration, options ...DistributedLimitedOption) *DistributedLimitedLock {
+	sem := &DistributedLimitedLock{
+		key:      "locker",
+		capacity: uint32(capacity),
+		ttl:      ttl,
+		refresh:  ttl / 3,
+		retry:    50 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(sem)
+	}
+	return sem
+}
+
+// DistributedLimitedOption configures the distributed semaphore.
+type DistributedLimitedOption func(*DistributedLimitedLock)
+
+// DistributedLimitedWithKey sets up the name of the semaphore shared by processes.
+func DistributedLimitedWithKey(key string) DistributedLimitedOption {
+	return func(sem *DistributedLimitedLock) { sem.key = key }
+}
+
+// DistributedLimitedWithBackend sets up the storage of the semaphore state.
+func DistributedLimitedWithBackend(backend SemaphoreBackend) DistributedLimitedOption {
+	return func(sem *DistributedLimitedLock) { sem.backend = backend }
+}
+
+// DistributedLimitedWithRefresh sets up the interval of the lease renewal
+// while permits are held. By default, the lease is renewed three times
+// per its ttl. The non-positive interval disables the renewal.
+func DistributedLimitedWithRefresh(interval time.Duration) DistributedLimitedOption {
+	return func(sem *DistributedLimitedLock) { sem.refresh = interval }
+}
+
+// DistributedLimitedWithRetry sets up the interval between attempts
+// to acquire permits while they are in use.
+func DistributedLimitedWithRetry(interval time.Duration) DistributedLimitedOption {
+	return func(sem *DistributedLimitedLock) { sem.retry = interval }
+}
+
+// A DistributedLimitedLock is the semaphore shared by processes,
+// see DistributedLimited.
+type DistributedLimitedLock struct {
+	backend  SemaphoreBackend
+	key      string
+	capacity uint32
+	ttl      time.Duration
+	refresh  time.Duration
+	retry    time.Duration
+
+	mu      sync.Mutex
+	token   string
+	held    uint32
+	session *dsession
+}
+
+// Lock acquires all permits of the semaphore.
+func (sem *DistributedLimitedLock) Lock(breaker Breaker) error {
+	return sem.Acquire(breaker, sem.Limit())
+}
+
+// Unlock releases all permits of the semaphore.
+func (sem *DistributedLimitedLock) Unlock(Breaker) error {
+	_, err := sem.Release(sem.Limit())
+	return err
+}
+
+// Acquire takes the number of permits. If they are in use,
+// the calling goroutine blocks until they are available or
+// an error occurred, e.g. if the Breaker is done or the storage
+// is unavailable.
+func (sem *DistributedLimitedLock) Acquire(breaker Breaker, slot uint32) error {
+	if sem.backend == nil {
+		return CriticalIssue
+	}
+	if slot == 0 {
+		return InvalidIntent
+	}
+	token, err := sem.holder()
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-breaker.Done():
+			return Interrupted
+		default:
+		}
+
+		start := time.Now()
+		acquired, err := sem.backend.Acquire(sem.key, token, slot, sem.capacity, sem.ttl)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			sem.hold(start, slot)
+			return nil
+		}
+
+		timer := time.NewTimer(sem.retry)
+		select {
+		case <-breaker.Done():
+			timer.Stop()
+			return Interrupted
+		case <-timer.C:
+		}
+	}
+}
+
+// TryAcquire is a fail-fast version of the Acquire method.
+// It returns true if permits are taken or false otherwise.
+func (sem *DistributedLimitedLock) TryAcquire(slot uint32) bool {
+	if sem.backend == nil || slot == 0 {
+		return false
+	}
+	token, err := sem.holder()
+	if err != nil {
+		return false
+	}
+	start := time.Now()
+	acquired, err := sem.backend.Acquire(sem.key, token, slot, sem.capacity, sem.ttl)
+	if err != nil || !acquired {
+		return false
+	}
+	sem.hold(start, slot)
+	return true
+}
+
+// Release returns the number of permits and the total number
+// of permits held before the release. It returns InvalidIntent
+// if the process doesn't hold enough permits.
+func (sem *DistributedLimitedLock) Release(slot uint32) (uint32, error) {
+	if sem.backend == nil {
+		return 0, CriticalIssue
+	}
+	if slot == 0 {
+		return sem.Count(), nil
+	}
+	sem.mu.Lock()
+	defer sem.mu.Unlock()
+	sem.check()
+	if sem.held < slot {
+		return sem.Count(), InvalidIntent
+	}
+	count, err := sem.backend.Release(sem.key, sem.token, slot)
+	if err == InvalidIntent {
+		// the lease has expired, so permits are already lost
+		sem.drop()
+	}
+	if err != nil {
+		return count, err
+	}
+	if sem.held -= slot; sem.held == 0 {
+		sem.drop()
+	}
+	return count, nil
+}
+
+// Count returns the number of permits held by all processes.
+// It returns zero if the storage is unavailable.
+func (sem *DistributedLimitedLock) Count() uint32 {
+	if sem.backend == nil {
+		return 0
+	}
+	count, _, err := sem.backend.State(sem.key, sem.capacity)
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// Limit returns the capacity of the semaphore shared by all processes.
+// It returns the local capacity if the storage is unavailable.
+func (sem *DistributedLimitedLock) Limit() uint32 {
+	if sem.backend == nil {
+		return sem.capacity
+	}
+	_, limit, err := sem.backend.State(sem.key, sem.capacity)
+	if err != nil {
+		return sem.capacity
+	}
+	return limit
+}
+
+// SetCapacity changes the capacity of the semaphore for all processes
+// and returns the previous one.
+func (sem *DistributedLimitedLock) SetCapacity(capacity uint32) uint32 {
+	if capacity == 0 || sem.backend == nil {
+		return sem.Limit()
+	}
+	limit, err := sem.backend.Resize(sem.key, sem.capacity, capacity)
+	if err != nil {
+		return sem.Limit()
+	}
+	return limit
+}
+
+// holder returns the token of the process in the semaphore.
+func (sem *DistributedLimitedLock) holder() (string, error) {
+	sem.mu.Lock()
+	defer sem.mu.Unlock()
+	if sem.token == "" {
+		token, err := newToken()
+		if err != nil {
+			return "", err
+		}
+		sem.token = token
+	}
+	return sem.token, nil
+}
+
+// hold counts permits taken by the request sent at the start
+// and starts their renewal.
+func (sem *DistributedLimitedLock) hold(start time.Time, slot uint32) {
+	sem.mu.Lock()
+	defer sem.mu.Unlock()
+	sem.check()
+	sem.held += slot
+	if sem.session == nil {
+		token := sem.token
+		sem.session = newSession("", token, 0)
+		go sem.session.keepAlive(expiry(start, sem.ttl), sem.refresh, func() (time.Time, error) {
+			start := time.Now()
+			err := sem.backend.Refresh(sem.key, token, sem.ttl)
+			return expiry(start, sem.ttl), err
+		})
+	}
+}
+
+// check forgets held permits if their lease has expired.
+func (sem *DistributedLimitedLock) check() {
+	if sem.session == nil {
+		return
+	}
+	select {
+	case <-sem.session.Done():
+		sem.drop()
+	default:
+	}
+}
+
+// drop forgets held permits and stops their renewal.
+func (sem *DistributedLimitedLock) drop() {
+	sem.held = 0
+	if session := sem.session; session != nil {
+		sem.session = nil
+		session.end()
+	}
+}
@@ -0,0 +1,178 @@
+package locker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+	"github.com/kamilsk/locker/internal/redis"
+)
+
+func TestDistributedLimited(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	server, err := redis.NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer server.Close()
+
+	nodes, _, stop := raftGroup(t, 3)
+	defer stop()
+
+	backends := map[string]SemaphoreBackend{
+		"memory": MemorySemaphoreBackend(),
+		"raft":   RaftBackend(nodes[0]).Semaphore(),
+		"redis":  RedisSemaphoreBackend(server.Addr()),
+	}
+	for name, backend := range backends {
+		t.Run(name+" permits", func(t *testing.T) {
+			options := []DistributedLimitedOption{
+				DistributedLimitedWithKey(t.Name()),
+				DistributedLimitedWithBackend(backend),
+				DistributedLimitedWithRetry(time.Millisecond),
+			}
+			first, second := DistributedLimited(3, time.Minute, options...), DistributedLimited(3, time.Minute, options...)
+
+			if err := first.Acquire(ctx, 2); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if second.TryAcquire(2) {
+				t.Error("the semaphore must be full")
+				t.FailNow()
+			}
+			if !second.TryAcquire(1) {
+				t.Error("the permit must be available")
+				t.FailNow()
+			}
+			if count, limit := second.Count(), second.Limit(); count != 3 || limit != 3 {
+				t.Errorf("unexpected state %d/%d", count, limit)
+				t.FailNow()
+			}
+			if err := second.Acquire(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond)), 1); err != Interrupted {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+			if _, err := second.Release(2); err != InvalidIntent {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+			if count, err := first.Release(2); err != nil || count != 3 {
+				t.Error("unexpected result")
+				t.FailNow()
+			}
+			if err := second.Acquire(ctx, 2); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+
+			if prev := first.SetCapacity(5); prev != 3 {
+				t.Error("unexpected previous capacity")
+				t.FailNow()
+			}
+			if second.Limit() != 5 {
+				t.Error("the capacity must be shared")
+				t.FailNow()
+			}
+			if !first.TryAcquire(2) {
+				t.Error("the resized semaphore must have permits")
+				t.FailNow()
+			}
+			if _, err := first.Release(2); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if _, err := second.Release(3); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if second.Count() != 0 {
+				t.Error("the semaphore must be empty")
+				t.FailNow()
+			}
+		})
+
+		t.Run(name+" crashed holder", func(t *testing.T) {
+			crashed := DistributedLimited(1, 10*time.Millisecond,
+				DistributedLimitedWithKey(t.Name()),
+				DistributedLimitedWithBackend(backend),
+				DistributedLimitedWithRefresh(0),
+			)
+			alive := DistributedLimited(1, time.Minute,
+				DistributedLimitedWithKey(t.Name()),
+				DistributedLimitedWithBackend(backend),
+				DistributedLimitedWithRetry(time.Millisecond),
+			)
+			if err := crashed.Lock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := alive.Lock(ctx); err != nil {
+				t.Error("the permit must be returned after the ttl")
+				t.FailNow()
+			}
+			if err := crashed.Unlock(ctx); err != InvalidIntent {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+			if err := alive.Unlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		})
+
+		t.Run(name+" renewal", func(t *testing.T) {
+			holder := DistributedLimited(1, 30*time.Millisecond,
+				DistributedLimitedWithKey(t.Name()),
+				DistributedLimitedWithBackend(backend),
+				DistributedLimitedWithRefresh(5*time.Millisecond),
+			)
+			if !holder.TryAcquire(1) {
+				t.Error("the permit must be available")
+				t.FailNow()
+			}
+			time.Sleep(60 * time.Millisecond)
+			if DistributedLimited(1, time.Minute, DistributedLimitedWithKey(t.Name()), DistributedLimitedWithBackend(backend)).TryAcquire(1) {
+				t.Error("the permit must be renewed")
+				t.FailNow()
+			}
+			if _, err := holder.Release(1); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("without backend", func(t *testing.T) {
+		sem := DistributedLimited(1, time.Minute)
+		if err := sem.Acquire(ctx, 1); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if _, err := sem.Release(1); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+
+	t.Run("interfaces", func(t *testing.T) {
+		var sem interface{} = DistributedLimited(1, time.Minute)
+		if _, is := sem.(FastSemaphore); !is {
+			t.Error("the semaphore must be a FastSemaphore")
+		}
+		if _, is := sem.(Observable); !is {
+			t.Error("the semaphore must be Observable")
+		}
+		if _, is := sem.(Resizable); !is {
+			t.Error("the semaphore must be Resizable")
+		}
+		if _, is := sem.(Locker); !is {
+			t.Error("the semaphore must be a Locker")
+		}
+	})
+}
@@ -0,0 +1,505 @@
+package locker_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+	"github.com/kamilsk/locker/internal/etcd"
+	"github.com/kamilsk/locker/internal/redis"
+)
+
+func TestDistributed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	t.Run("without storage", func(t *testing.T) {
+		lock := Distributed(time.Second)
+		if err := lock.Lock(ctx); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+}
+
+func TestDistributedWithRedis(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	server, err := redis.NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer server.Close()
+
+	options := []DistributedOption{
+		DistributedWithKey(t.Name()),
+		DistributedWithRedis(server.Addr()),
+		DistributedWithRetry(time.Millisecond),
+	}
+
+	t.Run("lock and unlock", func(t *testing.T) {
+		first, second := Distributed(time.Minute, options...), Distributed(time.Minute, options...)
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := first.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("wait for release", func(t *testing.T) {
+		first, second := Distributed(time.Minute, options...), Distributed(time.Minute, options...)
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			_ = first.Unlock(ctx)
+		}()
+		if err := second.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("expired lock", func(t *testing.T) {
+		first, second := Distributed(5*time.Millisecond, append(options, DistributedWithRefresh(0))...), Distributed(time.Minute, options...)
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := first.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("unavailable storage", func(t *testing.T) {
+		lock := Distributed(time.Minute, DistributedWithRedis("127.0.0.1:1"))
+		if err := lock.Lock(ctx); err == nil {
+			t.Error("error is expected")
+			t.FailNow()
+		}
+	})
+}
+
+func TestDistributedWithEtcd(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	server := httptest.NewServer(etcd.NewServer())
+	defer server.Close()
+
+	key := t.Name()
+	options := []DistributedOption{
+		DistributedWithKey(key),
+		DistributedWithEtcd(server.URL),
+	}
+
+	t.Run("lock and unlock", func(t *testing.T) {
+		first, second := Distributed(time.Minute, options...), Distributed(time.Minute, options...)
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := first.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("fifo order", func(t *testing.T) {
+		owner := Distributed(time.Minute, options...)
+		if err := owner.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+
+		const size = 5
+		client := etcd.New(server.URL, nil)
+		order := make(chan int, size)
+		for i := 0; i < size; i++ {
+			lock := Distributed(time.Minute, options...)
+			go func(i int) {
+				if err := lock.Lock(ctx); err != nil {
+					order <- -1
+					return
+				}
+				order <- i
+				_ = lock.Unlock(ctx)
+			}(i)
+			// let the goroutine take its place in the queue,
+			// the range covers all keys with the "key/" prefix
+			for {
+				queue, err := client.Range(ctx, etcd.RangeRequest{Key: []byte(key + "/"), RangeEnd: []byte(key + "0")})
+				if err != nil {
+					t.Error("unexpected error")
+					t.FailNow()
+				}
+				if int(queue.Count) == i+2 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		if err := owner.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		for i := 0; i < size; i++ {
+			if actual := <-order; actual != i {
+				t.Errorf("unexpected order: %d instead of %d", actual, i)
+				t.FailNow()
+			}
+		}
+	})
+
+	t.Run("interrupted waiter leaves the queue", func(t *testing.T) {
+		first, second, third := Distributed(time.Minute, options...), Distributed(time.Minute, options...), Distributed(time.Minute, options...)
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		done := make(chan error, 1)
+		go func() { done <- third.Lock(ctx) }()
+		time.Sleep(10 * time.Millisecond)
+		if err := first.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := <-done; err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := third.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("nested lock", func(t *testing.T) {
+		backend, another := EtcdBackend(server.URL), EtcdBackend(server.URL)
+		parent, nested := t.Name(), t.Name()+"/child"
+		if _, acquired, err := another.Acquire(nested, "nested", time.Minute); err != nil || !acquired {
+			t.Error("the nested lock must be acquired")
+			t.FailNow()
+		}
+		if lease, err := backend.Inspect(parent); err != nil || lease.Held() {
+			t.Errorf("the parent lock must be free, but got %+v", lease)
+			t.FailNow()
+		}
+		if _, acquired, err := backend.Acquire(parent, "parent", time.Minute); err != nil || !acquired {
+			t.Error("the parent lock must be acquired")
+			t.FailNow()
+		}
+		if lease, err := backend.Inspect(nested); err != nil || lease.Token != "nested" {
+			t.Errorf("unexpected lease %+v", lease)
+			t.FailNow()
+		}
+		if err := backend.Release(parent, "nested"); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := backend.Release(parent, "parent"); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := another.Release(nested, "nested"); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("unlock after the lease expired", func(t *testing.T) {
+		// the leases are granted in whole seconds
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		lock := Distributed(time.Second, append(options, DistributedWithKey(t.Name()), DistributedWithRefresh(0))...)
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		select {
+		case <-lock.Lost().Done():
+		case <-ctx.Done():
+			t.Error("the lock must be lost after the ttl")
+			t.FailNow()
+		}
+		// the gateway answers with the NotFound status on the revoke of the expired lease
+		time.Sleep(50 * time.Millisecond)
+		if err := lock.Unlock(ctx); err != InvalidIntent {
+			t.Errorf("unexpected error %v", err)
+			t.FailNow()
+		}
+		if err := lock.Lock(breaker.BreakByContext(context.WithTimeout(ctx, time.Second))); err != nil {
+			t.Error("the lock must be taken again")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("fractional ttl", func(t *testing.T) {
+		backend := EtcdBackend(server.URL)
+		if _, _, err := backend.Acquire(t.Name(), "token", 1500*time.Millisecond); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if _, _, err := backend.Acquire(t.Name(), "token", 500*time.Millisecond); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+}
+
+func TestDistributed_Lost(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	t.Run("not held", func(t *testing.T) {
+		lock := Distributed(time.Minute, DistributedWithBackend(MemoryBackend()))
+		select {
+		case <-lock.Lost().Done():
+		default:
+			t.Error("the breaker must be done")
+			t.FailNow()
+		}
+	})
+
+	t.Run("keep alive", func(t *testing.T) {
+		backend := MemoryBackend()
+		first := Distributed(50*time.Millisecond, DistributedWithBackend(backend))
+		second := Distributed(50*time.Millisecond, DistributedWithBackend(backend))
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		lost := first.Lost()
+		if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 150*time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		select {
+		case <-lost.Done():
+			t.Error("the lock must not be lost")
+			t.FailNow()
+		default:
+		}
+		if err := first.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		select {
+		case <-lost.Done():
+		default:
+			t.Error("the breaker must be done after unlock")
+			t.FailNow()
+		}
+	})
+
+	t.Run("without renewal", func(t *testing.T) {
+		lock := Distributed(10*time.Millisecond, DistributedWithBackend(MemoryBackend()), DistributedWithRefresh(0))
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		select {
+		case <-lock.Lost().Done():
+		case <-ctx.Done():
+			t.Error("the lock must be lost after the ttl")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+
+	t.Run("rejected renewal", func(t *testing.T) {
+		backend := &faulty{Backend: MemoryBackend()}
+		lock := Distributed(time.Minute, DistributedWithBackend(backend), DistributedWithRefresh(time.Millisecond))
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		backend.fail(InvalidIntent)
+		select {
+		case <-lock.Lost().Done():
+		case <-ctx.Done():
+			t.Error("the lock must be lost after the rejected renewal")
+			t.FailNow()
+		}
+	})
+
+	t.Run("unavailable storage", func(t *testing.T) {
+		backend := &faulty{Backend: MemoryBackend()}
+		lock := Distributed(20*time.Millisecond, DistributedWithBackend(backend), DistributedWithRefresh(time.Millisecond))
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		backend.fail(CriticalIssue)
+		start := time.Now()
+		select {
+		case <-lock.Lost().Done():
+		case <-ctx.Done():
+			t.Error("the lock must be lost after the ttl")
+			t.FailNow()
+		}
+		if time.Since(start) < 10*time.Millisecond {
+			t.Error("the lock must be kept while the ttl is not expired")
+			t.FailNow()
+		}
+	})
+
+	t.Run("slow storage", func(t *testing.T) {
+		const ttl = 150 * time.Millisecond
+		backend := &slow{Backend: MemoryBackend(), delay: 100 * time.Millisecond}
+		lock := Distributed(ttl, DistributedWithBackend(backend), DistributedWithRefresh(0))
+		start := time.Now()
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		select {
+		case <-lock.Lost().Done():
+		case <-ctx.Done():
+			t.Error("the lock must be lost after the ttl")
+			t.FailNow()
+		}
+		// the lease is taken by the storage before the reply
+		if elapsed := time.Since(start); elapsed > ttl {
+			t.Errorf("the lock is lost after %v, but its lease has expired after %v", elapsed, ttl)
+			t.FailNow()
+		}
+	})
+
+	t.Run("late unlock", func(t *testing.T) {
+		lock := Distributed(10*time.Millisecond, DistributedWithBackend(MemoryBackend()), DistributedWithRefresh(0))
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		<-lock.Lost().Done()
+
+		relocked := make(chan error, 1)
+		go func() { relocked <- lock.Lock(ctx) }()
+		select {
+		case <-relocked:
+			t.Error("the lock must wait for the unlock of the lost session")
+			t.FailNow()
+		case <-time.After(20 * time.Millisecond):
+		}
+		if err := lock.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := <-relocked; err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("the late unlock must not release the next session")
+			t.FailNow()
+		}
+	})
+}
+
+type faulty struct {
+	Backend
+	mu  sync.Mutex
+	err error
+}
+
+func (backend *faulty) Refresh(key, token string, ttl time.Duration) error {
+	backend.mu.Lock()
+	err := backend.err
+	backend.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return backend.Backend.Refresh(key, token, ttl)
+}
+
+func (backend *faulty) fail(err error) {
+	backend.mu.Lock()
+	backend.err = err
+	backend.mu.Unlock()
+}
+
+type slow struct {
+	Backend
+	delay time.Duration
+}
+
+// Acquire delays the reply of the storage like a slow network does.
+func (backend *slow) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	fence, acquired, err := backend.Backend.Acquire(key, token, ttl)
+	time.Sleep(backend.delay)
+	return fence, acquired, err
+}
@@ -0,0 +1,118 @@
+package locker
+
+import "time"
+
+// Election returns a new participant of the leader election
+// identified by the id. The election is based on the Distributed lock
+// configured by the options, so its holder is the leader and the ttl
+// limits the time of the leadership of a crashed participant.
+//
+//  election := locker.Election(hostname, time.Minute,
+//  	locker.DistributedWithKey("jobs:leader"),
+//  	locker.DistributedWithRedis("127.0.0.1:6379"),
+//  )
+//
+//  for {
+//  	if err := election.Campaign(ctx); err != nil {
+//  		return err
+//  	}
+//  	// only one replica runs jobs one moment in time
+//  	runJobs(election.Lost())
+//  }
+//
+func Election(id string, ttl time.Duration, options ...DistributedOption) *Participant {
+	lock := Distributed(ttl, options...)
+	lock.owner = id
+	return &Participant{id: id, lock: lock}
+}
+
+// A Participant is a member of the leader election, see Election.
+type Participant struct {
+	id   string
+	lock *DistributedLock
+}
+
+// Campaign blocks until the participant becomes the leader or
+// an error occurred, e.g. if the Breaker is done or the storage
+// is unavailable. It returns immediately if the participant
+// is already the leader. The lost leadership is dropped first,
+// so the participant can campaign again after the Lost is done.
+func (election *Participant) Campaign(breaker Breaker) error {
+	if election.Leading() {
+		return nil
+	}
+	if err := election.lock.Unlock(breaker); err != nil && err != InvalidIntent {
+		return err
+	}
+	return election.lock.Lock(breaker)
+}
+
+// Resign gives up the leadership, so another participant can take it.
+// It returns InvalidIntent if the participant is not the leader.
+func (election *Participant) Resign(breaker Breaker) error {
+	return election.lock.Unlock(breaker)
+}
+
+// Leading returns true if the participant is the leader.
+func (election *Participant) Leading() bool {
+	select {
+	case <-election.lock.Lost().Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// Lost returns a Breaker that is done when the participant
+// is no longer the leader.
+func (election *Participant) Lost() Breaker {
+	return election.lock.Lost()
+}
+
+// Leader returns the id of the current leader or an empty string
+// if there is no leader at the moment.
+func (election *Participant) Leader() (string, error) {
+	if election.lock.backend == nil {
+		return "", CriticalIssue
+	}
+	lease, err := election.lock.backend.Inspect(election.lock.key)
+	if err != nil || !lease.Held() {
+		return "", err
+	}
+	return ownerOf(lease.Token), nil
+}
+
+// Observe returns a channel of ids of the leader. It receives
+// the current leader at once and then each change of the leadership,
+// the empty string means there is no leader. The channel is closed
+// when the Breaker is done. The storage is polled with the retry
+// interval of the lock, its temporary failures are skipped.
+func (election *Participant) Observe(breaker Breaker) <-chan string {
+	changes := make(chan string, 1)
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(election.lock.retry)
+		defer ticker.Stop()
+		var (
+			last    string
+			started bool
+		)
+		for {
+			if leader, err := election.Leader(); err == nil && (!started || leader != last) {
+				select {
+				case changes <- leader:
+					last, started = leader, true
+				case <-breaker.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-breaker.Done():
+				return
+			}
+		}
+	}()
+	return changes
+}
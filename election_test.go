@@ -0,0 +1,183 @@
+package locker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+	"github.com/kamilsk/locker/internal/memcache"
+)
+
+func TestElection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	server, err := memcache.NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer server.Close()
+
+	backends := map[string]Backend{
+		"memcache": MemcacheBackend(server.Addr()),
+		"memory":   MemoryBackend(),
+	}
+	for name, backend := range backends {
+		options := func(t *testing.T) []DistributedOption {
+			return []DistributedOption{
+				DistributedWithKey(t.Name()),
+				DistributedWithBackend(backend),
+				DistributedWithRetry(time.Millisecond),
+			}
+		}
+
+		t.Run(name+" campaign and resign", func(t *testing.T) {
+			first := Election("10.0.0.1:8080", time.Minute, options(t)...)
+			second := Election("replica #2", time.Minute, options(t)...)
+
+			if leader, err := second.Leader(); err != nil || leader != "" {
+				t.Error("there must be no leader")
+				t.FailNow()
+			}
+			changes := second.Observe(ctx)
+			if leader := <-changes; leader != "" {
+				t.Error("there must be no leader")
+				t.FailNow()
+			}
+
+			if err := first.Campaign(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := first.Campaign(ctx); err != nil || !first.Leading() {
+				t.Error("the leader must stay the leader")
+				t.FailNow()
+			}
+			if err := second.Campaign(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+			if second.Leading() {
+				t.Error("there must be only one leader")
+				t.FailNow()
+			}
+			if leader, err := second.Leader(); err != nil || leader != "10.0.0.1:8080" {
+				t.Errorf("unexpected leader %q", leader)
+				t.FailNow()
+			}
+			if leader := <-changes; leader != "10.0.0.1:8080" {
+				t.Errorf("unexpected leader %q", leader)
+				t.FailNow()
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- second.Campaign(ctx) }()
+			if err := first.Resign(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			select {
+			case <-first.Lost().Done():
+			default:
+				t.Error("the leadership must be lost")
+				t.FailNow()
+			}
+			if err := <-done; err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			for leader := range changes {
+				if leader == "replica #2" {
+					break
+				}
+				if leader != "" {
+					t.Errorf("unexpected leader %q", leader)
+					t.FailNow()
+				}
+			}
+			if err := second.Resign(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := second.Resign(ctx); err != InvalidIntent {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+		})
+
+		t.Run(name+" crashed leader", func(t *testing.T) {
+			crashed := Election("crashed", 20*time.Millisecond, append(options(t), DistributedWithRefresh(0))...)
+			alive := Election("alive", time.Minute, options(t)...)
+			if err := crashed.Campaign(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := alive.Campaign(ctx); err != nil {
+				t.Error("the leadership must be taken after the ttl")
+				t.FailNow()
+			}
+			select {
+			case <-crashed.Lost().Done():
+			case <-ctx.Done():
+				t.Error("the leadership must be lost")
+				t.FailNow()
+			}
+			if leader, err := crashed.Leader(); err != nil || leader != "alive" {
+				t.Errorf("unexpected leader %q", leader)
+				t.FailNow()
+			}
+			if err := alive.Resign(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		})
+
+		t.Run(name+" campaign after the lost leadership", func(t *testing.T) {
+			election := Election("candidate", 20*time.Millisecond, append(options(t), DistributedWithRefresh(0))...)
+			for round := 0; round < 2; round++ {
+				if err := election.Campaign(breaker.BreakByContext(context.WithTimeout(ctx, time.Second))); err != nil {
+					t.Errorf("unexpected error %v in the round %d", err, round)
+					t.FailNow()
+				}
+				if !election.Leading() {
+					t.Error("the participant must be the leader")
+					t.FailNow()
+				}
+				select {
+				case <-election.Lost().Done():
+				case <-ctx.Done():
+					t.Error("the leadership must be lost")
+					t.FailNow()
+				}
+			}
+			if err := election.Resign(ctx); err != InvalidIntent {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("observe until done", func(t *testing.T) {
+		breaker, cancel := context.WithCancel(ctx)
+		changes := Election("observer", time.Minute, DistributedWithBackend(MemoryBackend())).Observe(breaker)
+		<-changes
+		cancel()
+		for range changes {
+		}
+	})
+
+	t.Run("without storage", func(t *testing.T) {
+		election := Election("candidate", time.Minute)
+		if err := election.Campaign(ctx); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if _, err := election.Leader(); err != CriticalIssue {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+}
@@ -16,3 +16,9 @@ const Interrupted Error = "operation interrupted"
 
 // InvalidIntent is the error related to a bad method call.
 const InvalidIntent Error = "invalid intent"
+
+// StaleFence is the error related to a write by a previous owner of a lock.
+const StaleFence Error = "stale fencing token"
+
+// NotOwner is the error related to a release of a lock held by someone else.
+const NotOwner Error = "lock is held by another owner"
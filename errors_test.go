@@ -19,4 +19,12 @@ func TestErrors(t *testing.T) {
 		t.Error("unexpected string representation of the error")
 		t.FailNow()
 	}
+	if StaleFence.Error() != "stale fencing token" {
+		t.Error("unexpected string representation of the error")
+		t.FailNow()
+	}
+	if NotOwner.Error() != "lock is held by another owner" {
+		t.Error("unexpected string representation of the error")
+		t.FailNow()
+	}
 }
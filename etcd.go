@@ -0,0 +1,367 @@
+package locker
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamilsk/locker/internal"
+	"github.com/kamilsk/locker/internal/etcd"
+)
+
+// DistributedWithEtcd sets up the etcd cluster by the endpoint of its
+// v3 JSON gateway as a storage of the lock state.
+//
+//  lock := locker.Distributed(time.Minute, locker.DistributedWithEtcd("http://127.0.0.1:2379"))
+//
+func DistributedWithEtcd(endpoint string) DistributedOption {
+	return DistributedWithBackend(EtcdBackend(endpoint))
+}
+
+// EtcdBackend returns a new storage of the distributed lock state
+// based on the etcd cluster by the endpoint of its v3 JSON gateway.
+//
+// Each attempt to take the lock creates a lease based on the ttl
+// and puts a key under the lock prefix. The lock is granted to the key
+// with the lowest revision, so processes take it in the FIFO order.
+// The leases are granted in whole seconds, so Acquire returns
+// InvalidIntent if the ttl is not a whole number of seconds
+// instead of holding the lock longer than it was asked.
+func EtcdBackend(endpoint string) *EtcdStorage {
+	return &EtcdStorage{
+		client:   etcd.New(endpoint, &http.Client{}),
+		timeout:  time.Second,
+		sessions: make(map[string]*esession),
+	}
+}
+
+// An EtcdStorage keeps the distributed lock state in etcd, see EtcdBackend.
+type EtcdStorage struct {
+	client  *etcd.Client
+	timeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*esession
+}
+
+// esession is a place of the token in the lock queue.
+type esession struct {
+	lease    int64
+	key      []byte
+	revision int64
+	ttl      time.Duration
+	prev     []byte
+}
+
+// Acquire puts the token into the lock queue by the key
+// and returns true if it is the first one. The revision
+// of its key is used as the fencing token.
+func (backend *EtcdStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	if ttl < time.Second || ttl%time.Second != 0 {
+		return 0, false, InvalidIntent
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	session, err := backend.enqueue(ctx, key, token, ttl)
+	if err != nil {
+		return 0, false, err
+	}
+
+	queue, err := backend.queue(ctx, key)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(queue) > 0 && string(queue[0].Key) == string(session.key) {
+		return uint64(queue[0].CreateRevision), true, nil
+	}
+
+	// the previous key is the last one created before the token
+	var prev []byte
+	for _, kv := range queue {
+		if int64(kv.CreateRevision) >= session.revision {
+			break
+		}
+		prev = kv.Key
+	}
+	backend.mu.Lock()
+	session.prev = prev
+	backend.mu.Unlock()
+	return 0, false, nil
+}
+
+// Release removes the token from the lock queue by the key.
+func (backend *EtcdStorage) Release(key, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	backend.mu.Lock()
+	session, found := backend.sessions[token]
+	delete(backend.sessions, token)
+	backend.mu.Unlock()
+
+	var lease int64
+	var target []byte
+	if found {
+		lease, target = session.lease, session.key
+	} else {
+		kv, err := backend.find(ctx, key, token)
+		if err != nil {
+			return err
+		}
+		if kv == nil {
+			return InvalidIntent
+		}
+		lease, target = int64(kv.Lease), kv.Key
+	}
+
+	deleted, err := backend.client.Delete(ctx, target)
+	if err != nil {
+		return err
+	}
+	if err := backend.client.Revoke(ctx, lease); err != nil {
+		if err == etcd.LeaseNotFound {
+			// the lease has expired, so the lock is already lost
+			return InvalidIntent
+		}
+		return err
+	}
+	if deleted != 1 {
+		return InvalidIntent
+	}
+	return nil
+}
+
+// Refresh renews the lease of the token in the lock queue by the key.
+// The lease ttl is defined on the first attempt to take the lock,
+// so the ttl is used only by the lease found not by the session.
+func (backend *EtcdStorage) Refresh(key, token string, _ time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	backend.mu.Lock()
+	session, found := backend.sessions[token]
+	backend.mu.Unlock()
+
+	var lease int64
+	if found {
+		lease = session.lease
+	} else {
+		kv, err := backend.find(ctx, key, token)
+		if err != nil {
+			return err
+		}
+		if kv == nil {
+			return InvalidIntent
+		}
+		lease = int64(kv.Lease)
+	}
+
+	alive, err := backend.client.KeepAlive(ctx, lease)
+	if err != nil {
+		return err
+	}
+	if alive <= 0 {
+		return InvalidIntent
+	}
+	return nil
+}
+
+// Inspect returns the first token in the lock queue by the key.
+func (backend *EtcdStorage) Inspect(key string) (Lease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	queue, err := backend.queue(ctx, key)
+	if err != nil || len(queue) == 0 {
+		return Lease{Key: key}, err
+	}
+	owner := queue[0]
+	ttl, err := backend.client.TimeToLive(ctx, int64(owner.Lease))
+	if err != nil {
+		return Lease{Key: key}, err
+	}
+	if ttl < 0 {
+		return Lease{Key: key}, nil
+	}
+	return Lease{
+		Key:   key,
+		Token: string(owner.Value),
+		TTL:   time.Duration(ttl) * time.Second,
+		Fence: uint64(owner.CreateRevision),
+	}, nil
+}
+
+// List returns the keys of the locks with the prefix
+// which have a non-empty queue.
+func (backend *EtcdStorage) List(prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	request := etcd.RangeRequest{Key: []byte(prefix), RangeEnd: prefixEnd([]byte(prefix))}
+	if prefix == "" {
+		// the whole keyspace
+		request.Key, request.RangeEnd = []byte{0}, []byte{0}
+	}
+	response, err := backend.client.Range(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(response.Kvs))
+	seen := make(map[string]bool, len(response.Kvs))
+	for _, kv := range response.Kvs {
+		i := bytes.LastIndexByte(kv.Key, '/')
+		if i < 0 {
+			continue
+		}
+		if key := string(kv.Key[:i]); !seen[key] && strings.HasPrefix(key, prefix) {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Wait blocks until the previous key in the lock queue is deleted.
+// It returns periodically to let the caller renew its place.
+func (backend *EtcdStorage) Wait(breaker Breaker, _, token string) error {
+	backend.mu.Lock()
+	session, found := backend.sessions[token]
+	var (
+		prev     []byte
+		revision int64
+		ttl      time.Duration
+	)
+	if found {
+		prev, revision, ttl = session.prev, session.revision, session.ttl
+	}
+	backend.mu.Unlock()
+	if prev == nil {
+		return nil
+	}
+
+	ctx, cancel := internal.Context(breaker)
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, ttl/3)
+	defer cancel()
+
+	err := backend.client.WaitDelete(ctx, prev, revision)
+	select {
+	case <-breaker.Done():
+		return Interrupted
+	default:
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// enqueue puts the key of the token into the lock queue
+// or renews its lease if it is already there.
+func (backend *EtcdStorage) enqueue(ctx context.Context, key, token string, ttl time.Duration) (*esession, error) {
+	backend.mu.Lock()
+	session, found := backend.sessions[token]
+	backend.mu.Unlock()
+
+	if found {
+		alive, err := backend.client.KeepAlive(ctx, session.lease)
+		if err != nil {
+			return nil, err
+		}
+		if alive > 0 {
+			return session, nil
+		}
+		// the lease has expired, so the place in the queue is lost
+	}
+
+	lease, err := backend.client.Grant(ctx, seconds(ttl))
+	if err != nil {
+		return nil, err
+	}
+	session = &esession{lease: lease, key: []byte(key + "/" + strconv.FormatInt(lease, 16)), ttl: ttl}
+	response, err := backend.client.Txn(ctx, etcd.TxnRequest{
+		Compare: []etcd.Compare{{Key: session.key, Target: "CREATE", CreateRevision: 0}},
+		Success: []etcd.Op{{RequestPut: &etcd.PutRequest{Key: session.key, Value: []byte(token), Lease: etcd.Int64(lease)}}},
+		Failure: []etcd.Op{{RequestRange: &etcd.RangeRequest{Key: session.key}}},
+	})
+	if err != nil {
+		_ = backend.client.Revoke(ctx, lease)
+		return nil, err
+	}
+	session.revision = int64(response.Header.Revision)
+	if !response.Succeeded && len(response.Responses) > 0 && response.Responses[0].ResponseRange != nil {
+		if kvs := response.Responses[0].ResponseRange.Kvs; len(kvs) > 0 {
+			session.revision = int64(kvs[0].CreateRevision)
+		}
+	}
+
+	backend.mu.Lock()
+	backend.sessions[token] = session
+	backend.mu.Unlock()
+	return session, nil
+}
+
+// queue returns the keys in the lock queue ordered by their creation.
+// The range by the prefix also covers the queues of nested locks,
+// e.g. "a/b/1f" of the lock "a/b" for the lock "a", so the keys
+// with more than one segment after the prefix are skipped.
+func (backend *EtcdStorage) queue(ctx context.Context, key string) ([]etcd.KeyValue, error) {
+	prefix := []byte(key + "/")
+	response, err := backend.client.Range(ctx, etcd.RangeRequest{
+		Key:        prefix,
+		RangeEnd:   prefixEnd(prefix),
+		SortOrder:  "ASCEND",
+		SortTarget: "CREATE",
+	})
+	if err != nil {
+		return nil, err
+	}
+	queue := response.Kvs[:0]
+	for _, kv := range response.Kvs {
+		if bytes.IndexByte(kv.Key[len(prefix):], '/') < 0 {
+			queue = append(queue, kv)
+		}
+	}
+	return queue, nil
+}
+
+// find returns the key of the token in the lock queue.
+// It is used if the token belongs to another process.
+func (backend *EtcdStorage) find(ctx context.Context, key, token string) (*etcd.KeyValue, error) {
+	queue, err := backend.queue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for i := range queue {
+		if string(queue[i].Value) == token {
+			return &queue[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func seconds(ttl time.Duration) int64 {
+	s := int64((ttl + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
@@ -0,0 +1,142 @@
+package locker
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Fair returns a new instance of safe interruptible mutex
+// which grants the lock strictly in order of arrival, so none
+// of the waiters can be starved under heavy contention.
+// It is slower than the Interruptible, so use it only if
+// the order matters.
+//
+//  lock := locker.Fair()
+//
+//  var handler http.HandlerFunc = func(rw http.ResponseWriter, req *http.Request) {
+//  	if err := lock.Lock(req.Context()); err != nil {
+//  		http.Error(rw, http.StatusText(http.StatusRequestTimeout), http.StatusRequestTimeout)
+//  		return
+//  	}
+//  	defer lock.MustUnlock()
+//  	// critical section with lock protection
+//  	// requests are served in the order of their arrival
+//  }
+//
+func Fair() *FairLock {
+	return &FairLock{queue: list.New()}
+}
+
+// A FairLock is the mutex granting the lock in order of arrival, see Fair.
+type FairLock struct {
+	mu     sync.Mutex
+	holder *Holder
+	queue  *list.List
+}
+
+// qwaiter is a goroutine waiting for the mutex.
+type qwaiter struct {
+	id    string
+	ready chan struct{}
+}
+
+// Lock takes an exclusive lock. If the lock is already in use,
+// the calling goroutine is queued and blocks until the mutex
+// is passed to it or an error occurred, e.g. if the Breaker is done.
+// In the last case, the goroutine leaves the queue.
+func (lock *FairLock) Lock(breaker Breaker) error {
+	id := identify(breaker)
+	lock.mu.Lock()
+	if lock.holder == nil && lock.queue.Len() == 0 {
+		lock.holder = &Holder{ID: id, Since: time.Now()}
+		lock.mu.Unlock()
+		return nil
+	}
+	waiter := &qwaiter{id: id, ready: make(chan struct{})}
+	element := lock.queue.PushBack(waiter)
+	lock.mu.Unlock()
+
+	select {
+	case <-breaker.Done():
+	case <-waiter.ready:
+		return nil
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	select {
+	case <-waiter.ready:
+		// the mutex was passed right before the interruption,
+		// so pass it further
+		lock.handoff()
+	default:
+		lock.queue.Remove(element)
+	}
+	return Interrupted
+}
+
+// TryLock is a fail-fast version of the Lock method.
+// It returns true if the mutex is locked by the calling goroutine
+// or false otherwise. It never jumps the queue.
+func (lock *FairLock) TryLock() bool {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.holder != nil || lock.queue.Len() > 0 {
+		return false
+	}
+	lock.holder = &Holder{ID: identify(nil), Since: time.Now()}
+	return true
+}
+
+// Unlock releases an exclusive lock and passes it to the first waiter
+// in the queue. It returns InvalidIntent if the mutex is not locked
+// on entry to Unlock. The release never blocks, so the Breaker
+// is never used.
+func (lock *FairLock) Unlock(Breaker) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.holder == nil {
+		return InvalidIntent
+	}
+	lock.handoff()
+	return nil
+}
+
+// MustUnlock is a fail-fast version of the Unlock method.
+// It is a runtime error if the mutex is not locked on entry to Unlock.
+func (lock *FairLock) MustUnlock() {
+	if err := lock.Unlock(nil); err != nil {
+		panic(CriticalIssue)
+	}
+}
+
+// Holder returns the current owner of the mutex
+// or the zero Holder if the mutex is not locked.
+func (lock *FairLock) Holder() Holder {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.holder != nil {
+		return *lock.holder
+	}
+	return Holder{}
+}
+
+// Len returns the number of goroutines waiting for the mutex.
+func (lock *FairLock) Len() int {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return lock.queue.Len()
+}
+
+// handoff passes the mutex to the first waiter in the queue
+// or releases it if the queue is empty.
+// It must be called under the guard.
+func (lock *FairLock) handoff() {
+	lock.holder = nil
+	if front := lock.queue.Front(); front != nil {
+		waiter := lock.queue.Remove(front).(*qwaiter)
+		lock.holder = &Holder{ID: waiter.id, Since: time.Now()}
+		close(waiter.ready)
+	}
+}
@@ -0,0 +1,204 @@
+package locker_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+)
+
+func TestFair(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	t.Run("lock is granted in order of arrival", func(t *testing.T) {
+		lock := Fair()
+		if !lock.TryLock() {
+			t.Error("lock is expected")
+			t.FailNow()
+		}
+
+		var (
+			mu    sync.Mutex
+			order []int
+			wg    sync.WaitGroup
+		)
+		for i := range make([]struct{}, 5) {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := lock.Lock(ctx); err != nil {
+					t.Error("unexpected error")
+					return
+				}
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+				lock.MustUnlock()
+			}(i)
+			waitQueue(ctx, t, lock, i+1)
+		}
+		if lock.TryLock() {
+			t.Error("unexpected lock out of turn")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+		wg.Wait()
+
+		for i := range order {
+			if order[i] != i {
+				t.Errorf("unexpected order %v", order)
+				t.FailNow()
+			}
+		}
+	})
+
+	t.Run("interrupted waiter leaves the queue", func(t *testing.T) {
+		lock := Fair()
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		br := breaker.BreakByContext(context.WithCancel(ctx))
+		interrupted, locked := make(chan error, 1), make(chan error, 1)
+		go func() { interrupted <- lock.Lock(br) }()
+		waitQueue(ctx, t, lock, 1)
+		go func() { locked <- lock.Lock(ctx) }()
+		waitQueue(ctx, t, lock, 2)
+
+		br.Close()
+		if err := <-interrupted; err != Interrupted || lock.Len() != 1 {
+			t.Error("the waiter must be interrupted")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := <-locked; err != nil || !lock.Holder().Held() {
+			t.Error("the next waiter must take the lock")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+
+	t.Run("try to unlock not-locked mutex", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != CriticalIssue {
+				t.Error("panic with CriticalIssue is expected")
+			}
+		}()
+
+		lock := Fair()
+		if err := lock.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+}
+
+func TestFair_StressTest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	lock := Fair()
+	if *stress {
+		wg := sync.WaitGroup{}
+		for i := range make([]struct{}, 1000) {
+			wg.Add(1)
+			go func(interrupted bool) {
+				defer wg.Done()
+				br := Breaker(ctx)
+				if interrupted {
+					br = breaker.BreakByContext(context.WithTimeout(ctx, time.Microsecond))
+				}
+				if err := lock.Lock(br); err != nil {
+					if err != Interrupted || !interrupted {
+						t.Error("unexpected error")
+					}
+					return
+				}
+				if err := lock.Unlock(ctx); err != nil {
+					t.Error("unexpected error")
+					return
+				}
+			}(i%2 == 0)
+		}
+		wg.Wait()
+		if lock.Len() != 0 || lock.Holder().Held() {
+			t.Error("the lock must be released")
+		}
+	}
+}
+
+// BenchmarkFair/fair_locker-4                       	 5053644	       245 ns/op	      64 B/op	       1 allocs/op
+// BenchmarkFair/interruptible_locker-4              	 3753633	       357 ns/op	      64 B/op	       1 allocs/op
+// BenchmarkFair/contended_fair_locker-4             	  994921	      1290 ns/op	     247 B/op	       3 allocs/op
+// BenchmarkFair/contended_interruptible_locker-4    	 1340366	       943 ns/op	      64 B/op	       1 allocs/op
+func BenchmarkFair(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("fair locker", func(b *testing.B) {
+		var lock Locker = Fair()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = lock.Lock(ctx)
+			_ = lock.Unlock(ctx)
+		}
+	})
+
+	b.Run("interruptible locker", func(b *testing.B) {
+		var lock Locker = Interruptible()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = lock.Lock(ctx)
+			_ = lock.Unlock(ctx)
+		}
+	})
+
+	b.Run("contended fair locker", func(b *testing.B) {
+		var lock Locker = Fair()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = lock.Lock(ctx)
+				_ = lock.Unlock(ctx)
+			}
+		})
+	})
+
+	b.Run("contended interruptible locker", func(b *testing.B) {
+		var lock Locker = Interruptible()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = lock.Lock(ctx)
+				_ = lock.Unlock(ctx)
+			}
+		})
+	})
+}
+
+// waitQueue waits until the queue of the lock has the length.
+func waitQueue(ctx context.Context, t *testing.T, lock interface{ Len() int }, length int) {
+	for lock.Len() != length {
+		select {
+		case <-ctx.Done():
+			t.Errorf("the queue must have %d waiters", length)
+			t.FailNow()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
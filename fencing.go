@@ -0,0 +1,44 @@
+package locker
+
+import "sync"
+
+// FencingGuard returns a new guard of a shared storage against writes
+// with stale fencing tokens, e.g. issued by the Distributed lock.
+//
+//  func (storage *Storage) Write(fence uint64, data []byte) error {
+//  	if err := storage.guard.Check(storage.name, fence); err != nil {
+//  		return err
+//  	}
+//  	...
+//  }
+//
+func FencingGuard() *FenceGuard {
+	return &FenceGuard{fences: make(map[string]uint64)}
+}
+
+// A FenceGuard rejects stale fencing tokens, see FencingGuard.
+type FenceGuard struct {
+	mu     sync.Mutex
+	fences map[string]uint64
+}
+
+// Check admits the fencing token for the resource if it is not lower than
+// any token admitted before, otherwise, it returns StaleFence.
+func (guard *FenceGuard) Check(resource string, fence uint64) error {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	if fence < guard.fences[resource] {
+		return StaleFence
+	}
+	guard.fences[resource] = fence
+	return nil
+}
+
+// Last returns the highest fencing token admitted for the resource.
+func (guard *FenceGuard) Last(resource string) uint64 {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	return guard.fences[resource]
+}
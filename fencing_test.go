@@ -0,0 +1,78 @@
+package locker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+)
+
+func TestFencingGuard(t *testing.T) {
+	guard := FencingGuard()
+	if err := guard.Check("resource", 2); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := guard.Check("resource", 2); err != nil {
+		t.Error("the same owner must be able to write again")
+		t.FailNow()
+	}
+	if err := guard.Check("resource", 1); err != StaleFence {
+		t.Error("unexpected error value")
+		t.FailNow()
+	}
+	if err := guard.Check("another", 1); err != nil {
+		t.Error("resources must be independent")
+		t.FailNow()
+	}
+	if guard.Last("resource") != 2 {
+		t.Error("unexpected last fencing token")
+		t.FailNow()
+	}
+}
+
+func TestDistributed_Fence(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	backend, guard := MemoryBackend(), FencingGuard()
+	paused := Distributed(5*time.Millisecond, DistributedWithBackend(backend), DistributedWithRefresh(0))
+	active := Distributed(time.Minute, DistributedWithBackend(backend))
+
+	if paused.Fence() != 0 {
+		t.Error("the fencing token must be zero before the lock")
+		t.FailNow()
+	}
+	if err := paused.Lock(ctx); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	stale := paused.Fence()
+
+	// the paused process loses the lock, but doesn't notice it
+	if err := active.Lock(ctx); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if active.Fence() <= stale {
+		t.Error("the fencing token must increase")
+		t.FailNow()
+	}
+	if err := guard.Check(t.Name(), active.Fence()); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := guard.Check(t.Name(), stale); err != StaleFence {
+		t.Error("the write of the previous owner must be rejected")
+		t.FailNow()
+	}
+	if err := active.Unlock(ctx); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if active.Fence() != 0 {
+		t.Error("the fencing token must be zero after the unlock")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,79 @@
+package locker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fmeta is a state of the lock stored in a file.
+type fmeta struct {
+	Host   string    `json:"host,omitempty"`
+	PID    int       `json:"pid,omitempty"`
+	Token  string    `json:"token,omitempty"`
+	Fence  uint64    `json:"fence"`
+	Expire time.Time `json:"expire,omitempty"`
+}
+
+func (meta fmeta) lease(key string) Lease {
+	if meta.Token == "" {
+		return Lease{Key: key}
+	}
+	return Lease{Key: key, Token: meta.Token, TTL: time.Until(meta.Expire), Fence: meta.Fence}
+}
+
+// filename returns the path of the file of the lock by the key.
+func filename(dir, key, ext string) string {
+	return filepath.Join(dir, url.PathEscape(key)+ext)
+}
+
+// listFiles returns the keys of the files with the extension in the dir
+// which start with the prefix.
+func listFiles(dir, prefix, ext string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimSuffix(name, ext))
+		if err == nil && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func readMeta(file *os.File) (fmeta, error) {
+	var meta fmeta
+	if _, err := file.Seek(0, 0); err != nil {
+		return meta, err
+	}
+	raw, err := ioutil.ReadAll(file)
+	if err != nil || len(raw) == 0 {
+		return meta, err
+	}
+	return meta, json.Unmarshal(raw, &meta)
+}
+
+func writeMeta(file *os.File, meta fmeta) error {
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(raw, 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
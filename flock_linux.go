@@ -0,0 +1,287 @@
+package locker
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Flock returns a new instance of interruptible mutex shared by processes
+// of the same host. It is based on the flock(2) on the file by the path,
+// so the lock is released by the kernel if its owner has crashed.
+//
+//  lock := locker.Flock("/var/run/backup.lock")
+//
+//  if err := lock.Lock(ctx); err != nil {
+//  	return err
+//  }
+//  defer lock.MustUnlock()
+//  // critical section with lock protection
+//  // only one process of the host can be here one moment in time
+//
+func Flock(path string) *FileLock {
+	return &FileLock{path: path, guard: Interruptible(), retry: 10 * time.Millisecond}
+}
+
+// A FileLock is the mutex shared by processes of the same host, see Flock.
+type FileLock struct {
+	path  string
+	guard *InterruptibleLock
+	retry time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Lock takes an exclusive lock. If the lock is already in use,
+// the calling goroutine blocks until the lock is available or
+// an error occurred, e.g. if the Breaker is done.
+func (lock *FileLock) Lock(breaker Breaker) error {
+	if err := lock.guard.Lock(breaker); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(lock.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		lock.guard.MustUnlock()
+		return err
+	}
+	for {
+		locked, err := tryFlock(file, syscall.LOCK_EX)
+		if err != nil {
+			_ = file.Close()
+			lock.guard.MustUnlock()
+			return err
+		}
+		if locked {
+			lock.mu.Lock()
+			lock.file = file
+			lock.mu.Unlock()
+			return nil
+		}
+
+		timer := time.NewTimer(lock.retry)
+		select {
+		case <-breaker.Done():
+			timer.Stop()
+			_ = file.Close()
+			lock.guard.MustUnlock()
+			return Interrupted
+		case <-timer.C:
+		}
+	}
+}
+
+// TryLock is a fail-fast version of the Lock method.
+// It returns true if the lock is taken by the calling goroutine
+// or false otherwise.
+func (lock *FileLock) TryLock() bool {
+	if !lock.guard.TryLock() {
+		return false
+	}
+	file, err := os.OpenFile(lock.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		lock.guard.MustUnlock()
+		return false
+	}
+	if locked, _ := tryFlock(file, syscall.LOCK_EX); !locked {
+		_ = file.Close()
+		lock.guard.MustUnlock()
+		return false
+	}
+	lock.mu.Lock()
+	lock.file = file
+	lock.mu.Unlock()
+	return true
+}
+
+// Unlock releases an exclusive lock. It returns InvalidIntent
+// if the lock is not held on entry to Unlock. The release doesn't
+// block, so the Breaker is not used.
+func (lock *FileLock) Unlock(Breaker) error {
+	lock.mu.Lock()
+	file := lock.file
+	lock.file = nil
+	lock.mu.Unlock()
+	if file == nil {
+		return InvalidIntent
+	}
+
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	lock.guard.MustUnlock()
+	return err
+}
+
+// MustUnlock is a fail-fast version of the Unlock method.
+// It is a runtime error if the lock is not held on entry to Unlock.
+func (lock *FileLock) MustUnlock() {
+	if err := lock.Unlock(nil); err != nil {
+		panic(CriticalIssue)
+	}
+}
+
+// FileBackend returns a new storage of the distributed lock state
+// based on the flock(2) on files in the directory. It is suitable
+// to share locks between processes of the same host.
+//
+// The lock is held while the process keeps its file open, so the ttl
+// is not enforced and only reported by the Inspect method.
+// The lock is released by the kernel if its owner has crashed.
+//
+//  lock := locker.Distributed(time.Minute, locker.DistributedWithBackend(locker.FileBackend("/var/run")))
+//
+func FileBackend(dir string) *FileStorage {
+	return &FileStorage{dir: dir, files: make(map[string]*fentry)}
+}
+
+// A FileStorage keeps the distributed lock state in files
+// locked by flock(2), see FileBackend.
+type FileStorage struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*fentry
+}
+
+type fentry struct {
+	file *os.File
+	meta fmeta
+}
+
+// Acquire tries to take the lock by the key for the token
+// and returns true if it succeeded with its fencing token.
+func (backend *FileStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	if entry, found := backend.files[key]; found {
+		if entry.meta.Token != token {
+			return 0, false, nil
+		}
+		return entry.meta.Fence, true, nil
+	}
+
+	file, err := os.OpenFile(filename(backend.dir, key, ".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, false, err
+	}
+	locked, err := tryFlock(file, syscall.LOCK_EX)
+	if err != nil || !locked {
+		_ = file.Close()
+		return 0, false, err
+	}
+
+	// the fencing token survives the release to guarantee its monotonicity
+	meta, err := readMeta(file)
+	if err != nil {
+		meta = fmeta{}
+	}
+	meta = fmeta{Token: token, Fence: meta.Fence + 1, Expire: time.Now().Add(ttl)}
+	if err := writeMeta(file, meta); err != nil {
+		_ = file.Close()
+		return 0, false, err
+	}
+	backend.files[key] = &fentry{file: file, meta: meta}
+	return meta.Fence, true, nil
+}
+
+// Release releases the lock by the key if it is held by the token.
+// It can't release the lock held by another process.
+func (backend *FileStorage) Release(key, token string) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	entry, found := backend.files[key]
+	if !found || entry.meta.Token != token {
+		return InvalidIntent
+	}
+	delete(backend.files, key)
+
+	err := writeMeta(entry.file, fmeta{Fence: entry.meta.Fence})
+	if unlockErr := syscall.Flock(int(entry.file.Fd()), syscall.LOCK_UN); err == nil {
+		err = unlockErr
+	}
+	if closeErr := entry.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Refresh updates the expiration time of the lock by the key
+// if it is held by the token.
+func (backend *FileStorage) Refresh(key, token string, ttl time.Duration) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	entry, found := backend.files[key]
+	if !found || entry.meta.Token != token {
+		return InvalidIntent
+	}
+	meta := entry.meta
+	meta.Expire = time.Now().Add(ttl)
+	if err := writeMeta(entry.file, meta); err != nil {
+		return err
+	}
+	entry.meta = meta
+	return nil
+}
+
+// Inspect returns the current state of the lock by the key.
+func (backend *FileStorage) Inspect(key string) (Lease, error) {
+	backend.mu.Lock()
+	entry, found := backend.files[key]
+	var meta fmeta
+	if found {
+		meta = entry.meta
+	}
+	backend.mu.Unlock()
+	if found {
+		return meta.lease(key), nil
+	}
+
+	file, err := os.Open(filename(backend.dir, key, ".lock"))
+	if os.IsNotExist(err) {
+		return Lease{Key: key}, nil
+	}
+	if err != nil {
+		return Lease{Key: key}, err
+	}
+	defer file.Close()
+
+	free, err := tryFlock(file, syscall.LOCK_SH)
+	if err != nil || free {
+		return Lease{Key: key}, err
+	}
+	meta, err = readMeta(file)
+	if err != nil {
+		return Lease{Key: key}, err
+	}
+	return meta.lease(key), nil
+}
+
+// List returns the keys of the files of locks with the prefix.
+// The files are kept after the release, so the keys of released
+// locks are returned too.
+func (backend *FileStorage) List(prefix string) ([]string, error) {
+	return listFiles(backend.dir, prefix, ".lock")
+}
+
+// tryFlock applies the lock operation to the file without blocking
+// and returns false if the file is already locked.
+func tryFlock(file *os.File, how int) (bool, error) {
+	for {
+		err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+		switch err {
+		case nil:
+			return true, nil
+		case syscall.EINTR:
+			continue
+		case syscall.EWOULDBLOCK:
+			return false, nil
+		}
+		return false, err
+	}
+}
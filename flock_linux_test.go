@@ -0,0 +1,194 @@
+package locker_test
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+)
+
+func TestFlock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "locker")
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.lock")
+
+	t.Run("lock and unlock", func(t *testing.T) {
+		first, second := Flock(path), Flock(path)
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if second.TryLock() {
+			t.Error("unexpected double lock")
+			t.FailNow()
+		}
+		if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 20*time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := first.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if !second.TryLock() {
+			t.Error("lock is expected")
+			t.FailNow()
+		}
+		second.MustUnlock()
+	})
+
+	t.Run("try to unlock not-locked mutex", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != CriticalIssue {
+				t.Error("panic with CriticalIssue is expected")
+			}
+		}()
+		Flock(path).MustUnlock()
+	})
+
+	t.Run("another process", func(t *testing.T) {
+		helper := exec.Command(os.Args[0], "-test.run=TestFlock_Helper")
+		helper.Env = append(os.Environ(), "LOCKER_FLOCK_HELPER="+path)
+		stdin, err := helper.StdinPipe()
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		stdout, err := helper.StdoutPipe()
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := helper.Start(); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+			_ = helper.Process.Kill()
+			t.Errorf("unexpected output of the helper: %q", line)
+			t.FailNow()
+		}
+
+		lock := Flock(path)
+		if lock.TryLock() {
+			t.Error("the lock must be held by another process")
+			t.FailNow()
+		}
+		_ = stdin.Close()
+		_ = helper.Process.Kill()
+		_ = helper.Wait()
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("the lock must be released by the kernel")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+}
+
+func TestFlock_Helper(t *testing.T) {
+	path := os.Getenv("LOCKER_FLOCK_HELPER")
+	if path == "" {
+		t.Skip("it is a helper process")
+	}
+	lock := Flock(path)
+	if !lock.TryLock() {
+		os.Exit(1)
+	}
+	_, _ = os.Stdout.WriteString("locked\n")
+	_, _ = ioutil.ReadAll(os.Stdin)
+	os.Exit(0)
+}
+
+func TestFileBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "locker")
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("contract", func(t *testing.T) {
+		testBackend(t, FileBackend(dir))
+	})
+
+	t.Run("independent backends", func(t *testing.T) {
+		first, second := FileBackend(dir), FileBackend(dir)
+		fence, acquired, err := first.Acquire(t.Name(), "first", time.Minute)
+		if err != nil || !acquired {
+			t.Error("the lock must be acquired")
+			t.FailNow()
+		}
+		if _, acquired, err := second.Acquire(t.Name(), "second", time.Minute); err != nil || acquired {
+			t.Error("the lock must be busy")
+			t.FailNow()
+		}
+		if lease, err := second.Inspect(t.Name()); err != nil || lease.Token != "first" || lease.Fence != fence {
+			t.Errorf("unexpected lease %+v", lease)
+			t.FailNow()
+		}
+		if err := second.Release(t.Name(), "first"); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := first.Release(t.Name(), "first"); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		next, acquired, err := second.Acquire(t.Name(), "second", time.Minute)
+		if err != nil || !acquired || next <= fence {
+			t.Error("the fencing token must increase")
+			t.FailNow()
+		}
+		if err := second.Release(t.Name(), "second"); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("distributed lock", func(t *testing.T) {
+		options := []DistributedOption{DistributedWithKey(t.Name()), DistributedWithRetry(time.Millisecond)}
+		first := Distributed(time.Minute, append(options, DistributedWithBackend(FileBackend(dir)))...)
+		second := Distributed(time.Minute, append(options, DistributedWithBackend(FileBackend(dir)))...)
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := first.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package locker
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Holder describes the owner of a lock.
+type Holder struct {
+	// ID identifies the owner. It is set by the WithOwner or
+	// by default it is built from the host and the pid of the process
+	// which took the lock, e.g. "app-1/4242".
+	ID string
+	// Since is the time when the lock was taken.
+	Since time.Time
+	// Token is the token of the Distributed lock used to release it.
+	// It is empty for local locks.
+	Token string
+	// Fence is the fencing token of the Distributed lock.
+	// It is zero for local locks.
+	Fence uint64
+}
+
+// Held returns true if the lock is held by someone.
+func (holder Holder) Held() bool {
+	return holder.ID != ""
+}
+
+// WithOwner returns the Breaker carrying the id of the owner of a lock.
+// The lock taken with it reports the id as its Holder.
+//
+//  if err := lock.Lock(locker.WithOwner(ctx, "jobs:cleanup")); err != nil {
+//  	return err
+//  }
+//  defer lock.MustUnlock()
+//
+//  // somewhere else
+//  log.Printf("the lock is held by %s since %v", lock.Holder().ID, lock.Holder().Since)
+//
+func WithOwner(breaker Breaker, id string) *OwnedBreaker {
+	return &OwnedBreaker{Breaker: breaker, id: id}
+}
+
+// An OwnedBreaker is the Breaker carrying the id of the owner, see WithOwner.
+type OwnedBreaker struct {
+	Breaker
+	id string
+}
+
+// Owner returns the id of the owner.
+func (breaker *OwnedBreaker) Owner() string {
+	return breaker.id
+}
+
+// identify returns the id of the owner carried by the Breaker
+// or the default identity of the process.
+func identify(breaker Breaker) string {
+	if id, found := owner(breaker); found {
+		return id
+	}
+	return process
+}
+
+// owner returns the id of the owner carried by the Breaker
+// and true if it is set by the WithOwner.
+func owner(breaker Breaker) (string, bool) {
+	if breaker, is := breaker.(interface{ Owner() string }); is {
+		return breaker.Owner(), true
+	}
+	return "", false
+}
+
+// process is the default identity of the process.
+var process = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return host + "/" + strconv.Itoa(os.Getpid())
+}()
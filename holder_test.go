@@ -0,0 +1,156 @@
+package locker_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+)
+
+func TestHolder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	t.Run("interruptible", func(t *testing.T) {
+		lock := Interruptible(InterruptibleWithHolder())
+		if lock.Holder().Held() {
+			t.Error("the free mutex must not have a holder")
+			t.FailNow()
+		}
+
+		before := time.Now()
+		if err := lock.Lock(WithOwner(ctx, "worker")); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if holder := lock.Holder(); holder.ID != "worker" || holder.Since.Before(before) {
+			t.Errorf("unexpected holder %+v", holder)
+			t.FailNow()
+		}
+		lock.MustUnlock()
+		if lock.Holder().Held() {
+			t.Error("the released mutex must not have a holder")
+			t.FailNow()
+		}
+
+		if !lock.TryLock() {
+			t.Error("the mutex must be free")
+			t.FailNow()
+		}
+		if id := lock.Holder().ID; len(strings.Split(id, "/")) != 2 {
+			t.Errorf("unexpected default identity %q", id)
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+
+	t.Run("interruptible without tracking", func(t *testing.T) {
+		lock := Interruptible()
+		if err := lock.Lock(WithOwner(ctx, "worker")); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if lock.Holder().Held() {
+			t.Error("the holder must not be tracked by default")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+
+	t.Run("limited", func(t *testing.T) {
+		lock := Limited(3, LimitedWithHolders())
+		if err := lock.Acquire(WithOwner(ctx, "first"), 1); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := lock.Acquire(WithOwner(ctx, "second"), 2); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if holder := lock.Holder(); holder.ID != "first" {
+			t.Errorf("unexpected holder %+v", holder)
+			t.FailNow()
+		}
+		if holders := lock.Holders(); len(holders) != 2 || holders[1].ID != "second" {
+			t.Errorf("unexpected holders %+v", holders)
+			t.FailNow()
+		}
+		if _, err := lock.Release(1); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if holders := lock.Holders(); len(holders) != 1 || holders[0].ID != "second" {
+			t.Errorf("unexpected holders %+v", holders)
+			t.FailNow()
+		}
+		if _, err := lock.Release(2); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if lock.Holder().Held() {
+			t.Error("the free semaphore must not have a holder")
+			t.FailNow()
+		}
+
+		if err := lock.Lock(WithOwner(ctx, "exclusive")); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if holder := lock.Holder(); holder.ID != "exclusive" {
+			t.Errorf("unexpected holder %+v", holder)
+			t.FailNow()
+		}
+		if err := lock.Unlock(WithOwner(ctx, "exclusive")); err != nil || lock.Holder().Held() {
+			t.Error("the semaphore must be released")
+			t.FailNow()
+		}
+	})
+
+	t.Run("distributed", func(t *testing.T) {
+		backend := MemoryBackend()
+		lock := Distributed(time.Minute, DistributedWithKey(t.Name()), DistributedWithBackend(backend))
+		if err := lock.Lock(WithOwner(ctx, "worker")); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		holder := lock.Holder()
+		if holder.ID != "worker" || holder.Token == "" || holder.Fence != lock.Fence() {
+			t.Errorf("unexpected holder %+v", holder)
+			t.FailNow()
+		}
+		lease, err := backend.Inspect(t.Name())
+		if err != nil || lease.Token != holder.Token || lease.Owner() != "worker" {
+			t.Errorf("unexpected lease %+v", lease)
+			t.FailNow()
+		}
+		if err := backend.Release(t.Name(), holder.Token); err != nil {
+			t.Error("the lock must be released by the token of its holder")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != InvalidIntent {
+			t.Errorf("unexpected error %v", err)
+			t.FailNow()
+		}
+		if lock.Holder().Held() {
+			t.Error("the released lock must not have a holder")
+			t.FailNow()
+		}
+
+		lock = Distributed(time.Minute, DistributedWithKey(t.Name()), DistributedWithBackend(backend),
+			DistributedWithOwner("service"))
+		if err := lock.Lock(WithOwner(ctx, "worker")); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if id := lock.Holder().ID; id != "service" {
+			t.Errorf("unexpected owner %q", id)
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+}
@@ -1,4 +1,4 @@
-package internal
+package locker
 
 // A Breaker carries a cancellation signal to break an action execution.
 type Breaker interface {
@@ -46,21 +46,36 @@ type SafeLocker interface {
 	MustUnlock()
 }
 
+// A Semaphore carries of getting slots of a limited resource
+// with the ability to interrupt the action.
 type Semaphore interface {
+	// Acquire takes the slots. If they are not available,
+	// the calling goroutine blocks until they are or
+	// an error occurred, e.g. if the Breaker is done.
 	Acquire(Breaker, uint32) error
+	// Release releases the slots and returns the number
+	// of acquired slots before the release.
 	Release(uint32) (uint32, error)
 }
 
+// A FastSemaphore is a Semaphore with a possibility to take slots
+// fast or failure if it not possible at that moment.
 type FastSemaphore interface {
 	Semaphore
+	// TryAcquire is a fail-fast version of the Acquire method.
 	TryAcquire(uint32) bool
 }
 
+// An Observable reports the usage of a limited resource.
 type Observable interface {
+	// Count returns the number of acquired slots.
 	Count() uint32
+	// Limit returns the capacity of the resource.
 	Limit() uint32
 }
 
+// A Resizable is a limited resource with a changeable capacity.
 type Resizable interface {
+	// SetCapacity sets up the new capacity and returns the previous one.
 	SetCapacity(uint32) uint32
 }
@@ -0,0 +1,71 @@
+package locker_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+	"github.com/kamilsk/locker/raft"
+)
+
+func TestInterfaces(t *testing.T) {
+	for _, lock := range []interface{}{Interruptible(), Fair(), Prioritized(), InterruptibleRW()} {
+		if _, is := lock.(FastLocker); !is {
+			t.Errorf("%T must be a FastLocker", lock)
+		}
+		if _, is := lock.(SafeLocker); !is {
+			t.Errorf("%T must be a SafeLocker", lock)
+		}
+	}
+	for _, sem := range []interface{}{Limited(1), PrioritizedLimited(1), DistributedLimited(1, time.Minute)} {
+		if _, is := sem.(FastSemaphore); !is {
+			t.Errorf("%T must be a FastSemaphore", sem)
+		}
+		if _, is := sem.(Observable); !is {
+			t.Errorf("%T must be Observable", sem)
+		}
+		if _, is := sem.(Locker); !is {
+			t.Errorf("%T must be a Locker", sem)
+		}
+	}
+
+	var (
+		_ Resizable   = Limited(1)
+		_ Resizable   = DistributedLimited(1, time.Minute)
+		_ Locker      = Distributed(time.Minute)
+		_ Locker      = Reentrant()
+		_ Locker      = DistributedRW(time.Minute)
+		_ Locker      = InterruptibleRW().RLocker()
+		_ BreakCloser = breaker.BreakByTimeout(0)
+	)
+
+	// the returned types can be named in signatures of the caller
+	var (
+		_ *InterruptibleLock      = InterruptibleSet(1).ByKey("key")
+		_ *InterruptibleRWLock    = InterruptibleRWSet(1).ByKey("key")
+		_ *InterruptibleLockSet   = InterruptibleSet(1)
+		_ *InterruptibleRWLockSet = InterruptibleRWSet(1)
+		_ *MutexSet               = Set(1)
+		_ *RWMutexSet             = RWSet(1)
+		_ *OwnedBreaker           = WithOwner(breaker.BreakByTimeout(0), "owner")
+		_ *PrioritizedBreaker     = WithPriority(breaker.BreakByTimeout(0), 1)
+		_ *FenceGuard             = FencingGuard()
+		_ *Participant            = Election("id", time.Minute)
+		_ *MemoryStorage          = MemoryBackend()
+		_ *MemorySemaphoreStorage = MemorySemaphoreBackend()
+		_ *MemoryRWStorage        = MemoryRWBackend()
+		_ *LockfileStorage        = LockfileBackend("dir")
+
+		_ func(string) *RedisStorage                       = RedisBackend
+		_ func(string) *RedisSemaphoreStorage              = RedisSemaphoreBackend
+		_ func(string) *RedisRWStorage                     = RedisRWBackend
+		_ func([]string, ...RedlockOption) *RedlockStorage = RedlockBackend
+		_ func(string) *EtcdStorage                        = EtcdBackend
+		_ func(string) *MemcacheStorage                    = MemcacheBackend
+		_ func(*sql.DB, ...SQLOption) *SQLStorage          = SQLBackend
+		_ func(*raft.Node, ...RaftOption) *RaftStorage     = RaftBackend
+		_ func(*RaftStorage) *RaftSemaphoreStorage         = (*RaftStorage).Semaphore
+	)
+}
@@ -0,0 +1,20 @@
+package internal
+
+import "context"
+
+// Context returns a context that is canceled when the breaker is done
+// or the returned cancel function is called.
+func Context(breaker interface{ Done() <-chan struct{} }) (context.Context, context.CancelFunc) {
+	if ctx, is := breaker.(context.Context); is {
+		return context.WithCancel(ctx)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-breaker.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,327 @@
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// New returns a new client to the etcd v3 JSON gateway by the endpoint,
+// e.g. http://127.0.0.1:2379.
+func New(endpoint string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{endpoint: strings.TrimRight(endpoint, "/"), http: client}
+}
+
+// Error is the error reply returned by the gateway.
+type Error string
+
+// Error returns the string representation of the error.
+func (err Error) Error() string {
+	return string(err)
+}
+
+// LeaseNotFound is returned when the lease has already expired or been revoked.
+const LeaseNotFound Error = "etcdserver: requested lease not found"
+
+// Client is a minimalistic client of the etcd v3 API
+// which works through its JSON gateway.
+type Client struct {
+	endpoint string
+	http     *http.Client
+}
+
+// Endpoint returns the address of the server.
+func (client *Client) Endpoint() string {
+	return client.endpoint
+}
+
+// Int64 is an integer encoded by the gateway as a JSON string.
+type Int64 int64
+
+// MarshalJSON encodes the integer as a JSON string.
+func (i Int64) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatInt(int64(i), 10) + `"`), nil
+}
+
+// UnmarshalJSON decodes the integer from a JSON string or number.
+func (i *Int64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = Int64(n)
+	return nil
+}
+
+// KeyValue is a stored key-value pair.
+type KeyValue struct {
+	Key            []byte `json:"key,omitempty"`
+	Value          []byte `json:"value,omitempty"`
+	CreateRevision Int64  `json:"create_revision,omitempty"`
+	ModRevision    Int64  `json:"mod_revision,omitempty"`
+	Lease          Int64  `json:"lease,omitempty"`
+}
+
+// Header is the common part of all responses.
+type Header struct {
+	Revision Int64 `json:"revision,omitempty"`
+}
+
+// RangeRequest describes a range of keys to fetch.
+type RangeRequest struct {
+	Key               []byte `json:"key,omitempty"`
+	RangeEnd          []byte `json:"range_end,omitempty"`
+	Limit             Int64  `json:"limit,omitempty"`
+	SortOrder         string `json:"sort_order,omitempty"`
+	SortTarget        string `json:"sort_target,omitempty"`
+	MaxCreateRevision Int64  `json:"max_create_revision,omitempty"`
+}
+
+// RangeResponse contains the fetched keys.
+type RangeResponse struct {
+	Header Header     `json:"header"`
+	Kvs    []KeyValue `json:"kvs,omitempty"`
+	Count  Int64      `json:"count,omitempty"`
+}
+
+// PutRequest describes a key to store.
+type PutRequest struct {
+	Key   []byte `json:"key,omitempty"`
+	Value []byte `json:"value,omitempty"`
+	Lease Int64  `json:"lease,omitempty"`
+}
+
+// DeleteRequest describes a key to delete.
+type DeleteRequest struct {
+	Key []byte `json:"key,omitempty"`
+}
+
+// DeleteResponse contains a number of deleted keys.
+type DeleteResponse struct {
+	Header  Header `json:"header"`
+	Deleted Int64  `json:"deleted,omitempty"`
+}
+
+// Compare is a condition of the transaction.
+type Compare struct {
+	Key            []byte `json:"key,omitempty"`
+	Target         string `json:"target,omitempty"`
+	Result         string `json:"result,omitempty"`
+	CreateRevision Int64  `json:"create_revision"`
+}
+
+// Op is an operation of the transaction.
+type Op struct {
+	RequestPut   *PutRequest   `json:"request_put,omitempty"`
+	RequestRange *RangeRequest `json:"request_range,omitempty"`
+}
+
+// OpResponse is a result of the operation of the transaction.
+type OpResponse struct {
+	ResponseRange *RangeResponse `json:"response_range,omitempty"`
+}
+
+// TxnRequest describes a transaction.
+type TxnRequest struct {
+	Compare []Compare `json:"compare,omitempty"`
+	Success []Op      `json:"success,omitempty"`
+	Failure []Op      `json:"failure,omitempty"`
+}
+
+// TxnResponse contains the result of the transaction.
+type TxnResponse struct {
+	Header    Header       `json:"header"`
+	Succeeded bool         `json:"succeeded,omitempty"`
+	Responses []OpResponse `json:"responses,omitempty"`
+}
+
+// LeaseRequest describes a lease.
+type LeaseRequest struct {
+	ID  Int64 `json:"ID,omitempty"`
+	TTL Int64 `json:"TTL,omitempty"`
+}
+
+// LeaseResponse contains the lease state.
+type LeaseResponse struct {
+	Header Header `json:"header"`
+	ID     Int64  `json:"ID,omitempty"`
+	TTL    Int64  `json:"TTL,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Status is the body of the failed call, e.g. of the revoke of an unknown lease.
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Error   string `json:"error,omitempty"`
+}
+
+// WatchRequest describes a key to watch.
+type WatchRequest struct {
+	CreateRequest struct {
+		Key           []byte `json:"key,omitempty"`
+		StartRevision Int64  `json:"start_revision,omitempty"`
+	} `json:"create_request"`
+}
+
+// WatchResponse contains events of the watched key.
+type WatchResponse struct {
+	Header  Header  `json:"header"`
+	Created bool    `json:"created,omitempty"`
+	Events  []Event `json:"events,omitempty"`
+}
+
+// Event describes a change of the watched key.
+type Event struct {
+	Type string   `json:"type,omitempty"`
+	Kv   KeyValue `json:"kv"`
+}
+
+// Grant creates a new lease with the ttl in seconds.
+func (client *Client) Grant(ctx context.Context, ttl int64) (int64, error) {
+	var response LeaseResponse
+	if err := client.call(ctx, "/v3/lease/grant", LeaseRequest{TTL: Int64(ttl)}, &response); err != nil {
+		return 0, err
+	}
+	if response.Error != "" {
+		return 0, errors.New("etcd: " + response.Error)
+	}
+	return int64(response.ID), nil
+}
+
+// KeepAlive renews the lease and returns its new ttl.
+// The zero ttl means the lease has already expired.
+func (client *Client) KeepAlive(ctx context.Context, id int64) (int64, error) {
+	var response struct {
+		Result LeaseResponse `json:"result"`
+	}
+	if err := client.call(ctx, "/v3/lease/keepalive", LeaseRequest{ID: Int64(id)}, &response); err != nil {
+		return 0, err
+	}
+	return int64(response.Result.TTL), nil
+}
+
+// TimeToLive returns the remaining ttl of the lease in seconds.
+// The negative ttl means the lease has already expired.
+func (client *Client) TimeToLive(ctx context.Context, id int64) (int64, error) {
+	var response LeaseResponse
+	if err := client.call(ctx, "/v3/lease/timetolive", LeaseRequest{ID: Int64(id)}, &response); err != nil {
+		return 0, err
+	}
+	return int64(response.TTL), nil
+}
+
+// Revoke revokes the lease and deletes all keys attached to it.
+// It returns LeaseNotFound if the lease has already expired.
+func (client *Client) Revoke(ctx context.Context, id int64) error {
+	var response LeaseResponse
+	if err := client.call(ctx, "/v3/lease/revoke", LeaseRequest{ID: Int64(id)}, &response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return Error(response.Error)
+	}
+	return nil
+}
+
+// Range fetches keys described by the request.
+func (client *Client) Range(ctx context.Context, request RangeRequest) (RangeResponse, error) {
+	var response RangeResponse
+	err := client.call(ctx, "/v3/kv/range", request, &response)
+	return response, err
+}
+
+// Delete deletes the key and returns a number of deleted keys.
+func (client *Client) Delete(ctx context.Context, key []byte) (int64, error) {
+	var response DeleteResponse
+	if err := client.call(ctx, "/v3/kv/deleterange", DeleteRequest{Key: key}, &response); err != nil {
+		return 0, err
+	}
+	return int64(response.Deleted), nil
+}
+
+// Txn executes the transaction.
+func (client *Client) Txn(ctx context.Context, request TxnRequest) (TxnResponse, error) {
+	var response TxnResponse
+	err := client.call(ctx, "/v3/kv/txn", request, &response)
+	return response, err
+}
+
+// WaitDelete blocks until the key is deleted after the revision
+// or the context is done.
+func (client *Client) WaitDelete(ctx context.Context, key []byte, revision int64) error {
+	var request WatchRequest
+	request.CreateRequest.Key, request.CreateRequest.StartRevision = key, Int64(revision)
+	response, err := client.post(ctx, "/v3/watch", request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var message struct {
+			Result WatchResponse `json:"result"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return err
+		}
+		for _, event := range message.Result.Events {
+			if event.Type == "DELETE" {
+				return nil
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("etcd: watch stream is closed unexpectedly")
+}
+
+func (client *Client) call(ctx context.Context, path string, request, response interface{}) error {
+	raw, err := client.post(ctx, path, request)
+	if err != nil {
+		return err
+	}
+	defer raw.Body.Close()
+	return json.NewDecoder(raw.Body).Decode(response)
+}
+
+func (client *Client) post(ctx context.Context, path string, request interface{}) (*http.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, client.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	response, err := client.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		// the gateway describes the failed call by its status
+		var status Status
+		if json.NewDecoder(response.Body).Decode(&status) == nil && status.Message != "" {
+			return nil, Error(status.Message)
+		}
+		return nil, fmt.Errorf("etcd: unexpected status %q", response.Status)
+	}
+	return response, nil
+}
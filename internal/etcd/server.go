@@ -0,0 +1,398 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NewServer returns an in-memory stand-in of the etcd v3 JSON gateway.
+// It supports only the subset of the KV, lease and watch API
+// used by the module.
+//
+//  server := httptest.NewServer(etcd.NewServer())
+//  defer server.Close()
+//
+//  client := etcd.New(server.URL, nil)
+//
+func NewServer() *Server {
+	return &Server{
+		keys:     make(map[string]*KeyValue),
+		leases:   make(map[int64]*lease),
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+// Server is an in-memory stand-in of the etcd v3 JSON gateway.
+type Server struct {
+	mu       sync.Mutex
+	revision int64
+	leaseID  int64
+	keys     map[string]*KeyValue
+	leases   map[int64]*lease
+	history  []Event
+	watchers map[*watcher]struct{}
+}
+
+type lease struct {
+	ttl    int64
+	expire time.Time
+	timer  *time.Timer
+	keys   map[string]struct{}
+}
+
+type watcher struct {
+	key    []byte
+	events chan Event
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (server *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var response interface{}
+	switch req.URL.Path {
+	case "/v3/lease/grant":
+		var request LeaseRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response = server.grant(request)
+	case "/v3/lease/keepalive":
+		var request LeaseRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response = map[string]interface{}{"result": server.keepAlive(request)}
+	case "/v3/lease/timetolive":
+		var request LeaseRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response = server.timeToLive(request)
+	case "/v3/lease/revoke":
+		var request LeaseRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		if !server.revoke(request) {
+			// the gateway maps the NotFound code of the call to its status
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(rw).Encode(Status{Code: 5, Message: string(LeaseNotFound), Error: string(LeaseNotFound)})
+			return
+		}
+		server.mu.Lock()
+		response = LeaseResponse{Header: server.header()}
+		server.mu.Unlock()
+	case "/v3/kv/range":
+		var request RangeRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		server.mu.Lock()
+		response = server.rangeKeys(request)
+		server.mu.Unlock()
+	case "/v3/kv/deleterange":
+		var request DeleteRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response = server.deleteKey(request)
+	case "/v3/kv/txn":
+		var request TxnRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response = server.txn(request)
+	case "/v3/watch":
+		var request WatchRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		server.watch(rw, req, request)
+		return
+	default:
+		http.NotFound(rw, req)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(response)
+}
+
+func (server *Server) grant(request LeaseRequest) LeaseResponse {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.leaseID++
+	id, ttl := server.leaseID, int64(request.TTL)
+	if ttl < 1 {
+		ttl = 1
+	}
+	server.leases[id] = &lease{
+		ttl:    ttl,
+		expire: time.Now().Add(time.Duration(ttl) * time.Second),
+		timer:  time.AfterFunc(time.Duration(ttl)*time.Second, func() { server.expire(id) }),
+		keys:   make(map[string]struct{}),
+	}
+	return LeaseResponse{Header: server.header(), ID: Int64(id), TTL: Int64(ttl)}
+}
+
+func (server *Server) keepAlive(request LeaseRequest) LeaseResponse {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	l, found := server.leases[int64(request.ID)]
+	if !found {
+		return LeaseResponse{Header: server.header(), ID: request.ID}
+	}
+	l.expire = time.Now().Add(time.Duration(l.ttl) * time.Second)
+	l.timer.Reset(time.Duration(l.ttl) * time.Second)
+	return LeaseResponse{Header: server.header(), ID: request.ID, TTL: Int64(l.ttl)}
+}
+
+func (server *Server) timeToLive(request LeaseRequest) LeaseResponse {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	l, found := server.leases[int64(request.ID)]
+	if !found {
+		return LeaseResponse{Header: server.header(), ID: request.ID, TTL: -1}
+	}
+	ttl := int64(time.Until(l.expire) / time.Second)
+	return LeaseResponse{Header: server.header(), ID: request.ID, TTL: Int64(ttl)}
+}
+
+// revoke returns false if the lease is not found.
+func (server *Server) revoke(request LeaseRequest) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	l, found := server.leases[int64(request.ID)]
+	if !found {
+		return false
+	}
+	l.timer.Stop()
+	server.dropLease(int64(request.ID), l)
+	return true
+}
+
+func (server *Server) expire(id int64) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if l, found := server.leases[id]; found {
+		server.dropLease(id, l)
+	}
+}
+
+func (server *Server) dropLease(id int64, l *lease) {
+	delete(server.leases, id)
+	if len(l.keys) == 0 {
+		return
+	}
+	server.revision++
+	for key := range l.keys {
+		server.remove(key)
+	}
+}
+
+func (server *Server) rangeKeys(request RangeRequest) RangeResponse {
+	kvs := make([]KeyValue, 0, 1)
+	for key, kv := range server.keys {
+		if !inRange([]byte(key), request.Key, request.RangeEnd) {
+			continue
+		}
+		if request.MaxCreateRevision > 0 && kv.CreateRevision > request.MaxCreateRevision {
+			continue
+		}
+		kvs = append(kvs, *kv)
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		if request.SortTarget == "CREATE" {
+			if request.SortOrder == "DESCEND" {
+				return kvs[i].CreateRevision > kvs[j].CreateRevision
+			}
+			return kvs[i].CreateRevision < kvs[j].CreateRevision
+		}
+		if request.SortOrder == "DESCEND" {
+			return bytes.Compare(kvs[i].Key, kvs[j].Key) > 0
+		}
+		return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+	})
+	count := len(kvs)
+	if request.Limit > 0 && int(request.Limit) < len(kvs) {
+		kvs = kvs[:request.Limit]
+	}
+	return RangeResponse{Header: server.header(), Kvs: kvs, Count: Int64(count)}
+}
+
+func (server *Server) deleteKey(request DeleteRequest) DeleteResponse {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if _, found := server.keys[string(request.Key)]; !found {
+		return DeleteResponse{Header: server.header()}
+	}
+	server.revision++
+	server.remove(string(request.Key))
+	return DeleteResponse{Header: server.header(), Deleted: 1}
+}
+
+func (server *Server) txn(request TxnRequest) TxnResponse {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	succeeded := true
+	for _, cmp := range request.Compare {
+		var actual Int64
+		if kv, found := server.keys[string(cmp.Key)]; found {
+			actual = kv.CreateRevision
+		}
+		if cmp.Target != "CREATE" || actual != cmp.CreateRevision {
+			succeeded = false
+		}
+	}
+	ops := request.Success
+	if !succeeded {
+		ops = request.Failure
+	}
+
+	var changed bool
+	responses := make([]OpResponse, 0, len(ops))
+	for _, op := range ops {
+		switch {
+		case op.RequestPut != nil:
+			if !changed {
+				server.revision++
+				changed = true
+			}
+			server.put(*op.RequestPut)
+			responses = append(responses, OpResponse{})
+		case op.RequestRange != nil:
+			result := server.rangeKeys(*op.RequestRange)
+			responses = append(responses, OpResponse{ResponseRange: &result})
+		}
+	}
+	return TxnResponse{Header: server.header(), Succeeded: succeeded, Responses: responses}
+}
+
+func (server *Server) put(request PutRequest) {
+	kv, found := server.keys[string(request.Key)]
+	if !found {
+		kv = &KeyValue{Key: request.Key, CreateRevision: Int64(server.revision)}
+		server.keys[string(request.Key)] = kv
+	}
+	if kv.Lease != 0 {
+		if l, found := server.leases[int64(kv.Lease)]; found {
+			delete(l.keys, string(kv.Key))
+		}
+	}
+	kv.Value, kv.ModRevision, kv.Lease = request.Value, Int64(server.revision), request.Lease
+	if l, found := server.leases[int64(request.Lease)]; found {
+		l.keys[string(request.Key)] = struct{}{}
+	}
+	server.notify(Event{Kv: *kv})
+}
+
+func (server *Server) remove(key string) {
+	kv := server.keys[key]
+	delete(server.keys, key)
+	if l, found := server.leases[int64(kv.Lease)]; found {
+		delete(l.keys, key)
+	}
+	server.notify(Event{Type: "DELETE", Kv: KeyValue{Key: kv.Key, ModRevision: Int64(server.revision)}})
+}
+
+func (server *Server) notify(event Event) {
+	server.history = append(server.history, event)
+	for w := range server.watchers {
+		if bytes.Equal(w.key, event.Kv.Key) {
+			select {
+			case w.events <- event:
+			default:
+			}
+		}
+	}
+}
+
+func (server *Server) watch(rw http.ResponseWriter, req *http.Request, request WatchRequest) {
+	w := &watcher{key: request.CreateRequest.Key, events: make(chan Event, 16)}
+
+	server.mu.Lock()
+	var replay []Event
+	if start := request.CreateRequest.StartRevision; start > 0 {
+		for _, event := range server.history {
+			if event.Kv.ModRevision >= start && bytes.Equal(event.Kv.Key, w.key) {
+				replay = append(replay, event)
+			}
+		}
+	}
+	server.watchers[w] = struct{}{}
+	created := map[string]interface{}{"result": WatchResponse{Header: server.header(), Created: true}}
+	server.mu.Unlock()
+
+	defer func() {
+		server.mu.Lock()
+		delete(server.watchers, w)
+		server.mu.Unlock()
+	}()
+
+	rw.Header().Set("Content-Type", "application/json")
+	encoder, flusher := json.NewEncoder(rw), rw.(http.Flusher)
+	if err := encoder.Encode(created); err != nil {
+		return
+	}
+	flusher.Flush()
+	send := func(events ...Event) bool {
+		server.mu.Lock()
+		message := map[string]interface{}{"result": WatchResponse{Header: server.header(), Events: events}}
+		server.mu.Unlock()
+		if err := encoder.Encode(message); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	if len(replay) > 0 && !send(replay...) {
+		return
+	}
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case event := <-w.events:
+			if !send(event) {
+				return
+			}
+		}
+	}
+}
+
+func (server *Server) header() Header {
+	return Header{Revision: Int64(server.revision)}
+}
+
+func decode(rw http.ResponseWriter, req *http.Request, request interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func inRange(key, from, to []byte) bool {
+	if len(to) == 0 {
+		return bytes.Equal(key, from)
+	}
+	if bytes.Equal(to, []byte{0}) {
+		// all keys greater than or equal to the key
+		return bytes.Compare(key, from) >= 0
+	}
+	return bytes.Compare(key, from) >= 0 && bytes.Compare(key, to) < 0
+}
@@ -0,0 +1,162 @@
+package etcd_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker/internal/etcd"
+)
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	server := httptest.NewServer(NewServer())
+	defer server.Close()
+
+	client := New(server.URL, nil)
+
+	lease, err := client.Grant(ctx, 60)
+	if err != nil || lease == 0 {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	put := func(key string) int64 {
+		response, err := client.Txn(ctx, TxnRequest{
+			Compare: []Compare{{Key: []byte(key), Target: "CREATE", CreateRevision: 0}},
+			Success: []Op{{RequestPut: &PutRequest{Key: []byte(key), Value: []byte(key), Lease: Int64(lease)}}},
+		})
+		if err != nil || !response.Succeeded {
+			t.Errorf("%s: unexpected result", key)
+			t.FailNow()
+		}
+		return int64(response.Header.Revision)
+	}
+	first, _, second := put("a/2"), put("a/b/1"), put("a/1")
+
+	t.Run("range by prefix", func(t *testing.T) {
+		response, err := client.Range(ctx, RangeRequest{
+			Key:        []byte("a/"),
+			RangeEnd:   []byte("a0"),
+			SortOrder:  "ASCEND",
+			SortTarget: "CREATE",
+		})
+		if err != nil || response.Count != 3 {
+			t.Errorf("unexpected response %+v", response)
+			t.FailNow()
+		}
+		if string(response.Kvs[0].Key) != "a/2" || string(response.Kvs[2].Key) != "a/1" {
+			t.Errorf("unexpected order %+v", response.Kvs)
+			t.FailNow()
+		}
+	})
+
+	t.Run("range with limit", func(t *testing.T) {
+		response, err := client.Range(ctx, RangeRequest{
+			Key:               []byte("a/"),
+			RangeEnd:          []byte("a0"),
+			Limit:             1,
+			SortOrder:         "DESCEND",
+			SortTarget:        "CREATE",
+			MaxCreateRevision: Int64(second - 1),
+		})
+		if err != nil || response.Count != 2 || len(response.Kvs) != 1 || string(response.Kvs[0].Key) != "a/b/1" {
+			t.Errorf("unexpected response %+v", response)
+			t.FailNow()
+		}
+	})
+
+	t.Run("create if not exists", func(t *testing.T) {
+		response, err := client.Txn(ctx, TxnRequest{
+			Compare: []Compare{{Key: []byte("a/2"), Target: "CREATE", CreateRevision: 0}},
+			Success: []Op{{RequestPut: &PutRequest{Key: []byte("a/2"), Value: []byte("stranger")}}},
+			Failure: []Op{{RequestRange: &RangeRequest{Key: []byte("a/2")}}},
+		})
+		if err != nil || response.Succeeded {
+			t.Error("the key must not be overwritten")
+			t.FailNow()
+		}
+		kvs := response.Responses[0].ResponseRange.Kvs
+		if len(kvs) != 1 || int64(kvs[0].CreateRevision) != first || string(kvs[0].Value) != "a/2" {
+			t.Errorf("unexpected key %+v", kvs)
+			t.FailNow()
+		}
+	})
+
+	t.Run("wait for delete", func(t *testing.T) {
+		deleted := make(chan error, 1)
+		go func() { deleted <- client.WaitDelete(ctx, []byte("a/2"), second) }()
+		if n, err := client.Delete(ctx, []byte("a/2")); err != nil || n != 1 {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+		if err := <-deleted; err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if n, err := client.Delete(ctx, []byte("a/2")); err != nil || n != 0 {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+	})
+
+	t.Run("lease", func(t *testing.T) {
+		if ttl, err := client.KeepAlive(ctx, lease); err != nil || ttl != 60 {
+			t.Errorf("unexpected ttl %d", ttl)
+			t.FailNow()
+		}
+		if ttl, err := client.TimeToLive(ctx, lease); err != nil || ttl <= 0 {
+			t.Errorf("unexpected ttl %d", ttl)
+			t.FailNow()
+		}
+		if err := client.Revoke(ctx, lease); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := client.Revoke(ctx, lease); err != LeaseNotFound {
+			t.Errorf("unexpected error %v", err)
+			t.FailNow()
+		}
+		if response, err := client.Range(ctx, RangeRequest{Key: []byte("a/"), RangeEnd: []byte("a0")}); err != nil || response.Count != 0 {
+			t.Error("the keys of the lease must be deleted")
+			t.FailNow()
+		}
+		if ttl, err := client.KeepAlive(ctx, lease); err != nil || ttl > 0 {
+			t.Errorf("unexpected ttl %d", ttl)
+			t.FailNow()
+		}
+		if ttl, err := client.TimeToLive(ctx, lease); err != nil || ttl >= 0 {
+			t.Errorf("unexpected ttl %d", ttl)
+			t.FailNow()
+		}
+	})
+}
+
+func TestServer_Expire(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := httptest.NewServer(NewServer())
+	defer server.Close()
+
+	client := New(server.URL, nil)
+
+	lease, err := client.Grant(ctx, 1)
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	response, err := client.Txn(ctx, TxnRequest{
+		Success: []Op{{RequestPut: &PutRequest{Key: []byte("key"), Value: []byte("token"), Lease: Int64(lease)}}},
+	})
+	if err != nil || !response.Succeeded {
+		t.Error("unexpected result")
+		t.FailNow()
+	}
+	if err := client.WaitDelete(ctx, []byte("key"), int64(response.Header.Revision)); err != nil {
+		t.Error("the key must be deleted with its lease")
+		t.FailNow()
+	}
+}
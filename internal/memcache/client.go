@@ -0,0 +1,241 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is the error reply returned by the server.
+type Error string
+
+// Error returns the string representation of the error.
+func (err Error) Error() string {
+	return string(err)
+}
+
+// MaxKeyLength is the maximum length of the key accepted by the server.
+const MaxKeyLength = 250
+
+// MaxRelativeExptime is the maximum exptime in seconds read by the server
+// as relative to the current time, the greater one is read as the unix time.
+const MaxRelativeExptime = 60 * 60 * 24 * 30
+
+// ValidKey returns true if the key can be written into the command line,
+// i.e. it is not empty, not longer than MaxKeyLength and contains
+// neither spaces nor control characters.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > MaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// Item is a stored value with its unique version.
+type Item struct {
+	Key   string
+	Value []byte
+	CAS   uint64
+}
+
+// New returns a new client to the memcached server by the address.
+// The connection is established lazily and restored after
+// a network failure on the next call.
+func New(addr string, timeout time.Duration) *Client {
+	return &Client{addr: addr, timeout: timeout}
+}
+
+// Client is a minimalistic memcached client which speaks
+// the text protocol through a single connection.
+type Client struct {
+	addr    string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// Addr returns the address of the server.
+func (client *Client) Addr() string {
+	return client.addr
+}
+
+// Add stores the value only if the key doesn't exist yet.
+// The exptime is in seconds, the zero means the value never expires.
+func (client *Client) Add(key string, value []byte, exptime int64) (bool, error) {
+	return client.store("add", key, value, exptime, 0)
+}
+
+// CompareAndSwap stores the value only if the item has not been
+// changed since it was fetched.
+func (client *Client) CompareAndSwap(item *Item, exptime int64) (bool, error) {
+	return client.store("cas", item.Key, item.Value, exptime, item.CAS)
+}
+
+// Gets returns the item by the key with its unique version
+// or nil if the key doesn't exist.
+func (client *Client) Gets(key string) (*Item, error) {
+	var item *Item
+	err := client.do([]byte("gets "+key+"\r\n"), func(rd *bufio.Reader) error {
+		for {
+			line, err := reply(rd)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			fields := strings.Fields(line)
+			if len(fields) != 5 || fields[0] != "VALUE" {
+				return fmt.Errorf("memcache: unexpected reply %q", line)
+			}
+			size, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return err
+			}
+			cas, err := strconv.ParseUint(fields[4], 10, 64)
+			if err != nil {
+				return err
+			}
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(rd, buf); err != nil {
+				return err
+			}
+			item = &Item{Key: fields[1], Value: buf[:size], CAS: cas}
+		}
+	})
+	return item, err
+}
+
+// Increment increases the numeric value by the key for the delta
+// and returns the new value. It returns false if the key doesn't exist.
+func (client *Client) Increment(key string, delta uint64) (uint64, bool, error) {
+	var (
+		value uint64
+		found bool
+	)
+	err := client.do([]byte("incr "+key+" "+strconv.FormatUint(delta, 10)+"\r\n"), func(rd *bufio.Reader) error {
+		line, err := reply(rd)
+		if err != nil || line == "NOT_FOUND" {
+			return err
+		}
+		value, err = strconv.ParseUint(line, 10, 64)
+		found = err == nil
+		return err
+	})
+	return value, found, err
+}
+
+// CompareAndDelete deletes the item only if it has not been changed
+// since it was fetched. It uses the meta delete command.
+func (client *Client) CompareAndDelete(item *Item) (bool, error) {
+	var deleted bool
+	err := client.do([]byte("md "+item.Key+" C"+strconv.FormatUint(item.CAS, 10)+"\r\n"), func(rd *bufio.Reader) error {
+		line, err := reply(rd)
+		deleted = line == "HD"
+		return err
+	})
+	return deleted, err
+}
+
+// Close closes the underlying connection.
+func (client *Client) Close() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.conn == nil {
+		return nil
+	}
+	err := client.conn.Close()
+	client.conn, client.rd = nil, nil
+	return err
+}
+
+func (client *Client) store(command, key string, value []byte, exptime int64, cas uint64) (bool, error) {
+	request := make([]byte, 0, len(key)+len(value)+64)
+	request = append(request, command...)
+	request = append(request, ' ')
+	request = append(request, key...)
+	request = append(request, " 0 "...)
+	request = strconv.AppendInt(request, exptime, 10)
+	request = append(request, ' ')
+	request = strconv.AppendInt(request, int64(len(value)), 10)
+	if command == "cas" {
+		request = append(request, ' ')
+		request = strconv.AppendUint(request, cas, 10)
+	}
+	request = append(request, '\r', '\n')
+	request = append(request, value...)
+	request = append(request, '\r', '\n')
+
+	var stored bool
+	err := client.do(request, func(rd *bufio.Reader) error {
+		line, err := reply(rd)
+		stored = line == "STORED"
+		return err
+	})
+	return stored, err
+}
+
+func (client *Client) do(request []byte, read func(*bufio.Reader) error) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.conn == nil {
+		conn, err := net.DialTimeout("tcp", client.addr, client.timeout)
+		if err != nil {
+			return err
+		}
+		client.conn, client.rd = conn, bufio.NewReader(conn)
+	}
+	if client.timeout > 0 {
+		_ = client.conn.SetDeadline(time.Now().Add(client.timeout))
+	}
+
+	_, err := client.conn.Write(request)
+	if err == nil {
+		err = read(client.rd)
+	}
+	if err != nil {
+		if _, is := err.(Error); !is {
+			_ = client.conn.Close()
+			client.conn, client.rd = nil, nil
+		}
+	}
+	return err
+}
+
+// reply reads a single line reply and converts error replies into Error.
+func reply(rd *bufio.Reader) (string, error) {
+	line, err := readLine(rd)
+	if err != nil {
+		return "", err
+	}
+	if line == "ERROR" || strings.HasPrefix(line, "CLIENT_ERROR") || strings.HasPrefix(line, "SERVER_ERROR") {
+		return "", Error(line)
+	}
+	return line, nil
+}
+
+func readLine(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("memcache: malformed line")
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,256 @@
+package memcache
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewServer starts an in-process stand-in of the memcached server
+// on a random local port. It supports only the subset of the text
+// protocol used by the module.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &Server{
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+		data:     make(map[string]*entry),
+	}
+	go server.serve()
+	return server, nil
+}
+
+// Server is an in-process stand-in of the memcached server.
+type Server struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	data   map[string]*entry
+	cas    uint64
+	closed bool
+}
+
+type entry struct {
+	value  []byte
+	cas    uint64
+	expire time.Time
+}
+
+// Addr returns the address the server listens on.
+func (server *Server) Addr() string {
+	return server.listener.Addr().String()
+}
+
+// Close stops the server and drops all active connections.
+func (server *Server) Close() error {
+	server.mu.Lock()
+	server.closed = true
+	for conn := range server.conns {
+		_ = conn.Close()
+	}
+	server.mu.Unlock()
+	return server.listener.Close()
+}
+
+// Flush drops all stored items to simulate a restart of the server.
+func (server *Server) Flush() {
+	server.mu.Lock()
+	server.data = make(map[string]*entry)
+	server.mu.Unlock()
+}
+
+func (server *Server) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.mu.Lock()
+		if server.closed {
+			server.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		server.conns[conn] = struct{}{}
+		server.mu.Unlock()
+		go server.handle(conn)
+	}
+}
+
+func (server *Server) handle(conn net.Conn) {
+	defer func() {
+		server.mu.Lock()
+		delete(server.conns, conn)
+		server.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	rd := bufio.NewReader(conn)
+	for {
+		line, err := readLine(rd)
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			if _, err := conn.Write([]byte("ERROR\r\n")); err != nil {
+				return
+			}
+			continue
+		}
+
+		var data []byte
+		switch args[0] {
+		case "set", "add", "cas":
+			if len(args) < 5 {
+				break
+			}
+			size, err := strconv.Atoi(args[4])
+			if err != nil || size < 0 {
+				break
+			}
+			data = make([]byte, size+2)
+			if _, err := io.ReadFull(rd, data); err != nil {
+				return
+			}
+			data = data[:size]
+		}
+
+		server.mu.Lock()
+		reply := server.exec(args, data)
+		server.mu.Unlock()
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (server *Server) exec(args []string, data []byte) string {
+	switch command := args[0]; command {
+	case "get", "gets":
+		reply := make([]byte, 0, 64)
+		for _, key := range args[1:] {
+			e := server.get(key)
+			if e == nil {
+				continue
+			}
+			reply = append(reply, "VALUE "+key+" 0 "+strconv.Itoa(len(e.value))...)
+			if command == "gets" {
+				reply = append(reply, ' ')
+				reply = strconv.AppendUint(reply, e.cas, 10)
+			}
+			reply = append(append(append(reply, '\r', '\n'), e.value...), '\r', '\n')
+		}
+		return string(reply) + "END\r\n"
+	case "set", "add", "cas":
+		if len(args) < 5 || (command == "cas") != (len(args) == 6) || data == nil {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+		exptime, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+		e := server.get(args[1])
+		switch command {
+		case "add":
+			if e != nil {
+				return "NOT_STORED\r\n"
+			}
+		case "cas":
+			cas, err := strconv.ParseUint(args[5], 10, 64)
+			if err != nil {
+				return "CLIENT_ERROR bad command line format\r\n"
+			}
+			if e == nil {
+				return "NOT_FOUND\r\n"
+			}
+			if e.cas != cas {
+				return "EXISTS\r\n"
+			}
+		}
+		server.cas++
+		e = &entry{value: data, cas: server.cas}
+		switch {
+		case exptime < 0:
+			e.expire = time.Now()
+		case exptime > MaxRelativeExptime:
+			e.expire = time.Unix(exptime, 0)
+		case exptime > 0:
+			e.expire = time.Now().Add(time.Duration(exptime) * time.Second)
+		}
+		server.data[args[1]] = e
+		return "STORED\r\n"
+	case "delete":
+		if len(args) != 2 {
+			return "ERROR\r\n"
+		}
+		if server.get(args[1]) == nil {
+			return "NOT_FOUND\r\n"
+		}
+		delete(server.data, args[1])
+		return "DELETED\r\n"
+	case "md":
+		if len(args) < 2 {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+		e := server.get(args[1])
+		if e == nil {
+			return "NF\r\n"
+		}
+		for _, flag := range args[2:] {
+			if strings.HasPrefix(flag, "C") {
+				cas, err := strconv.ParseUint(flag[1:], 10, 64)
+				if err != nil {
+					return "CLIENT_ERROR bad token in command line format\r\n"
+				}
+				if e.cas != cas {
+					return "EX\r\n"
+				}
+			}
+		}
+		delete(server.data, args[1])
+		return "HD\r\n"
+	case "incr":
+		if len(args) != 3 {
+			return "ERROR\r\n"
+		}
+		delta, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR invalid numeric delta argument\r\n"
+		}
+		e := server.get(args[1])
+		if e == nil {
+			return "NOT_FOUND\r\n"
+		}
+		value, err := strconv.ParseUint(string(e.value), 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+		}
+		value += delta
+		server.cas++
+		e.value, e.cas = []byte(strconv.FormatUint(value, 10)), server.cas
+		return string(e.value) + "\r\n"
+	}
+	return "ERROR\r\n"
+}
+
+func (server *Server) get(key string) *entry {
+	e, found := server.data[key]
+	if !found {
+		return nil
+	}
+	if !e.expire.IsZero() && !time.Now().Before(e.expire) {
+		delete(server.data, key)
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,130 @@
+package memcache_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker/internal/memcache"
+)
+
+func TestServer(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer server.Close()
+
+	client := New(server.Addr(), time.Second)
+	defer client.Close()
+
+	if added, err := client.Add("key", []byte("token"), 1); err != nil || !added {
+		t.Error("the value must be added")
+		t.FailNow()
+	}
+	if added, err := client.Add("key", []byte("stranger"), 1); err != nil || added {
+		t.Error("the value must not be added twice")
+		t.FailNow()
+	}
+	item, err := client.Gets("key")
+	if err != nil || item == nil || string(item.Value) != "token" {
+		t.Errorf("unexpected item %+v", item)
+		t.FailNow()
+	}
+	if stored, err := client.CompareAndSwap(&Item{Key: "key", Value: []byte("next"), CAS: item.CAS}, 1); err != nil || !stored {
+		t.Error("the value must be swapped")
+		t.FailNow()
+	}
+	if stored, err := client.CompareAndSwap(item, 1); err != nil || stored {
+		t.Error("the outdated value must not be swapped")
+		t.FailNow()
+	}
+	if deleted, err := client.CompareAndDelete(item); err != nil || deleted {
+		t.Error("the outdated value must not be deleted")
+		t.FailNow()
+	}
+	if item, err = client.Gets("key"); err != nil || item == nil || string(item.Value) != "next" {
+		t.Errorf("unexpected item %+v", item)
+		t.FailNow()
+	}
+	if deleted, err := client.CompareAndDelete(item); err != nil || !deleted {
+		t.Error("the value must be deleted")
+		t.FailNow()
+	}
+	if item, err := client.Gets("key"); err != nil || item != nil {
+		t.Errorf("unexpected item %+v", item)
+		t.FailNow()
+	}
+
+	if _, found, err := client.Increment("counter", 1); err != nil || found {
+		t.Error("the counter must not exist")
+		t.FailNow()
+	}
+	if added, err := client.Add("counter", []byte("41"), 0); err != nil || !added {
+		t.Error("the counter must be added")
+		t.FailNow()
+	}
+	if value, found, err := client.Increment("counter", 1); err != nil || !found || value != 42 {
+		t.Error("the counter must be incremented")
+		t.FailNow()
+	}
+	if _, _, err := client.Increment("key with spaces", 1); err == nil {
+		t.Error("error is expected")
+		t.FailNow()
+	}
+	if _, _, err := client.Increment("counter", 1); err != nil {
+		t.Error("connection must survive an error reply")
+		t.FailNow()
+	}
+}
+
+func TestServer_Expiration(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer server.Close()
+
+	client := New(server.Addr(), time.Second)
+	defer client.Close()
+
+	if added, err := client.Add("key", []byte("token"), -1); err != nil || !added {
+		t.Error("the value must be added")
+		t.FailNow()
+	}
+	if item, err := client.Gets("key"); err != nil || item != nil {
+		t.Error("the value must be expired")
+		t.FailNow()
+	}
+	if added, err := client.Add("key", []byte("token"), 0); err != nil || !added {
+		t.Error("the value must be added")
+		t.FailNow()
+	}
+	server.Flush()
+	if item, err := client.Gets("key"); err != nil || item != nil {
+		t.Error("the value must be flushed")
+		t.FailNow()
+	}
+}
+
+func TestServer_Close(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+
+	client := New(server.Addr(), time.Second)
+	defer client.Close()
+
+	if _, err := client.Gets("key"); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	_ = server.Close()
+	if _, err := client.Gets("key"); err == nil {
+		t.Error("error is expected")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error is the error reply returned by the server.
+type Error string
+
+// Error returns the string representation of the error.
+func (err Error) Error() string {
+	return string(err)
+}
+
+// New returns a new client to the Redis server by the address.
+// The connection is established lazily and restored after
+// a network failure on the next call.
+func New(addr string, timeout time.Duration) *Client {
+	return &Client{addr: addr, timeout: timeout}
+}
+
+// Client is a minimalistic Redis client which speaks RESP
+// through a single connection.
+type Client struct {
+	addr    string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// Addr returns the address of the server.
+func (client *Client) Addr() string {
+	return client.addr
+}
+
+// Do sends the command to the server and returns its reply.
+// The reply is one of string, int64, []interface{}, nil or Error.
+func (client *Client) Do(args ...string) (interface{}, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.conn == nil {
+		conn, err := net.DialTimeout("tcp", client.addr, client.timeout)
+		if err != nil {
+			return nil, err
+		}
+		client.conn, client.rd = conn, bufio.NewReader(conn)
+	}
+	if client.timeout > 0 {
+		_ = client.conn.SetDeadline(time.Now().Add(client.timeout))
+	}
+
+	reply, err := client.roundTrip(args)
+	if err != nil {
+		if _, is := err.(Error); !is {
+			_ = client.conn.Close()
+			client.conn, client.rd = nil, nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Close closes the underlying connection.
+func (client *Client) Close() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.conn == nil {
+		return nil
+	}
+	err := client.conn.Close()
+	client.conn, client.rd = nil, nil
+	return err
+}
+
+func (client *Client) roundTrip(args []string) (interface{}, error) {
+	if _, err := client.conn.Write(Command(args...)); err != nil {
+		return nil, err
+	}
+	reply, err := Read(client.rd)
+	if err != nil {
+		return nil, err
+	}
+	if err, is := reply.(Error); is {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Escape escapes the special characters of glob-style patterns,
+// e.g. used by the MATCH option of SCAN.
+func Escape(s string) string {
+	var escaped []byte
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, s[i])
+	}
+	return string(escaped)
+}
+
+// Command encodes the command into the RESP array of bulk strings.
+func Command(args ...string) []byte {
+	buf := make([]byte, 0, 16*(len(args)+1))
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// Read decodes a single RESP value from the reader.
+func Read(rd *bufio.Reader) (interface{}, error) {
+	line, err := readLine(rd)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			value, err := Read(rd)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func readLine(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,238 @@
+package redis
+
+// AcquireScript sets the key to the token if it doesn't exist
+// and returns the next fencing token or zero otherwise.
+//
+//  KEYS[1] - the lock key
+//  KEYS[2] - the fencing counter key
+//  ARGV[1] - the owner token
+//  ARGV[2] - the ttl in milliseconds
+const AcquireScript = `
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0
+`
+
+// ReleaseScript deletes the key only if it holds the expected token.
+//
+//  KEYS[1] - the lock key
+//  ARGV[1] - the owner token
+const ReleaseScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`
+
+// RefreshScript sets a new ttl of the key only if it holds
+// the expected token.
+//
+//  KEYS[1] - the lock key
+//  ARGV[1] - the owner token
+//  ARGV[2] - the ttl in milliseconds
+const RefreshScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`
+
+// FenceScript raises the fencing counter to the value if the key holds
+// the expected token and returns the counter or zero otherwise.
+//
+//  KEYS[1] - the lock key
+//  KEYS[2] - the fencing counter key
+//  ARGV[1] - the owner token
+//  ARGV[2] - the fencing token
+const FenceScript = `
+if redis.call("get", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local fence = tonumber(redis.call("get", KEYS[2]) or "0")
+if fence < tonumber(ARGV[2]) then
+	redis.call("set", KEYS[2], ARGV[2])
+	return tonumber(ARGV[2])
+end
+return fence
+`
+
+// InspectScript returns the value of the key, its ttl in milliseconds
+// and the last fencing token.
+//
+//  KEYS[1] - the lock key
+//  KEYS[2] - the fencing counter key
+const InspectScript = `
+return {redis.call("get", KEYS[1]), redis.call("pttl", KEYS[1]), redis.call("get", KEYS[2])}
+`
+
+// SemaphoreAcquireScript adds the weight to the holder if the total
+// weight of alive holders doesn't exceed the limit and returns 1
+// or 0 otherwise. The holders are kept in the sorted set by their
+// expiration time, their weights are kept in the hash.
+//
+//  KEYS[1] - the sorted set of holders
+//  KEYS[2] - the hash of weights
+//  KEYS[3] - the limit key
+//  ARGV[1] - the holder token
+//  ARGV[2] - the weight
+//  ARGV[3] - the default limit
+//  ARGV[4] - the ttl in milliseconds
+//  ARGV[5] - the current time in milliseconds
+const SemaphoreAcquireScript = semaphoreCleanup + `
+local limit = tonumber(redis.call("get", KEYS[3]) or ARGV[3])
+if count + tonumber(ARGV[2]) > limit then
+	return 0
+end
+redis.call("hincrby", KEYS[2], ARGV[1], ARGV[2])
+redis.call("zadd", KEYS[1], tonumber(ARGV[5]) + tonumber(ARGV[4]), ARGV[1])
+return 1
+`
+
+// SemaphoreReleaseScript subtracts the weight from the holder
+// and returns the total weight before the release or -1
+// if the holder doesn't have enough weight.
+//
+//  KEYS[1] - the sorted set of holders
+//  KEYS[2] - the hash of weights
+//  ARGV[1] - the holder token
+//  ARGV[2] - the weight
+//  ARGV[3] - the current time in milliseconds
+const SemaphoreReleaseScript = semaphoreCleanup + `
+local weight = tonumber(redis.call("hget", KEYS[2], ARGV[1]) or "0")
+if weight < tonumber(ARGV[2]) then
+	return -1
+end
+if redis.call("hincrby", KEYS[2], ARGV[1], -tonumber(ARGV[2])) == 0 then
+	redis.call("hdel", KEYS[2], ARGV[1])
+	redis.call("zrem", KEYS[1], ARGV[1])
+end
+return count
+`
+
+// SemaphoreRefreshScript extends the lease of the holder
+// and returns 1 or 0 if the holder has expired.
+//
+//  KEYS[1] - the sorted set of holders
+//  KEYS[2] - the hash of weights
+//  ARGV[1] - the holder token
+//  ARGV[2] - the ttl in milliseconds
+//  ARGV[3] - the current time in milliseconds
+const SemaphoreRefreshScript = semaphoreCleanup + `
+if not redis.call("zscore", KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call("zadd", KEYS[1], tonumber(ARGV[3]) + tonumber(ARGV[2]), ARGV[1])
+return 1
+`
+
+// SemaphoreStateScript returns the total weight of alive holders
+// and the limit.
+//
+//  KEYS[1] - the sorted set of holders
+//  KEYS[2] - the hash of weights
+//  KEYS[3] - the limit key
+//  ARGV[1] - the default limit
+//  ARGV[2] - the current time in milliseconds
+const SemaphoreStateScript = semaphoreCleanup + `
+return {count, tonumber(redis.call("get", KEYS[3]) or ARGV[1])}
+`
+
+// SemaphoreResizeScript sets the limit and returns the previous one.
+//
+//  KEYS[1] - the limit key
+//  ARGV[1] - the new limit
+//  ARGV[2] - the default limit
+const SemaphoreResizeScript = `
+local limit = tonumber(redis.call("get", KEYS[1]) or ARGV[2])
+redis.call("set", KEYS[1], ARGV[1])
+return limit
+`
+
+// semaphoreCleanup removes expired holders and counts
+// the total weight of alive ones. The current time is
+// the last argument of the script.
+const semaphoreCleanup = `
+local now = ARGV[#ARGV]
+for _, holder in ipairs(redis.call("zrangebyscore", KEYS[1], "-inf", now)) do
+	redis.call("hdel", KEYS[2], holder)
+end
+redis.call("zremrangebyscore", KEYS[1], "-inf", now)
+local count = 0
+for _, weight in ipairs(redis.call("hvals", KEYS[2])) do
+	count = count + tonumber(weight)
+end
+`
+
+// RWReadScript adds the reader to the sorted set by its expiration time
+// if there is no writer and returns 1 or 0 otherwise.
+//
+//  KEYS[1] - the writer key
+//  KEYS[2] - the sorted set of readers
+//  ARGV[1] - the reader token
+//  ARGV[2] - the ttl in milliseconds
+//  ARGV[3] - the current time in milliseconds
+const RWReadScript = `
+if redis.call("exists", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("zadd", KEYS[2], tonumber(ARGV[3]) + tonumber(ARGV[2]), ARGV[1])
+return 1
+`
+
+// RWWriteScript sets the writer key to the token if there is no other
+// writer, so new readers are blocked, and returns 1 if there are
+// no alive readers or 0 otherwise.
+//
+//  KEYS[1] - the writer key
+//  KEYS[2] - the sorted set of readers
+//  ARGV[1] - the writer token
+//  ARGV[2] - the ttl in milliseconds
+//  ARGV[3] - the current time in milliseconds
+const RWWriteScript = `
+local writer = redis.call("get", KEYS[1])
+if writer and writer ~= ARGV[1] then
+	return 0
+end
+redis.call("set", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("zremrangebyscore", KEYS[2], "-inf", ARGV[3])
+if redis.call("zcard", KEYS[2]) == 0 then
+	return 1
+end
+return 0
+`
+
+// RWReleaseScript removes the writer or the reader by the token
+// and returns 1 or 0 if it is not found.
+//
+//  KEYS[1] - the writer key
+//  KEYS[2] - the sorted set of readers
+//  ARGV[1] - the token
+//  ARGV[2] - the current time in milliseconds
+const RWReleaseScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+redis.call("zremrangebyscore", KEYS[2], "-inf", ARGV[2])
+return redis.call("zrem", KEYS[2], ARGV[1])
+`
+
+// RWRefreshScript extends the lease of the writer or the reader
+// by the token and returns 1 or 0 if it is not found.
+//
+//  KEYS[1] - the writer key
+//  KEYS[2] - the sorted set of readers
+//  ARGV[1] - the token
+//  ARGV[2] - the ttl in milliseconds
+//  ARGV[3] - the current time in milliseconds
+const RWRefreshScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+redis.call("zremrangebyscore", KEYS[2], "-inf", ARGV[3])
+if not redis.call("zscore", KEYS[2], ARGV[1]) then
+	return 0
+end
+redis.call("zadd", KEYS[2], tonumber(ARGV[3]) + tonumber(ARGV[2]), ARGV[1])
+return 1
+`
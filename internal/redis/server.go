@@ -0,0 +1,582 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewServer starts an in-process stand-in of the Redis server
+// on a random local port. It supports only the subset of commands
+// used by the module.
+//
+// The server doesn't embed a Lua interpreter, instead, it recognizes
+// the scripts defined by this package and executes their Go equivalents.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &Server{
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+		data:     make(map[string]*entry),
+	}
+	go server.serve()
+	return server, nil
+}
+
+// Server is an in-process stand-in of the Redis server.
+type Server struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	data    map[string]*entry
+	latency time.Duration
+	closed  bool
+}
+
+type entry struct {
+	value   string
+	members map[string]int64 // the sorted set of members by their scores
+	fields  map[string]int64 // the hash of integer fields
+	expire  time.Time
+}
+
+// Addr returns the address the server listens on.
+func (server *Server) Addr() string {
+	return server.listener.Addr().String()
+}
+
+// Close stops the server and drops all active connections.
+func (server *Server) Close() error {
+	server.mu.Lock()
+	server.closed = true
+	for conn := range server.conns {
+		_ = conn.Close()
+	}
+	server.mu.Unlock()
+	return server.listener.Close()
+}
+
+// SetLatency sets up a delay before each reply of the server
+// to simulate a slow node.
+func (server *Server) SetLatency(latency time.Duration) {
+	server.mu.Lock()
+	server.latency = latency
+	server.mu.Unlock()
+}
+
+func (server *Server) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.mu.Lock()
+		if server.closed {
+			server.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		server.conns[conn] = struct{}{}
+		server.mu.Unlock()
+		go server.handle(conn)
+	}
+}
+
+func (server *Server) handle(conn net.Conn) {
+	defer func() {
+		server.mu.Lock()
+		delete(server.conns, conn)
+		server.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	rd := bufio.NewReader(conn)
+	for {
+		request, err := Read(rd)
+		if err != nil {
+			return
+		}
+		values, is := request.([]interface{})
+		if !is || len(values) == 0 {
+			return
+		}
+		args := make([]string, 0, len(values))
+		for _, value := range values {
+			arg, is := value.(string)
+			if !is {
+				return
+			}
+			args = append(args, arg)
+		}
+
+		server.mu.Lock()
+		reply := server.exec(strings.ToUpper(args[0]), args[1:])
+		latency := server.latency
+		server.mu.Unlock()
+
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		if _, err := conn.Write(encode(nil, reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (server *Server) exec(command string, args []string) interface{} {
+	switch command {
+	case "PING":
+		return status("PONG")
+	case "GET":
+		if len(args) != 1 {
+			return arity(command)
+		}
+		if e := server.get(args[0]); e != nil {
+			return e.value
+		}
+		return nil
+	case "SET":
+		return server.set(args)
+	case "DEL":
+		var deleted int64
+		for _, key := range args {
+			if server.get(key) != nil {
+				delete(server.data, key)
+				deleted++
+			}
+		}
+		return deleted
+	case "INCR":
+		if len(args) != 1 {
+			return arity(command)
+		}
+		return server.incr(args[0])
+	case "PTTL":
+		if len(args) != 1 {
+			return arity(command)
+		}
+		return server.pttl(args[0])
+	case "EVAL":
+		return server.eval(args)
+	case "SCAN":
+		return server.scan(args)
+	}
+	return Error("ERR unknown command '" + command + "'")
+}
+
+// scan returns all keys matching the pattern in a single iteration.
+// Only the "*" wildcard is supported by the MATCH option.
+func (server *Server) scan(args []string) interface{} {
+	if len(args) == 0 || len(args)%2 == 0 {
+		return arity("SCAN")
+	}
+	pattern := "*"
+	for i := 1; i < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+		default:
+			return Error("ERR syntax error")
+		}
+	}
+	keys := make([]interface{}, 0, len(server.data))
+	for key := range server.data {
+		if server.get(key) != nil && match(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	return []interface{}{"0", keys}
+}
+
+// match reports whether the key matches the glob-style pattern
+// with the "*" wildcard and escaped characters.
+func match(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(key); i >= 0; i-- {
+				if match(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		if len(key) == 0 || key[0] != pattern[0] {
+			return false
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
+
+func (server *Server) get(key string) *entry {
+	e, found := server.data[key]
+	if !found {
+		return nil
+	}
+	if !e.expire.IsZero() && !time.Now().Before(e.expire) {
+		delete(server.data, key)
+		return nil
+	}
+	return e
+}
+
+func (server *Server) set(args []string) interface{} {
+	if len(args) < 2 {
+		return arity("SET")
+	}
+	key, value := args[0], args[1]
+	var nx, xx bool
+	var ttl time.Duration
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "PX", "EX":
+			if i+1 == len(args) {
+				return Error("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return Error("ERR invalid expire time in set")
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if strings.ToUpper(args[i]) == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		default:
+			return Error("ERR syntax error")
+		}
+	}
+	exists := server.get(key) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	e := &entry{value: value}
+	if ttl > 0 {
+		e.expire = time.Now().Add(ttl)
+	}
+	server.data[key] = e
+	return status("OK")
+}
+
+func (server *Server) incr(key string) interface{} {
+	e := server.get(key)
+	if e == nil {
+		e = &entry{value: "0"}
+		server.data[key] = e
+	}
+	n, err := strconv.ParseInt(e.value, 10, 64)
+	if err != nil {
+		return Error("ERR value is not an integer or out of range")
+	}
+	n++
+	e.value = strconv.FormatInt(n, 10)
+	return n
+}
+
+func (server *Server) pttl(key string) int64 {
+	e := server.get(key)
+	if e == nil {
+		return -2
+	}
+	if e.expire.IsZero() {
+		return -1
+	}
+	return int64(time.Until(e.expire) / time.Millisecond)
+}
+
+func (server *Server) eval(args []string) interface{} {
+	if len(args) < 2 {
+		return arity("EVAL")
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 || n > len(args)-2 {
+		return Error("ERR value is not an integer or out of range")
+	}
+	keys, argv := args[2:2+n], args[2+n:]
+	switch args[0] {
+	case AcquireScript:
+		if len(keys) != 2 || len(argv) != 2 {
+			return arity("EVAL")
+		}
+		if reply := server.set([]string{keys[0], argv[0], "NX", "PX", argv[1]}); reply == nil {
+			return int64(0)
+		} else if _, is := reply.(Error); is {
+			return reply
+		}
+		return server.incr(keys[1])
+	case ReleaseScript:
+		if len(keys) != 1 || len(argv) != 1 {
+			return arity("EVAL")
+		}
+		if e := server.get(keys[0]); e != nil && e.value == argv[0] {
+			delete(server.data, keys[0])
+			return int64(1)
+		}
+		return int64(0)
+	case RefreshScript:
+		if len(keys) != 1 || len(argv) != 2 {
+			return arity("EVAL")
+		}
+		ms, err := strconv.ParseInt(argv[1], 10, 64)
+		if err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		if e := server.get(keys[0]); e != nil && e.value == argv[0] {
+			e.expire = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			return int64(1)
+		}
+		return int64(0)
+	case FenceScript:
+		if len(keys) != 2 || len(argv) != 2 {
+			return arity("EVAL")
+		}
+		value, err := strconv.ParseInt(argv[1], 10, 64)
+		if err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		if e := server.get(keys[0]); e == nil || e.value != argv[0] {
+			return int64(0)
+		}
+		fence, err := server.integer(keys[1], "0")
+		if err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		if fence < value {
+			server.set([]string{keys[1], argv[1]})
+			return value
+		}
+		return fence
+	case InspectScript:
+		if len(keys) != 2 {
+			return arity("EVAL")
+		}
+		var value, fence interface{}
+		if e := server.get(keys[0]); e != nil {
+			value = e.value
+		}
+		if e := server.get(keys[1]); e != nil {
+			fence = e.value
+		}
+		return []interface{}{value, server.pttl(keys[0]), fence}
+	case SemaphoreAcquireScript, SemaphoreReleaseScript, SemaphoreRefreshScript, SemaphoreStateScript:
+		return server.semaphore(args[0], keys, argv)
+	case RWReadScript, RWWriteScript, RWReleaseScript, RWRefreshScript:
+		return server.rw(args[0], keys, argv)
+	case SemaphoreResizeScript:
+		if len(keys) != 1 || len(argv) != 2 {
+			return arity("EVAL")
+		}
+		limit, err := server.integer(keys[0], argv[1])
+		if err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		server.set([]string{keys[0], argv[0]})
+		return limit
+	}
+	return Error("NOSCRIPT the stand-in doesn't know the script")
+}
+
+// semaphore executes the Go equivalents of the semaphore scripts.
+func (server *Server) semaphore(script string, keys, argv []string) interface{} {
+	if len(keys) < 2 || len(argv) < 2 {
+		return arity("EVAL")
+	}
+	args := make([]int64, len(argv))
+	for i := range argv {
+		// the first argument of the most scripts is a holder token
+		if i == 0 && script != SemaphoreStateScript {
+			continue
+		}
+		n, err := strconv.ParseInt(argv[i], 10, 64)
+		if err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		args[i] = n
+	}
+
+	holders, weights := server.collection(keys[0]), server.collection(keys[1])
+	now := args[len(args)-1]
+	var count int64
+	for holder, expire := range holders.members {
+		if expire <= now {
+			delete(holders.members, holder)
+			delete(weights.fields, holder)
+		}
+	}
+	for _, weight := range weights.fields {
+		count += weight
+	}
+
+	switch script {
+	case SemaphoreAcquireScript:
+		if len(keys) != 3 || len(argv) != 5 {
+			return arity("EVAL")
+		}
+		limit, err := server.integer(keys[2], argv[2])
+		if err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		if count+args[1] > limit {
+			return int64(0)
+		}
+		weights.fields[argv[0]] += args[1]
+		holders.members[argv[0]] = args[4] + args[3]
+		return int64(1)
+	case SemaphoreReleaseScript:
+		if len(argv) != 3 {
+			return arity("EVAL")
+		}
+		if weights.fields[argv[0]] < args[1] {
+			return int64(-1)
+		}
+		if weights.fields[argv[0]] -= args[1]; weights.fields[argv[0]] == 0 {
+			delete(weights.fields, argv[0])
+			delete(holders.members, argv[0])
+		}
+		return count
+	case SemaphoreRefreshScript:
+		if len(argv) != 3 {
+			return arity("EVAL")
+		}
+		if _, found := holders.members[argv[0]]; !found {
+			return int64(0)
+		}
+		holders.members[argv[0]] = args[2] + args[1]
+		return int64(1)
+	}
+	if len(keys) != 3 || len(argv) != 2 {
+		return arity("EVAL")
+	}
+	limit, err := server.integer(keys[2], argv[0])
+	if err != nil {
+		return Error("ERR value is not an integer or out of range")
+	}
+	return []interface{}{count, limit}
+}
+
+// rw executes the Go equivalents of the reader/writer lock scripts.
+func (server *Server) rw(script string, keys, argv []string) interface{} {
+	if len(keys) != 2 || len(argv) < 2 {
+		return arity("EVAL")
+	}
+	now, err := strconv.ParseInt(argv[len(argv)-1], 10, 64)
+	if err != nil {
+		return Error("ERR value is not an integer or out of range")
+	}
+	var ttl int64
+	if len(argv) == 3 {
+		if ttl, err = strconv.ParseInt(argv[1], 10, 64); err != nil || ttl <= 0 {
+			return Error("ERR invalid expire time")
+		}
+	}
+	readers, writer := server.collection(keys[1]), server.get(keys[0])
+	for reader, expire := range readers.members {
+		if expire <= now {
+			delete(readers.members, reader)
+		}
+	}
+
+	switch script {
+	case RWReadScript:
+		if writer != nil {
+			return int64(0)
+		}
+		readers.members[argv[0]] = now + ttl
+		return int64(1)
+	case RWWriteScript:
+		if writer != nil && writer.value != argv[0] {
+			return int64(0)
+		}
+		server.set([]string{keys[0], argv[0], "PX", argv[1]})
+		if len(readers.members) == 0 {
+			return int64(1)
+		}
+		return int64(0)
+	case RWReleaseScript:
+		if writer != nil && writer.value == argv[0] {
+			delete(server.data, keys[0])
+			return int64(1)
+		}
+		if _, found := readers.members[argv[0]]; found {
+			delete(readers.members, argv[0])
+			return int64(1)
+		}
+		return int64(0)
+	}
+	if writer != nil && writer.value == argv[0] {
+		writer.expire = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		return int64(1)
+	}
+	if _, found := readers.members[argv[0]]; found {
+		readers.members[argv[0]] = now + ttl
+		return int64(1)
+	}
+	return int64(0)
+}
+
+// collection returns the sorted set or the hash by the key
+// and creates it if it doesn't exist.
+func (server *Server) collection(key string) *entry {
+	e := server.get(key)
+	if e == nil {
+		e = &entry{members: make(map[string]int64), fields: make(map[string]int64)}
+		server.data[key] = e
+	}
+	return e
+}
+
+// integer returns the numeric value by the key or the fallback
+// if the key doesn't exist.
+func (server *Server) integer(key, fallback string) (int64, error) {
+	if e := server.get(key); e != nil {
+		fallback = e.value
+	}
+	return strconv.ParseInt(fallback, 10, 64)
+}
+
+type status string
+
+func arity(command string) Error {
+	return Error("ERR wrong number of arguments for '" + strings.ToLower(command) + "' command")
+}
+
+func encode(buf []byte, reply interface{}) []byte {
+	switch value := reply.(type) {
+	case nil:
+		return append(buf, "$-1\r\n"...)
+	case status:
+		return append(append(append(buf, '+'), value...), '\r', '\n')
+	case Error:
+		return append(append(append(buf, '-'), value...), '\r', '\n')
+	case int64:
+		return append(strconv.AppendInt(append(buf, ':'), value, 10), '\r', '\n')
+	case string:
+		buf = strconv.AppendInt(append(buf, '$'), int64(len(value)), 10)
+		return append(append(append(buf, '\r', '\n'), value...), '\r', '\n')
+	case []interface{}:
+		buf = strconv.AppendInt(append(buf, '*'), int64(len(value)), 10)
+		buf = append(buf, '\r', '\n')
+		for _, item := range value {
+			buf = encode(buf, item)
+		}
+		return buf
+	}
+	panic("redis: unsupported reply type")
+}
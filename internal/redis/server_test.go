@@ -0,0 +1,77 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker/internal/redis"
+)
+
+func TestServer(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer server.Close()
+
+	client := New(server.Addr(), time.Second)
+	defer client.Close()
+
+	tests := []struct {
+		name     string
+		command  []string
+		expected interface{}
+	}{
+		{"ping", []string{"PING"}, "PONG"},
+		{"set", []string{"SET", "key", "token", "NX", "PX", "1000"}, "OK"},
+		{"set if not exists", []string{"SET", "key", "token", "NX", "PX", "1000"}, nil},
+		{"get", []string{"GET", "key"}, "token"},
+		{"release by stranger", []string{"EVAL", ReleaseScript, "1", "key", "stranger"}, int64(0)},
+		{"release by owner", []string{"EVAL", ReleaseScript, "1", "key", "token"}, int64(1)},
+		{"get released", []string{"GET", "key"}, nil},
+		{"ttl of unknown", []string{"PTTL", "key"}, int64(-2)},
+		{"delete unknown", []string{"DEL", "key"}, int64(0)},
+	}
+	for _, test := range tests {
+		reply, err := client.Do(test.command...)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			t.FailNow()
+		}
+		if reply != test.expected {
+			t.Errorf("%s: unexpected reply %#v", test.name, reply)
+			t.FailNow()
+		}
+	}
+
+	if _, err := client.Do("UNKNOWN"); err == nil {
+		t.Error("error is expected")
+		t.FailNow()
+	}
+	if _, err := client.Do("PING"); err != nil {
+		t.Error("connection must survive an error reply")
+		t.FailNow()
+	}
+}
+
+func TestServer_Close(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+
+	client := New(server.Addr(), time.Second)
+	defer client.Close()
+
+	if _, err := client.Do("PING"); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	_ = server.Close()
+	if _, err := client.Do("PING"); err == nil {
+		t.Error("error is expected")
+		t.FailNow()
+	}
+}
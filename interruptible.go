@@ -1,6 +1,9 @@
 package locker
 
-import "github.com/kamilsk/locker/internal"
+import (
+	"sync"
+	"time"
+)
 
 // Interruptible returns a new instance of safe interruptible mutex.
 //
@@ -16,21 +19,44 @@ import "github.com/kamilsk/locker/internal"
 //  	// only one goroutine can be here one moment in time
 //  }
 //
-func Interruptible() *ilock {
-	lock := make(ilock, 1)
-	return &lock
+func Interruptible(options ...InterruptibleOption) *InterruptibleLock {
+	lock := &InterruptibleLock{signal: make(chan struct{}, 1)}
+	for _, option := range options {
+		option(lock)
+	}
+	return lock
+}
+
+// InterruptibleOption configures the interruptible mutex.
+type InterruptibleOption func(*InterruptibleLock)
+
+// InterruptibleWithHolder enables tracking of the owner of the mutex
+// reported by the Holder method. It reads the clock and takes a guard
+// on each Lock and Unlock, so it is disabled by default.
+func InterruptibleWithHolder() InterruptibleOption {
+	return func(lock *InterruptibleLock) { lock.track = true }
 }
 
-type ilock chan struct{}
+// An InterruptibleLock is the mutex which waiting can be interrupted
+// by the Breaker, see Interruptible.
+type InterruptibleLock struct {
+	signal chan struct{}
+	track  bool
+
+	mu     sync.Mutex
+	holder Holder
+	seq    uint64 // the number of the current holding
+}
 
 // Lock takes an exclusive lock. If the lock is already in use,
 // the calling goroutine blocks until the mutex is available or
 // an error occurred, e.g. if the Breaker is done.
-func (lock *ilock) Lock(breaker internal.Breaker) error {
+func (lock *InterruptibleLock) Lock(breaker Breaker) error {
 	select {
 	case <-breaker.Done():
 		return Interrupted
-	case *lock <- struct{}{}:
+	case lock.signal <- struct{}{}:
+		lock.hold(breaker)
 		return nil
 	}
 }
@@ -38,9 +64,10 @@ func (lock *ilock) Lock(breaker internal.Breaker) error {
 // TryLock is a fail-fast version of the Lock method.
 // It returns true if the mutex is locked by the calling goroutine
 // or false otherwise.
-func (lock *ilock) TryLock() bool {
+func (lock *InterruptibleLock) TryLock() bool {
 	select {
-	case *lock <- struct{}{}:
+	case lock.signal <- struct{}{}:
+		lock.hold(nil)
 		return true
 	default:
 		return false
@@ -67,22 +94,73 @@ func (lock *ilock) TryLock() bool {
 //  	}
 //  }
 //
-func (lock *ilock) Unlock(breaker internal.Breaker) error {
+func (lock *InterruptibleLock) Unlock(breaker Breaker) error {
+	holding := lock.current()
 	select {
 	case <-breaker.Done():
 		return InvalidIntent
-	case <-*lock:
+	case <-lock.signal:
+		lock.forget(holding)
 		return nil
 	}
 }
 
 // MustUnlock is a fail-fast version of the Unlock method.
 // It is a runtime error if the mutex is not locked on entry to Unlock.
-func (lock *ilock) MustUnlock() {
+func (lock *InterruptibleLock) MustUnlock() {
+	holding := lock.current()
 	select {
-	case <-*lock:
+	case <-lock.signal:
+		lock.forget(holding)
 		return
 	default:
 		panic(CriticalIssue)
 	}
 }
+
+// Holder returns the current owner of the mutex or the zero Holder
+// if the mutex is not locked or it doesn't track its owner,
+// see InterruptibleWithHolder.
+func (lock *InterruptibleLock) Holder() Holder {
+	if !lock.track {
+		return Holder{}
+	}
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return lock.holder
+}
+
+// current returns the number of the current holding.
+func (lock *InterruptibleLock) current() uint64 {
+	if !lock.track {
+		return 0
+	}
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return lock.seq
+}
+
+func (lock *InterruptibleLock) hold(breaker Breaker) {
+	if !lock.track {
+		return
+	}
+	holder := Holder{ID: identify(breaker), Since: time.Now()}
+	lock.mu.Lock()
+	lock.holder = holder
+	lock.seq++
+	lock.mu.Unlock()
+}
+
+// forget clears the holder if the holding is still the same,
+// so it doesn't erase the next owner which took the mutex
+// right after its release.
+func (lock *InterruptibleLock) forget(holding uint64) {
+	if !lock.track {
+		return
+	}
+	lock.mu.Lock()
+	if lock.seq == holding {
+		lock.holder = Holder{}
+	}
+	lock.mu.Unlock()
+}
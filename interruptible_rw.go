@@ -0,0 +1,237 @@
+package locker
+
+import "sync"
+
+// Preference defines who goes first when readers and writers
+// of the reader/writer mutex compete for it.
+type Preference uint8
+
+const (
+	// PreferWriters blocks new readers while a writer waits,
+	// so the writer can't be starved by a stream of readers.
+	PreferWriters Preference = iota
+	// PreferReaders lets new readers in while the mutex is not locked
+	// by a writer. It gives a better throughput to read-mostly workloads,
+	// but a writer can wait forever while readers overlap.
+	PreferReaders
+)
+
+// InterruptibleRW returns a new instance of safe interruptible
+// reader/writer mutex. The mutex can be held by many readers
+// or by a single writer. By default, writers are preferred.
+//
+//  lock := locker.InterruptibleRW()
+//
+//  var handler http.HandlerFunc = func(rw http.ResponseWriter, req *http.Request) {
+//  	if err := lock.RLock(req.Context()); err != nil {
+//  		http.Error(rw, http.StatusText(http.StatusRequestTimeout), http.StatusRequestTimeout)
+//  		return
+//  	}
+//  	defer lock.MustRUnlock()
+//  	// critical section with shared lock protection
+//  	// many goroutines can read here one moment in time
+//  }
+//
+func InterruptibleRW(options ...InterruptibleRWOption) *InterruptibleRWLock {
+	lock := &InterruptibleRWLock{}
+	for _, option := range options {
+		option(lock)
+	}
+	return lock
+}
+
+// InterruptibleRWOption configures the interruptible reader/writer mutex.
+type InterruptibleRWOption func(*InterruptibleRWLock)
+
+// InterruptibleRWWithPreference sets up the policy
+// of competition between readers and writers.
+func InterruptibleRWWithPreference(policy Preference) InterruptibleRWOption {
+	return func(lock *InterruptibleRWLock) { lock.policy = policy }
+}
+
+// An InterruptibleRWLock is the reader/writer mutex which waiting
+// can be interrupted by the Breaker, see InterruptibleRW.
+type InterruptibleRWLock struct {
+	policy Preference
+
+	mu      sync.Mutex
+	writer  bool
+	readers int
+	waiting int
+	signal  chan struct{}
+}
+
+// Lock takes an exclusive lock. If the lock is already in use,
+// the calling goroutine blocks until the mutex is available or
+// an error occurred, e.g. if the Breaker is done.
+// If writers are preferred, new readers are blocked while it waits.
+func (lock *InterruptibleRWLock) Lock(breaker Breaker) error {
+	waiting := false
+	for {
+		lock.mu.Lock()
+		if !lock.writer && lock.readers == 0 {
+			lock.writer = true
+			if waiting {
+				lock.waiting--
+			}
+			lock.mu.Unlock()
+			return nil
+		}
+		if !waiting {
+			waiting = true
+			lock.waiting++
+		}
+		signal := lock.wait()
+		lock.mu.Unlock()
+
+		select {
+		case <-breaker.Done():
+			lock.mu.Lock()
+			lock.waiting--
+			// readers blocked by the writer could go on
+			lock.broadcast()
+			lock.mu.Unlock()
+			return Interrupted
+		case <-signal:
+			// potentially the mutex is available
+		}
+	}
+}
+
+// TryLock is a fail-fast version of the Lock method.
+// It returns true if the mutex is locked by the calling goroutine
+// or false otherwise.
+func (lock *InterruptibleRWLock) TryLock() bool {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.writer || lock.readers > 0 {
+		return false
+	}
+	lock.writer = true
+	return true
+}
+
+// Unlock releases an exclusive lock. It returns InvalidIntent
+// if the mutex is not locked by a writer on entry to Unlock.
+// The release never blocks, so the Breaker is never used.
+func (lock *InterruptibleRWLock) Unlock(Breaker) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if !lock.writer {
+		return InvalidIntent
+	}
+	lock.writer = false
+	lock.broadcast()
+	return nil
+}
+
+// MustUnlock is a fail-fast version of the Unlock method.
+// It is a runtime error if the mutex is not locked by a writer
+// on entry to MustUnlock.
+func (lock *InterruptibleRWLock) MustUnlock() {
+	if err := lock.Unlock(nil); err != nil {
+		panic(CriticalIssue)
+	}
+}
+
+// RLock takes a shared lock. If the mutex is locked by a writer
+// or, when writers are preferred, a writer waits for it,
+// the calling goroutine blocks until the mutex is available or
+// an error occurred, e.g. if the Breaker is done.
+func (lock *InterruptibleRWLock) RLock(breaker Breaker) error {
+	for {
+		lock.mu.Lock()
+		if lock.readable() {
+			lock.readers++
+			lock.mu.Unlock()
+			return nil
+		}
+		signal := lock.wait()
+		lock.mu.Unlock()
+
+		select {
+		case <-breaker.Done():
+			return Interrupted
+		case <-signal:
+			// potentially the mutex is available
+		}
+	}
+}
+
+// TryRLock is a fail-fast version of the RLock method.
+// It returns true if the calling goroutine has got the shared lock
+// or false otherwise.
+func (lock *InterruptibleRWLock) TryRLock() bool {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if !lock.readable() {
+		return false
+	}
+	lock.readers++
+	return true
+}
+
+// RUnlock releases a single shared lock. It returns InvalidIntent
+// if the mutex is not locked by a reader on entry to RUnlock.
+// The release never blocks, so the Breaker is never used.
+func (lock *InterruptibleRWLock) RUnlock(Breaker) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.readers == 0 {
+		return InvalidIntent
+	}
+	lock.readers--
+	if lock.readers == 0 {
+		lock.broadcast()
+	}
+	return nil
+}
+
+// MustRUnlock is a fail-fast version of the RUnlock method.
+// It is a runtime error if the mutex is not locked by a reader
+// on entry to MustRUnlock.
+func (lock *InterruptibleRWLock) MustRUnlock() {
+	if err := lock.RUnlock(nil); err != nil {
+		panic(CriticalIssue)
+	}
+}
+
+// RLocker returns a Locker interface that implements
+// the Lock and Unlock methods by calling RLock and RUnlock.
+func (lock *InterruptibleRWLock) RLocker() Locker {
+	return (*rlocker)(lock)
+}
+
+// readable returns true if a new reader can take the mutex.
+// It must be called under the guard.
+func (lock *InterruptibleRWLock) readable() bool {
+	return !lock.writer && (lock.policy == PreferReaders || lock.waiting == 0)
+}
+
+// wait returns the channel closed on the next change of the state.
+// It must be called under the guard.
+func (lock *InterruptibleRWLock) wait() <-chan struct{} {
+	if lock.signal == nil {
+		lock.signal = make(chan struct{})
+	}
+	return lock.signal
+}
+
+// broadcast wakes up all waiters to check the state again.
+// It must be called under the guard.
+func (lock *InterruptibleRWLock) broadcast() {
+	if lock.signal != nil {
+		close(lock.signal)
+		lock.signal = nil
+	}
+}
+
+type rlocker InterruptibleRWLock
+
+func (lock *rlocker) Lock(breaker Breaker) error {
+	return (*InterruptibleRWLock)(lock).RLock(breaker)
+}
+
+func (lock *rlocker) Unlock(breaker Breaker) error {
+	return (*InterruptibleRWLock)(lock).RUnlock(breaker)
+}
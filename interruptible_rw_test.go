@@ -0,0 +1,202 @@
+package locker_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+)
+
+func ExampleInterruptibleRW() {
+	config, lock := map[string]string{"mode": "read"}, InterruptibleRW()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+	for range make([]struct{}, 3) {
+		go func() {
+			defer wg.Done()
+			if err := lock.RLock(ctx); err != nil {
+				return
+			}
+			defer lock.MustRUnlock()
+			// many goroutines can read here one moment in time
+			_ = config["mode"]
+		}()
+	}
+	wg.Wait()
+
+	if err := lock.Lock(ctx); err != nil {
+		return
+	}
+	config["mode"] = "write"
+	lock.MustUnlock()
+
+	fmt.Println(config["mode"])
+	// output: write
+}
+
+func TestInterruptibleRW(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	t.Run("readers share the mutex", func(t *testing.T) {
+		lock := InterruptibleRW()
+		if err := lock.RLock(ctx); err != nil || !lock.TryRLock() {
+			t.Error("shared lock is expected")
+			t.FailNow()
+		}
+		if lock.TryLock() {
+			t.Error("unexpected exclusive lock")
+			t.FailNow()
+		}
+		if err := lock.Lock(breaker.BreakByContext(context.WithTimeout(ctx, time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		lock.MustRUnlock()
+		lock.MustRUnlock()
+		if !lock.TryLock() {
+			t.Error("exclusive lock is expected")
+			t.FailNow()
+		}
+		if lock.TryRLock() || lock.RLock(breaker.BreakByContext(context.WithTimeout(ctx, time.Millisecond))) != Interrupted {
+			t.Error("unexpected shared lock")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+
+	t.Run("prefer writers", func(t *testing.T) {
+		lock := InterruptibleRW(InterruptibleRWWithPreference(PreferWriters))
+		if !lock.TryRLock() {
+			t.Error("shared lock is expected")
+			t.FailNow()
+		}
+		writer := breaker.BreakByContext(context.WithCancel(ctx))
+		locked := make(chan error, 1)
+		go func() { locked <- lock.Lock(writer) }()
+		for lock.TryRLock() {
+			lock.MustRUnlock()
+			time.Sleep(time.Millisecond)
+		}
+
+		// the writer is canceled, so the readers can go on
+		writer.Close()
+		if err := <-locked; err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := lock.RLock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		lock.MustRUnlock()
+
+		go func() { locked <- lock.Lock(ctx) }()
+		for lock.TryRLock() {
+			lock.MustRUnlock()
+			time.Sleep(time.Millisecond)
+		}
+		lock.MustRUnlock()
+		if err := <-locked; err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+
+	t.Run("prefer readers", func(t *testing.T) {
+		lock := InterruptibleRW(InterruptibleRWWithPreference(PreferReaders))
+		if !lock.TryRLock() {
+			t.Error("shared lock is expected")
+			t.FailNow()
+		}
+		locked := make(chan error, 1)
+		go func() { locked <- lock.Lock(ctx) }()
+		for range make([]struct{}, 10) {
+			if !lock.TryRLock() {
+				t.Error("shared lock is expected")
+				t.FailNow()
+			}
+			lock.MustRUnlock()
+		}
+		lock.MustRUnlock()
+		if err := <-locked; err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+
+	t.Run("try to unlock not-locked mutex", func(t *testing.T) {
+		lock := InterruptibleRW()
+		if err := lock.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := lock.RUnlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		for _, unlock := range []func(){lock.MustUnlock, lock.MustRUnlock} {
+			func() {
+				defer func() {
+					if r := recover(); r != CriticalIssue {
+						t.Error("panic with CriticalIssue is expected")
+					}
+				}()
+				unlock()
+			}()
+		}
+	})
+
+	t.Run("read locker", func(t *testing.T) {
+		lock := InterruptibleRW()
+		var locker Locker = lock.RLocker()
+		if err := locker.Lock(ctx); err != nil || lock.TryLock() {
+			t.Error("shared lock is expected")
+			t.FailNow()
+		}
+		if err := locker.Unlock(ctx); err != nil || !lock.TryLock() {
+			t.Error("shared lock must be released")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+	})
+}
+
+func TestInterruptibleRW_StressTest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	lock := InterruptibleRW()
+	if *stress {
+		wg := sync.WaitGroup{}
+		for i := range make([]struct{}, 1000) {
+			wg.Add(1)
+			go func(exclusive bool) {
+				defer wg.Done()
+				take, release := lock.RLock, lock.RUnlock
+				if exclusive {
+					take, release = lock.Lock, lock.Unlock
+				}
+				if err := take(ctx); err != nil {
+					t.Error("unexpected error")
+					return
+				}
+				if err := release(ctx); err != nil {
+					t.Error("unexpected error")
+					return
+				}
+			}(i%10 == 0)
+		}
+		wg.Wait()
+	}
+}
@@ -10,7 +10,7 @@ import (
 	"time"
 
 	. "github.com/kamilsk/locker"
-	"github.com/kamilsk/locker/internal"
+	"github.com/kamilsk/locker/breaker"
 )
 
 func ExampleInterruptible() {
@@ -88,9 +88,9 @@ func TestInterruptible(t *testing.T) {
 				t.Error("lock is expected")
 				t.FailNow()
 			}
-			breaker := Wrap(context.WithCancel(ctx))
-			breaker.Close()
-			if err := lock.Unlock(breaker); err != nil {
+			br := breaker.BreakByContext(context.WithCancel(ctx))
+			br.Close()
+			if err := lock.Unlock(br); err != nil {
 				if err != InvalidIntent {
 					lock.MustUnlock()
 					t.Error("unexpected error value")
@@ -110,12 +110,12 @@ func TestInterruptible(t *testing.T) {
 			t.FailNow()
 		}
 		for range make([]struct{}, 10) {
-			if err := lock.Lock(Wrap(context.WithTimeout(ctx, time.Millisecond))); err != Interrupted {
+			if err := lock.Lock(breaker.BreakByContext(context.WithTimeout(ctx, time.Millisecond))); err != Interrupted {
 				t.Error("unexpected error value")
 				t.FailNow()
 			}
 		}
-		if err := lock.Unlock(Wrap(context.WithTimeout(ctx, time.Millisecond))); err != nil {
+		if err := lock.Unlock(breaker.BreakByContext(context.WithTimeout(ctx, time.Millisecond))); err != nil {
 			t.Error("unexpected error")
 			t.FailNow()
 		}
@@ -132,28 +132,40 @@ func TestInterruptible_StressTest(t *testing.T) {
 		for range make([]struct{}, 1000) {
 			wg.Add(1)
 			go func() {
+				defer wg.Done()
 				if err := lock.Lock(ctx); err != nil {
 					t.Error("unexpected error")
-					t.FailNow()
+					return
 				}
 				if err := lock.Unlock(ctx); err != nil {
 					t.Error("unexpected error")
-					t.FailNow()
+					return
 				}
-				wg.Done()
 			}()
 		}
 		wg.Wait()
 	}
 }
 
-// BenchmarkInterruptible/interruptible_locker-4         	 7418108	       156 ns/op	       0 B/op	       0 allocs/op
-// BenchmarkInterruptible/built-in_locker-4              	68697568	        17.1 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkInterruptible/interruptible_locker-4                	12859989	       103 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkInterruptible/interruptible_locker_with_holder-4    	 4444536	       270 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkInterruptible/built-in_locker-4                     	62427486	        19.0 ns/op	       0 B/op	       0 allocs/op
 func BenchmarkInterruptible(b *testing.B) {
 	ctx := context.Background()
 
 	b.Run("interruptible locker", func(b *testing.B) {
-		var lock internal.Locker = Interruptible()
+		var lock Locker = Interruptible()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = lock.Lock(ctx)
+			_ = lock.Unlock(ctx)
+		}
+	})
+
+	b.Run("interruptible locker with holder", func(b *testing.B) {
+		var lock Locker = Interruptible(InterruptibleWithHolder())
 
 		b.ReportAllocs()
 		b.ResetTimer()
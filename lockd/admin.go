@@ -0,0 +1,61 @@
+package lockd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// NewAdmin returns a new client to inspect and force-release resources
+// held on the lock server by the endpoint. It doesn't open a session.
+// If the http client is nil, the http.DefaultClient is used.
+//
+//  admin := lockd.NewAdmin("http://127.0.0.1:8080", &http.Client{Timeout: 5 * time.Second})
+//  locks, err := admin.Locks(ctx, "jobs:")
+//  if err != nil {
+//  	return err
+//  }
+//  for _, lock := range locks {
+//  	if time.Since(lock.Since) > time.Hour {
+//  		_ = admin.Release(ctx, lock)
+//  	}
+//  }
+//
+func NewAdmin(endpoint string, client *http.Client) *Admin {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Admin{endpoint: strings.TrimRight(endpoint, "/"), http: client}
+}
+
+// Admin is a client to manage resources held on the lock server.
+type Admin struct {
+	endpoint string
+	http     *http.Client
+}
+
+// Locks returns the resources held by all sessions
+// with names starting with the prefix.
+func (admin *Admin) Locks(ctx context.Context, prefix string) ([]Lock, error) {
+	var response locksResponse
+	if err := call(ctx, admin.http, admin.endpoint+"/v1/locks", locksRequest{Prefix: prefix}, &response); err != nil {
+		return nil, err
+	}
+	return response.Locks, nil
+}
+
+// Release releases the resource on behalf of its session.
+// It returns the InvalidIntent error if the resource is already released
+// or SessionLost if its session has expired.
+func (admin *Admin) Release(ctx context.Context, lock Lock) error {
+	var response lockResponse
+	request := lockRequest{Session: lock.Session, Token: lock.Token}
+	return call(ctx, admin.http, admin.endpoint+"/v1/release", request, &response)
+}
+
+// Extend renews the session of the resource for its ttl
+// as the heartbeat of its client does.
+func (admin *Admin) Extend(ctx context.Context, lock Lock) error {
+	var response sessionResponse
+	return call(ctx, admin.http, admin.endpoint+"/v1/session/keepalive", sessionRequest{Session: lock.Session}, &response)
+}
@@ -0,0 +1,399 @@
+package lockd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/internal"
+)
+
+// Dial opens a new session on the lock server by the endpoint
+// and renews it in background until the Close method is called.
+// Everything taken through the client is bound to the session,
+// so it is released by the server if the client has crashed.
+//
+//  client, err := lockd.Dial("http://127.0.0.1:8080", lockd.DialWithTTL(10*time.Second))
+//  if err != nil {
+//  	return err
+//  }
+//  defer client.Close()
+//
+//  lock := client.Mutex("jobs:cleanup")
+//  if err := lock.Lock(ctx); err != nil {
+//  	return err
+//  }
+//  defer lock.Unlock(context.Background())
+//  // critical section with lock protection
+//  // only one process can be here one moment in time
+//
+func Dial(endpoint string, options ...DialOption) (*Client, error) {
+	client := &Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		http:     http.DefaultClient,
+		ttl:      10 * time.Second,
+		poll:     10 * time.Second,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, option := range options {
+		option(client)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), client.ttl)
+	defer cancel()
+	var response sessionResponse
+	request := sessionRequest{TTL: int64(client.ttl / time.Millisecond)}
+	if err := client.call(ctx, "/v1/session/open", request, &response); err != nil {
+		return nil, err
+	}
+	client.session, client.ttl = response.Session, time.Duration(response.TTL)*time.Millisecond
+	go client.keepAlive()
+	return client, nil
+}
+
+// DialOption configures the client of the lock server.
+type DialOption func(*Client)
+
+// DialWithTTL sets up the ttl of the session. The session is renewed
+// three times per its ttl, and the server releases everything
+// it holds if there was no renewal during the ttl.
+func DialWithTTL(ttl time.Duration) DialOption {
+	return func(client *Client) { client.ttl = ttl }
+}
+
+// DialWithPoll sets up the duration of a single long-poll request
+// to take a lock. The server may shorten it.
+func DialWithPoll(interval time.Duration) DialOption {
+	return func(client *Client) { client.poll = interval }
+}
+
+// DialWithHTTPClient sets up the client used to make requests.
+// Its timeout should be greater than the poll duration.
+func DialWithHTTPClient(http *http.Client) DialOption {
+	return func(client *Client) { client.http = http }
+}
+
+// Client is a session on the lock server.
+type Client struct {
+	endpoint string
+	http     *http.Client
+	ttl      time.Duration
+	poll     time.Duration
+	session  string
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Done returns a channel that's closed when the session is lost
+// or closed, so everything taken through the client is released.
+func (client *Client) Done() <-chan struct{} {
+	return client.done
+}
+
+// Close stops the session renewal and closes it on the server,
+// so everything taken through the client is released.
+func (client *Client) Close() error {
+	closed := false
+	client.once.Do(func() {
+		close(client.stop)
+		closed = true
+	})
+	if !closed {
+		return SessionLost
+	}
+	<-client.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), client.ttl)
+	defer cancel()
+	var response sessionResponse
+	return client.call(ctx, "/v1/session/close", sessionRequest{Session: client.session}, &response)
+}
+
+// Mutex returns the interruptible mutex by the name hosted by the server.
+func (client *Client) Mutex(name string) *Mutex {
+	return &Mutex{client: client, request: lockRequest{Kind: kindMutex, Name: name}}
+}
+
+// Set returns the set of interruptible mutexes by the name hosted
+// by the server. The capacity must be the same for all clients.
+func (client *Client) Set(name string, capacity uint) *MutexSet {
+	return &MutexSet{client: client, name: name, capacity: uint32(capacity)}
+}
+
+// Limited returns the semaphore by the name hosted by the server.
+// The capacity must be the same for all clients.
+func (client *Client) Limited(name string, capacity uint) *Semaphore {
+	return &Semaphore{client: client, request: lockRequest{Kind: kindSemaphore, Name: name, Capacity: uint32(capacity)}}
+}
+
+func (client *Client) keepAlive() {
+	defer close(client.done)
+
+	interval := client.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-client.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		var response sessionResponse
+		err := client.call(ctx, "/v1/session/keepalive", sessionRequest{Session: client.session}, &response)
+		cancel()
+		switch {
+		case err == nil:
+			renewed = time.Now()
+		case err == SessionLost, time.Since(renewed) >= client.ttl:
+			client.once.Do(func() { close(client.stop) })
+			return
+		}
+	}
+}
+
+// acquire takes the resource by the request for the token.
+// It repeats long-poll requests until the resource is taken
+// or the Breaker is done.
+func (client *Client) acquire(breaker locker.Breaker, request lockRequest) error {
+	ctx, cancel := internal.Context(breaker)
+	defer cancel()
+
+	request.Session, request.Wait = client.session, int64(client.poll/time.Millisecond)
+	for {
+		var response lockResponse
+		err := client.call(ctx, "/v1/acquire", request, &response)
+		if err == nil && response.Acquired {
+			return nil
+		}
+		select {
+		case <-breaker.Done():
+			err = locker.Interrupted
+		default:
+		}
+		if err != nil {
+			// the resource could be taken right before the interruption
+			// or the failure, e.g. if only the response is lost
+			_, _ = client.release(context.Background(), lockRequest{Token: request.Token})
+			return err
+		}
+	}
+}
+
+// try takes the resource by the request for the token without waiting.
+func (client *Client) try(request lockRequest) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), client.ttl)
+	defer cancel()
+
+	request.Session = client.session
+	var response lockResponse
+	if err := client.call(ctx, "/v1/acquire", request, &response); err != nil {
+		// the resource could be taken if only the response is lost
+		_, _ = client.release(context.Background(), lockRequest{Token: request.Token})
+		return false
+	}
+	return response.Acquired
+}
+
+// release releases the resource by the token or the weight.
+func (client *Client) release(breaker locker.Breaker, request lockRequest) (uint32, error) {
+	ctx, cancel := internal.Context(breaker)
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, client.ttl)
+	defer cancel()
+
+	request.Session = client.session
+	var response lockResponse
+	if err := client.call(ctx, "/v1/release", request, &response); err != nil {
+		return 0, err
+	}
+	return response.Count, nil
+}
+
+func (client *Client) call(ctx context.Context, path string, request, response interface{}) error {
+	return call(ctx, client.http, client.endpoint+path, request, response)
+}
+
+// call posts the request to the url and decodes the response.
+func call(ctx context.Context, client *http.Client, url string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	raw, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer raw.Body.Close()
+
+	switch raw.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(raw.Body).Decode(response)
+	case http.StatusNotFound:
+		return SessionLost
+	case http.StatusConflict:
+		return locker.InvalidIntent
+	}
+	message, _ := ioutil.ReadAll(raw.Body)
+	return fmt.Errorf("lockd: unexpected status %q: %s", raw.Status, strings.TrimSpace(string(message)))
+}
+
+// A Mutex is the interruptible mutex hosted by the server, see Client.Mutex.
+type Mutex struct {
+	client  *Client
+	request lockRequest
+
+	mu    sync.Mutex
+	token string
+}
+
+// Lock takes an exclusive lock. If the lock is already in use,
+// the calling goroutine blocks until the mutex is available or
+// an error occurred, e.g. if the Breaker is done or the session is lost.
+func (lock *Mutex) Lock(breaker locker.Breaker) error {
+	request := lock.request
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	request.Token = token
+	if err := lock.client.acquire(breaker, request); err != nil {
+		return err
+	}
+	lock.mu.Lock()
+	lock.token = token
+	lock.mu.Unlock()
+	return nil
+}
+
+// TryLock is a fail-fast version of the Lock method.
+// It returns true if the mutex is locked by the calling goroutine
+// or false otherwise.
+func (lock *Mutex) TryLock() bool {
+	request := lock.request
+	token, err := newToken()
+	if err != nil {
+		return false
+	}
+	request.Token = token
+	if !lock.client.try(request) {
+		return false
+	}
+	lock.mu.Lock()
+	lock.token = token
+	lock.mu.Unlock()
+	return true
+}
+
+// Unlock releases an exclusive lock. It returns InvalidIntent
+// if the mutex is not locked on entry to Unlock. If the Breaker
+// is done or the server is unavailable, the lock is still held
+// until the session is lost, so the call could be repeated.
+func (lock *Mutex) Unlock(breaker locker.Breaker) error {
+	lock.mu.Lock()
+	token := lock.token
+	lock.token = ""
+	lock.mu.Unlock()
+	if token == "" {
+		return locker.InvalidIntent
+	}
+
+	_, err := lock.client.release(breaker, lockRequest{Token: token})
+	if err != nil && err != locker.InvalidIntent && err != SessionLost {
+		lock.mu.Lock()
+		lock.token = token
+		lock.mu.Unlock()
+	}
+	return err
+}
+
+// A MutexSet is the set of mutexes hosted by the server, see Client.Set.
+type MutexSet struct {
+	client   *Client
+	name     string
+	capacity uint32
+}
+
+// ByKey returns the mutex associated with the key.
+func (c *MutexSet) ByKey(key string) *Mutex {
+	return &Mutex{
+		client:  c.client,
+		request: lockRequest{Kind: kindSet, Name: c.name, Key: key, Capacity: c.capacity},
+	}
+}
+
+// A Semaphore is the semaphore hosted by the server, see Client.Limited.
+type Semaphore struct {
+	client  *Client
+	request lockRequest
+}
+
+// Lock takes all slots of the semaphore.
+func (lock *Semaphore) Lock(breaker locker.Breaker) error {
+	return lock.Acquire(breaker, lock.request.Capacity)
+}
+
+// Unlock releases all slots of the semaphore.
+func (lock *Semaphore) Unlock(locker.Breaker) error {
+	_, err := lock.Release(lock.request.Capacity)
+	return err
+}
+
+// Acquire takes the slots of the semaphore. If they are not available,
+// the calling goroutine blocks until they are or an error occurred,
+// e.g. if the Breaker is done or the session is lost.
+func (lock *Semaphore) Acquire(breaker locker.Breaker, slot uint32) error {
+	if slot == 0 {
+		return locker.InvalidIntent
+	}
+	request := lock.request
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	request.Token, request.Weight = token, slot
+	return lock.client.acquire(breaker, request)
+}
+
+// TryAcquire is a fail-fast version of the Acquire method.
+func (lock *Semaphore) TryAcquire(slot uint32) bool {
+	if slot == 0 {
+		return false
+	}
+	request := lock.request
+	token, err := newToken()
+	if err != nil {
+		return false
+	}
+	request.Token, request.Weight = token, slot
+	return lock.client.try(request)
+}
+
+// Release releases the slots taken through the client and returns
+// the number of taken slots before the release. It returns InvalidIntent
+// if the client holds fewer slots.
+func (lock *Semaphore) Release(slot uint32) (uint32, error) {
+	if slot == 0 {
+		return 0, nil
+	}
+	request := lock.request
+	request.Weight = slot
+	return lock.client.release(context.Background(), request)
+}
@@ -0,0 +1,311 @@
+package lockd_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kamilsk/locker"
+	. "github.com/kamilsk/locker/lockd"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(NewServer())
+	defer server.Close()
+
+	dial := func(options ...DialOption) *Client {
+		client, err := Dial(server.URL, append([]DialOption{DialWithPoll(20 * time.Millisecond)}, options...)...)
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		return client
+	}
+
+	t.Run("interfaces", func(t *testing.T) {
+		client := dial()
+		defer client.Close()
+
+		var _ locker.FastLocker = client.Mutex("mutex")
+		var _ locker.FastLocker = client.Set("set", 4).ByKey("key")
+		var _ locker.Locker = client.Limited("semaphore", 4)
+		var _ locker.FastSemaphore = client.Limited("semaphore", 4)
+
+		// the returned types can be named in signatures of the caller
+		var _ *Mutex = client.Mutex("mutex")
+		var _ *MutexSet = client.Set("set", 4)
+		var _ *Semaphore = client.Limited("semaphore", 4)
+	})
+
+	t.Run("mutex", func(t *testing.T) {
+		alice, bob := dial(), dial()
+		defer alice.Close()
+		defer bob.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		lock := alice.Mutex("mutex")
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("the lock must be taken")
+			t.FailNow()
+		}
+		if bob.Mutex("mutex").TryLock() {
+			t.Error("the lock must be held by another client")
+			t.FailNow()
+		}
+
+		short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancelShort()
+		if err := bob.Mutex("mutex").Lock(short); err != locker.Interrupted {
+			t.Errorf("unexpected error %v", err)
+			t.FailNow()
+		}
+
+		taken := make(chan error, 1)
+		go func() { taken <- bob.Mutex("mutex").Lock(ctx) }()
+		time.Sleep(20 * time.Millisecond)
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("the lock must be released")
+			t.FailNow()
+		}
+		if err := <-taken; err != nil {
+			t.Error("the lock must be taken after release")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != locker.InvalidIntent {
+			t.Error("the lock must not be released twice")
+			t.FailNow()
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		alice, bob := dial(), dial()
+		defer alice.Close()
+		defer bob.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		lock := alice.Set("set", 4).ByKey("key")
+		if !lock.TryLock() {
+			t.Error("the lock must be taken")
+			t.FailNow()
+		}
+		if bob.Set("set", 4).ByKey("key").TryLock() {
+			t.Error("the lock by the same key must be held by another client")
+			t.FailNow()
+		}
+		if bob.Set("set", 8).ByKey("key").TryLock() {
+			t.Error("the set with another capacity must not be used")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("the lock must be released")
+			t.FailNow()
+		}
+		if !bob.Set("set", 4).ByKey("key").TryLock() {
+			t.Error("the lock must be taken after release")
+			t.FailNow()
+		}
+	})
+
+	t.Run("semaphore", func(t *testing.T) {
+		alice, bob := dial(), dial()
+		defer alice.Close()
+		defer bob.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		sema := alice.Limited("semaphore", 3)
+		if err := sema.Acquire(ctx, 1); err != nil {
+			t.Error("the slot must be taken")
+			t.FailNow()
+		}
+		if !sema.TryAcquire(1) {
+			t.Error("the slot must be taken")
+			t.FailNow()
+		}
+		if bob.Limited("semaphore", 3).TryAcquire(2) {
+			t.Error("the slots must not be taken over the capacity")
+			t.FailNow()
+		}
+		if !bob.Limited("semaphore", 3).TryAcquire(1) {
+			t.Error("the last slot must be taken")
+			t.FailNow()
+		}
+		if _, err := bob.Limited("semaphore", 3).Release(2); err != locker.InvalidIntent {
+			t.Error("the slots taken by another client must not be released")
+			t.FailNow()
+		}
+		if count, err := sema.Release(2); err != nil || count != 3 {
+			t.Errorf("unexpected count %d and error %v", count, err)
+			t.FailNow()
+		}
+		if err := bob.Limited("semaphore", 3).Acquire(ctx, 2); err != nil {
+			t.Error("the released slots must be taken")
+			t.FailNow()
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		alice, bob := dial(), dial()
+		defer bob.Close()
+
+		if !alice.Mutex("close").TryLock() {
+			t.Error("the lock must be taken")
+			t.FailNow()
+		}
+		if err := alice.Close(); err != nil {
+			t.Error("the session must be closed")
+			t.FailNow()
+		}
+		if err := alice.Close(); err != SessionLost {
+			t.Error("the session must not be closed twice")
+			t.FailNow()
+		}
+		if !bob.Mutex("close").TryLock() {
+			t.Error("the lock must be released with the session")
+			t.FailNow()
+		}
+	})
+
+	t.Run("crash", func(t *testing.T) {
+		network := &transport{}
+		alice := dial(DialWithTTL(60*time.Millisecond), DialWithHTTPClient(&http.Client{Transport: network}))
+		bob := dial()
+		defer bob.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if !alice.Mutex("crash").TryLock() {
+			t.Error("the lock must be taken")
+			t.FailNow()
+		}
+		time.Sleep(100 * time.Millisecond)
+		if bob.Mutex("crash").TryLock() {
+			t.Error("the lock must be held by the renewed session")
+			t.FailNow()
+		}
+
+		atomic.StoreInt32(&network.broken, 1)
+		if err := bob.Mutex("crash").Lock(ctx); err != nil {
+			t.Error("the lock must be released with the expired session")
+			t.FailNow()
+		}
+		select {
+		case <-alice.Done():
+		case <-ctx.Done():
+			t.Error("the session must be lost")
+			t.FailNow()
+		}
+
+		atomic.StoreInt32(&network.broken, 0)
+		if err := alice.Mutex("crash").Lock(ctx); err != SessionLost {
+			t.Errorf("unexpected error %v", err)
+			t.FailNow()
+		}
+	})
+
+	t.Run("lost response", func(t *testing.T) {
+		network := &transport{lossy: 1}
+		alice := dial(DialWithHTTPClient(&http.Client{Transport: network}))
+		defer alice.Close()
+		bob := dial()
+		defer bob.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := alice.Mutex("lost:lock").Lock(ctx); err == nil {
+			t.Error("the lock must not be taken without the response")
+			t.FailNow()
+		}
+		if !bob.Mutex("lost:lock").TryLock() {
+			t.Error("the hold taken without the response must be released")
+			t.FailNow()
+		}
+		if alice.Limited("lost:semaphore", 1).TryAcquire(1) {
+			t.Error("the semaphore must not be taken without the response")
+			t.FailNow()
+		}
+		if !bob.Limited("lost:semaphore", 1).TryAcquire(1) {
+			t.Error("the hold taken without the response must be released")
+			t.FailNow()
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		alice, bob := dial(), dial()
+		defer alice.Close()
+		defer bob.Close()
+		admin := NewAdmin(server.URL, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		lock := alice.Mutex("admin:mutex")
+		if !lock.TryLock() || !alice.Set("admin:set", 4).ByKey("key").TryLock() {
+			t.Error("the locks must be taken")
+			t.FailNow()
+		}
+		locks, err := admin.Locks(ctx, "admin:")
+		if err != nil || len(locks) != 2 {
+			t.Errorf("unexpected locks %+v, %v", locks, err)
+			t.FailNow()
+		}
+		for _, held := range locks {
+			if held.Since.IsZero() || held.TTL <= 0 {
+				t.Errorf("unexpected lock %+v", held)
+				t.FailNow()
+			}
+			if held.Kind != "mutex" {
+				continue
+			}
+			if err := admin.Extend(ctx, held); err != nil {
+				t.Error("the session must be renewed")
+				t.FailNow()
+			}
+			if err := admin.Release(ctx, held); err != nil {
+				t.Error("the lock must be released")
+				t.FailNow()
+			}
+			if err := admin.Release(ctx, held); err != locker.InvalidIntent {
+				t.Errorf("unexpected error %v", err)
+				t.FailNow()
+			}
+		}
+		if !bob.Mutex("admin:mutex").TryLock() {
+			t.Error("the released lock must be free")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != locker.InvalidIntent {
+			t.Errorf("unexpected error %v", err)
+			t.FailNow()
+		}
+	})
+}
+
+type transport struct {
+	broken int32
+	lossy  int32
+}
+
+func (network *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.LoadInt32(&network.broken) == 1 {
+		return nil, errors.New("connection refused")
+	}
+	response, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil && atomic.LoadInt32(&network.lossy) == 1 && req.URL.Path == "/v1/acquire" {
+		// the request is served, but its response is lost
+		_ = response.Body.Close()
+		return nil, errors.New("connection reset by peer")
+	}
+	return response, err
+}
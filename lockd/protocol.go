@@ -0,0 +1,95 @@
+package lockd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Error defines the lock server errors.
+type Error string
+
+// Error returns the string representation of the error.
+func (err Error) Error() string {
+	return string(err)
+}
+
+// SessionLost is the error related to an expired or closed session.
+// Everything held by the session is already released.
+const SessionLost Error = "lockd: session lost"
+
+const (
+	kindMutex     = "mutex"
+	kindSemaphore = "semaphore"
+	kindSet       = "set"
+)
+
+// sessionRequest describes a session, the ttl is in milliseconds.
+type sessionRequest struct {
+	Session string `json:"session,omitempty"`
+	TTL     int64  `json:"ttl,omitempty"`
+}
+
+// sessionResponse contains the session state.
+type sessionResponse struct {
+	Session string `json:"session,omitempty"`
+	TTL     int64  `json:"ttl,omitempty"`
+}
+
+// lockRequest describes an attempt to take or release a resource
+// by the token, the wait is in milliseconds.
+type lockRequest struct {
+	Session  string `json:"session"`
+	Token    string `json:"token,omitempty"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Key      string `json:"key,omitempty"`
+	Capacity uint32 `json:"capacity,omitempty"`
+	Weight   uint32 `json:"weight,omitempty"`
+	Wait     int64  `json:"wait,omitempty"`
+}
+
+// lockResponse contains the result of the attempt.
+type lockResponse struct {
+	Acquired bool   `json:"acquired,omitempty"`
+	Count    uint32 `json:"count,omitempty"`
+}
+
+// locksRequest describes a search of held resources by the name prefix.
+type locksRequest struct {
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// locksResponse contains the held resources.
+type locksResponse struct {
+	Locks []Lock `json:"locks"`
+}
+
+// Lock describes a resource or its part held by a session.
+type Lock struct {
+	// Kind is one of "mutex", "semaphore" or "set".
+	Kind string `json:"kind"`
+	// Name is the name of the resource.
+	Name string `json:"name"`
+	// Key is the key of the mutex in the set.
+	Key string `json:"key,omitempty"`
+	// Session is the id of the session which holds the resource.
+	Session string `json:"session"`
+	// Token identifies the acquisition in the session.
+	Token string `json:"token"`
+	// Weight is the number of taken slots of the semaphore.
+	Weight uint32 `json:"weight"`
+	// Since is the time when the resource was taken.
+	Since time.Time `json:"since"`
+	// TTL is the time remaining before the session expires,
+	// in milliseconds.
+	TTL int64 `json:"ttl"`
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,492 @@
+package lockd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kamilsk/locker"
+)
+
+// NewServer returns a new lock server which hosts interruptible mutexes,
+// semaphores and keyed sets of mutexes behind an HTTP/JSON API.
+// Resources are created on the first use by their names and removed
+// when nobody holds them or waits for them. Each client holds a session
+// renewed by heartbeats, so everything it holds is released if its
+// session has expired.
+//
+//	server := &http.Server{Addr: ":8080", Handler: lockd.NewServer()}
+//	log.Fatal(server.ListenAndServe())
+func NewServer(options ...ServerOption) *Server {
+	server := &Server{
+		maxWait:     30 * time.Second,
+		maxTTL:      5 * time.Minute,
+		maxCapacity: 1024,
+		sessions:    make(map[string]*session),
+		resources:   make(map[resourceKey]*resource),
+	}
+	for _, option := range options {
+		option(server)
+	}
+	return server
+}
+
+// ServerOption configures the lock server.
+type ServerOption func(*Server)
+
+// ServerWithMaxWait sets up the upper bound of a single long-poll
+// request to take a lock. Clients repeat requests until they take
+// the lock or give up, so it should be less than the write timeout
+// of the http.Server.
+func ServerWithMaxWait(wait time.Duration) ServerOption {
+	return func(server *Server) { server.maxWait = wait }
+}
+
+// ServerWithMaxTTL sets up the upper bound of the session ttl
+// requested by clients.
+func ServerWithMaxTTL(ttl time.Duration) ServerOption {
+	return func(server *Server) { server.maxTTL = ttl }
+}
+
+// ServerWithMaxCapacity sets up the upper bound of the capacity
+// of sets requested by clients. Each mutex of a set is allocated
+// on its creation, so the larger capacity is rejected.
+func ServerWithMaxCapacity(capacity uint32) ServerOption {
+	return func(server *Server) { server.maxCapacity = capacity }
+}
+
+// Server is a lock server which implements the http.Handler interface.
+type Server struct {
+	maxWait     time.Duration
+	maxTTL      time.Duration
+	maxCapacity uint32
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	resources map[resourceKey]*resource
+}
+
+type mutex interface {
+	Lock(locker.Breaker) error
+	TryLock() bool
+	MustUnlock()
+}
+
+type semaphore interface {
+	Acquire(locker.Breaker, uint32) error
+	TryAcquire(uint32) bool
+	Release(uint32) (uint32, error)
+	Limit() uint32
+}
+
+type resourceKey struct {
+	kind string
+	name string
+}
+
+// resource is a mutex, a semaphore or a set of mutexes by the name.
+// It is removed when it has no users, i.e. nobody holds it
+// or waits for it.
+type resource struct {
+	users    int
+	capacity uint32
+	mutex    mutex
+	sema     semaphore
+	byKey    func(string) mutex
+}
+
+// session is a period of the client activity, everything
+// the client holds is bound to it.
+type session struct {
+	ttl    time.Duration
+	expire time.Time
+	timer  *time.Timer
+	done   chan struct{}
+	holds  map[string]*hold
+	// tokens are reserved by pending acquisitions
+	tokens map[string]bool
+}
+
+// hold is a lock or a part of the semaphore taken by the token.
+type hold struct {
+	kind   string
+	name   string
+	key    string
+	weight uint32
+	since  time.Time
+	mutex  mutex
+	sema   semaphore
+	origin *resource
+}
+
+func (h *hold) release(weight uint32) uint32 {
+	if h.mutex != nil {
+		h.mutex.MustUnlock()
+		return 1
+	}
+	count, _ := h.sema.Release(weight)
+	return count
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (server *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		response interface{}
+		status   int
+	)
+	switch req.URL.Path {
+	case "/v1/session/open":
+		var request sessionRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response, status = server.open(request)
+	case "/v1/session/keepalive":
+		var request sessionRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response, status = server.keepAlive(request)
+	case "/v1/session/close":
+		var request sessionRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response, status = server.close(request)
+	case "/v1/acquire":
+		var request lockRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response, status = server.acquire(req.Context(), request)
+	case "/v1/release":
+		var request lockRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response, status = server.release(request)
+	case "/v1/locks":
+		var request locksRequest
+		if !decode(rw, req, &request) {
+			return
+		}
+		response, status = server.locks(request)
+	default:
+		http.NotFound(rw, req)
+		return
+	}
+	if message, is := response.(string); is {
+		http.Error(rw, message, status)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(response)
+}
+
+func (server *Server) open(request sessionRequest) (interface{}, int) {
+	ttl := time.Duration(request.TTL) * time.Millisecond
+	if ttl <= 0 {
+		return "lockd: ttl must be positive", http.StatusBadRequest
+	}
+	if server.maxTTL > 0 && ttl > server.maxTTL {
+		ttl = server.maxTTL
+	}
+
+	id, err := newToken()
+	if err != nil {
+		return err.Error(), http.StatusInternalServerError
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.sessions[id] = &session{
+		ttl:    ttl,
+		expire: time.Now().Add(ttl),
+		timer:  time.AfterFunc(ttl, func() { server.expire(id) }),
+		done:   make(chan struct{}),
+		holds:  make(map[string]*hold),
+		tokens: make(map[string]bool),
+	}
+	return sessionResponse{Session: id, TTL: int64(ttl / time.Millisecond)}, http.StatusOK
+}
+
+func (server *Server) keepAlive(request sessionRequest) (interface{}, int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	s, found := server.sessions[request.Session]
+	if !found {
+		return SessionLost.Error(), http.StatusNotFound
+	}
+	s.timer.Reset(s.ttl)
+	s.expire = time.Now().Add(s.ttl)
+	return sessionResponse{Session: request.Session, TTL: int64(s.ttl / time.Millisecond)}, http.StatusOK
+}
+
+func (server *Server) close(request sessionRequest) (interface{}, int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	s, found := server.sessions[request.Session]
+	if !found {
+		return SessionLost.Error(), http.StatusNotFound
+	}
+	s.timer.Stop()
+	server.drop(request.Session, s)
+	return sessionResponse{}, http.StatusOK
+}
+
+func (server *Server) expire(id string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if s, found := server.sessions[id]; found {
+		server.drop(id, s)
+	}
+}
+
+// drop removes the session and releases everything it holds.
+func (server *Server) drop(id string, s *session) {
+	delete(server.sessions, id)
+	close(s.done)
+	for _, h := range s.holds {
+		h.release(h.weight)
+		server.unuse(h)
+	}
+}
+
+func (server *Server) acquire(ctx context.Context, request lockRequest) (interface{}, int) {
+	if request.Token == "" {
+		return "lockd: token is required", http.StatusBadRequest
+	}
+	server.mu.Lock()
+	s, found := server.sessions[request.Session]
+	if !found {
+		server.mu.Unlock()
+		return SessionLost.Error(), http.StatusNotFound
+	}
+	if _, held := s.holds[request.Token]; held {
+		// the retry of the request which succeeded before
+		server.mu.Unlock()
+		return lockResponse{Acquired: true}, http.StatusOK
+	}
+	if s.tokens[request.Token] {
+		server.mu.Unlock()
+		return "lockd: token is used by another request", http.StatusConflict
+	}
+	h, err := server.resolve(request)
+	if err != "" {
+		server.mu.Unlock()
+		return err, http.StatusBadRequest
+	}
+	s.tokens[request.Token] = true
+	server.mu.Unlock()
+
+	wait := time.Duration(request.Wait) * time.Millisecond
+	if wait > server.maxWait {
+		wait = server.maxWait
+	}
+	var acquired bool
+	if wait <= 0 {
+		if h.mutex != nil {
+			acquired = h.mutex.TryLock()
+		} else {
+			acquired = h.sema.TryAcquire(h.weight)
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, wait)
+		go func() {
+			select {
+			case <-s.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if h.mutex != nil {
+			acquired = h.mutex.Lock(ctx) == nil
+		} else {
+			acquired = h.sema.Acquire(ctx, h.weight) == nil
+		}
+		cancel()
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	delete(s.tokens, request.Token)
+	if !acquired {
+		server.unuse(h)
+		return lockResponse{}, http.StatusOK
+	}
+	if server.sessions[request.Session] != s {
+		// the session has expired while the client was waiting
+		h.release(h.weight)
+		server.unuse(h)
+		return SessionLost.Error(), http.StatusNotFound
+	}
+	h.since = time.Now()
+	s.holds[request.Token] = h
+	return lockResponse{Acquired: true}, http.StatusOK
+}
+
+// locks returns the resources held by all sessions
+// with names starting with the prefix.
+func (server *Server) locks(request locksRequest) (interface{}, int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	now := time.Now()
+	response := locksResponse{Locks: make([]Lock, 0, len(server.sessions))}
+	for id, s := range server.sessions {
+		for token, h := range s.holds {
+			if !strings.HasPrefix(h.name, request.Prefix) {
+				continue
+			}
+			response.Locks = append(response.Locks, Lock{
+				Kind:    h.kind,
+				Name:    h.name,
+				Key:     h.key,
+				Session: id,
+				Token:   token,
+				Weight:  h.weight,
+				Since:   h.since,
+				TTL:     int64(s.expire.Sub(now) / time.Millisecond),
+			})
+		}
+	}
+	return response, http.StatusOK
+}
+
+func (server *Server) release(request lockRequest) (interface{}, int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	s, found := server.sessions[request.Session]
+	if !found {
+		return SessionLost.Error(), http.StatusNotFound
+	}
+
+	if request.Token != "" {
+		h, held := s.holds[request.Token]
+		if !held {
+			return locker.InvalidIntent.Error(), http.StatusConflict
+		}
+		delete(s.holds, request.Token)
+		count := h.release(h.weight)
+		server.unuse(h)
+		return lockResponse{Count: count}, http.StatusOK
+	}
+
+	// the semaphore is released by the weight regardless of
+	// the acquisitions, so the tokens are consumed one by one
+	if request.Kind != kindSemaphore || request.Weight == 0 {
+		return "lockd: token or semaphore weight is required", http.StatusBadRequest
+	}
+	var total uint32
+	for _, h := range s.holds {
+		if h.sema != nil && h.name == request.Name {
+			total += h.weight
+		}
+	}
+	if total < request.Weight {
+		return locker.InvalidIntent.Error(), http.StatusConflict
+	}
+	weight := request.Weight
+	var response lockResponse
+	for token, h := range s.holds {
+		if weight == 0 {
+			break
+		}
+		if h.sema == nil || h.name != request.Name {
+			continue
+		}
+		part := h.weight
+		if part > weight {
+			part = weight
+		}
+		count := h.release(part)
+		if weight == request.Weight {
+			response.Count = count
+		}
+		weight -= part
+		if h.weight -= part; h.weight == 0 {
+			delete(s.holds, token)
+			server.unuse(h)
+		}
+	}
+	return response, http.StatusOK
+}
+
+// resolve finds or creates the resource by the request
+// and counts the hold as its user until the unuse.
+// It returns a non-empty message if the request is invalid.
+func (server *Server) resolve(request lockRequest) (*hold, string) {
+	if request.Name == "" {
+		return nil, "lockd: name is required"
+	}
+	key := resourceKey{kind: request.Kind, name: request.Name}
+	r, found := server.resources[key]
+	h := &hold{kind: request.Kind, name: request.Name, weight: 1}
+	switch request.Kind {
+	case kindMutex:
+		if !found {
+			r = &resource{mutex: locker.Interruptible()}
+		}
+		h.mutex = r.mutex
+	case kindSemaphore:
+		if request.Capacity == 0 || request.Weight == 0 {
+			return nil, "lockd: capacity and weight must be positive"
+		}
+		if !found {
+			r = &resource{sema: locker.Limited(uint(request.Capacity))}
+		}
+		if r.sema.Limit() != request.Capacity {
+			return nil, "lockd: capacity mismatch"
+		}
+		h.weight, h.sema = request.Weight, r.sema
+	case kindSet:
+		if request.Capacity == 0 {
+			return nil, "lockd: capacity must be positive"
+		}
+		if server.maxCapacity > 0 && request.Capacity > server.maxCapacity {
+			return nil, "lockd: capacity exceeds the limit"
+		}
+		if !found {
+			iset := locker.InterruptibleSet(uint(request.Capacity))
+			r = &resource{capacity: request.Capacity, byKey: func(key string) mutex { return iset.ByKey(key) }}
+		}
+		if r.capacity != request.Capacity {
+			return nil, "lockd: capacity mismatch"
+		}
+		h.key, h.mutex = request.Key, r.byKey(request.Key)
+	default:
+		return nil, "lockd: unknown kind " + request.Kind
+	}
+	if !found {
+		server.resources[key] = r
+	}
+	r.users++
+	h.origin = r
+	return h, ""
+}
+
+// unuse forgets the hold as a user of its resource
+// and removes the resource if it has no users anymore.
+func (server *Server) unuse(h *hold) {
+	if h.origin.users--; h.origin.users == 0 {
+		delete(server.resources, resourceKey{kind: h.kind, name: h.name})
+	}
+}
+
+func decode(rw http.ResponseWriter, req *http.Request, request interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package lockd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker/lockd"
+)
+
+func TestServer(t *testing.T) {
+	server := httptest.NewServer(NewServer(ServerWithMaxCapacity(16)))
+	defer server.Close()
+
+	// post returns the status of the response or zero on a network error
+	post := func(path string, request map[string]interface{}) (int, map[string]interface{}) {
+		body, _ := json.Marshal(request)
+		raw, err := http.Post(server.URL+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return 0, nil
+		}
+		defer raw.Body.Close()
+		response := make(map[string]interface{})
+		if raw.StatusCode == http.StatusOK {
+			_ = json.NewDecoder(raw.Body).Decode(&response)
+		}
+		return raw.StatusCode, response
+	}
+	open := func() string {
+		status, response := post("/v1/session/open", map[string]interface{}{"ttl": time.Minute / time.Millisecond})
+		if status != http.StatusOK {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+		return response["session"].(string)
+	}
+
+	t.Run("capacity limit", func(t *testing.T) {
+		session := open()
+		status, _ := post("/v1/acquire", map[string]interface{}{
+			"session": session, "token": "token", "kind": "set", "name": t.Name(), "key": "key", "capacity": 1 << 31,
+		})
+		if status != http.StatusBadRequest {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+		status, response := post("/v1/acquire", map[string]interface{}{
+			"session": session, "token": "token", "kind": "set", "name": t.Name(), "key": "key", "capacity": 16,
+		})
+		if status != http.StatusOK || response["acquired"] != true {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+	})
+
+	t.Run("idle resources", func(t *testing.T) {
+		alice, bob := open(), open()
+		acquire := func(session string, capacity int) (int, map[string]interface{}) {
+			return post("/v1/acquire", map[string]interface{}{
+				"session": session, "token": session, "kind": "semaphore", "name": t.Name(), "capacity": capacity, "weight": 1,
+			})
+		}
+		if status, response := acquire(alice, 3); status != http.StatusOK || response["acquired"] != true {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+		if status, _ := acquire(bob, 5); status != http.StatusBadRequest {
+			t.Error("the semaphore with another capacity must not be used while it is held")
+			t.FailNow()
+		}
+		if status, _ := post("/v1/release", map[string]interface{}{"session": alice, "token": alice}); status != http.StatusOK {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+		if status, response := acquire(bob, 5); status != http.StatusOK || response["acquired"] != true {
+			t.Error("the released semaphore must be removed")
+			t.FailNow()
+		}
+	})
+
+	t.Run("token in use", func(t *testing.T) {
+		alice, bob := open(), open()
+		acquire := func(session, token string, wait time.Duration) (int, map[string]interface{}) {
+			return post("/v1/acquire", map[string]interface{}{
+				"session": session, "token": token, "kind": "mutex", "name": t.Name(), "wait": wait / time.Millisecond,
+			})
+		}
+		if status, response := acquire(alice, "token", 0); status != http.StatusOK || response["acquired"] != true {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+
+		waiting := make(chan int, 1)
+		go func() {
+			status, _ := acquire(bob, "token", time.Second)
+			waiting <- status
+		}()
+		time.Sleep(20 * time.Millisecond)
+		if status, _ := acquire(bob, "token", time.Second); status != http.StatusConflict {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+		if status, _ := post("/v1/release", map[string]interface{}{"session": alice, "token": "token"}); status != http.StatusOK {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+		if status := <-waiting; status != http.StatusOK {
+			t.Errorf("unexpected status %d", status)
+			t.FailNow()
+		}
+		if status, _ := post("/v1/release", map[string]interface{}{"session": bob, "token": "token"}); status != http.StatusOK {
+			t.Error("the hold of the token must be released")
+			t.FailNow()
+		}
+		if status, response := acquire(alice, "another", 0); status != http.StatusOK || response["acquired"] != true {
+			t.Error("the mutex must be free")
+			t.FailNow()
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package locker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DistributedWithLockfile sets up the directory of lockfiles
+// as a storage of the lock state.
+//
+//  lock := locker.Distributed(time.Minute, locker.DistributedWithLockfile("/mnt/shared/locks"))
+//
+func DistributedWithLockfile(dir string) DistributedOption {
+	return DistributedWithBackend(LockfileBackend(dir))
+}
+
+// LockfileBackend returns a new storage of the distributed lock state
+// based on lockfiles in the directory. Unlike the FileBackend, it doesn't
+// rely on flock(2), so the directory can be placed on a network
+// filesystem, e.g. NFS, and shared by processes of different hosts.
+//
+// The lockfile is created exclusively and contains the host, the pid
+// and the token of its owner with the expiration time based on the ttl.
+// The lock is considered stale and can be broken if it has expired
+// or its owner has died on the same host. The expiration time is
+// calculated by the clock of the owner, so hosts should keep
+// their clocks synchronized.
+func LockfileBackend(dir string) *LockfileStorage {
+	host, _ := os.Hostname()
+	return &LockfileStorage{dir: dir, host: host, pid: os.Getpid(), guard: 5 * time.Second}
+}
+
+// A LockfileStorage keeps the distributed lock state in lock files,
+// see LockfileBackend.
+type LockfileStorage struct {
+	dir   string
+	host  string
+	pid   int
+	guard time.Duration
+}
+
+// Acquire tries to take the lock by the key for the token
+// and returns true if it succeeded with its fencing token.
+// It breaks the stale lock left by another owner.
+func (backend *LockfileStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	name := filename(backend.dir, key, ".lock")
+	for {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fence, err := backend.take(key, file, token, ttl)
+			if err != nil {
+				_ = os.Remove(name)
+				return 0, false, err
+			}
+			return fence, true, nil
+		}
+		if !os.IsExist(err) {
+			return 0, false, err
+		}
+
+		meta, info, err := backend.read(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		if !backend.stale(meta, info, ttl) {
+			if meta.Token != token {
+				return 0, false, nil
+			}
+			err := backend.Refresh(key, token, ttl)
+			if err == nil {
+				return meta.Fence, true, nil
+			}
+			if err != InvalidIntent {
+				return 0, false, err
+			}
+			continue
+		}
+		broken, err := backend.replace(key, func(current fmeta, info os.FileInfo) (*fmeta, bool) {
+			same := current.Token == meta.Token && current.Expire.Equal(meta.Expire)
+			return nil, same && backend.stale(current, info, ttl)
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		if !broken {
+			return 0, false, nil
+		}
+	}
+}
+
+// Release removes the lockfile by the key if it is held by the token.
+func (backend *LockfileStorage) Release(key, token string) error {
+	released, err := backend.replace(key, func(current fmeta, _ os.FileInfo) (*fmeta, bool) {
+		return nil, current.Token == token
+	})
+	if err == nil && !released {
+		err = InvalidIntent
+	}
+	return err
+}
+
+// Refresh updates the expiration time of the lockfile by the key
+// if it is held by the token and has not expired yet.
+func (backend *LockfileStorage) Refresh(key, token string, ttl time.Duration) error {
+	refreshed, err := backend.replace(key, func(current fmeta, _ os.FileInfo) (*fmeta, bool) {
+		held := current.Token == token && time.Now().Before(current.Expire)
+		current.Expire = time.Now().Add(ttl)
+		return &current, held
+	})
+	if err == nil && !refreshed {
+		err = InvalidIntent
+	}
+	return err
+}
+
+// Inspect returns the current state of the lock by the key.
+// The stale lock is reported as free.
+func (backend *LockfileStorage) Inspect(key string) (Lease, error) {
+	meta, info, err := backend.read(filename(backend.dir, key, ".lock"))
+	if os.IsNotExist(err) {
+		return Lease{Key: key}, nil
+	}
+	if err != nil {
+		return Lease{Key: key}, err
+	}
+	if meta.Token == "" || backend.stale(meta, info, 0) {
+		return Lease{Key: key}, nil
+	}
+	return meta.lease(key), nil
+}
+
+// List returns the keys of the lockfiles with the prefix.
+func (backend *LockfileStorage) List(prefix string) ([]string, error) {
+	return listFiles(backend.dir, prefix, ".lock")
+}
+
+// take fills the just created lockfile with a new fencing token.
+func (backend *LockfileStorage) take(key string, file *os.File, token string, ttl time.Duration) (uint64, error) {
+	defer file.Close()
+
+	// the fencing token is kept apart to survive the removal of the lockfile,
+	// it is changed only by the owner of the lock
+	fence := filename(backend.dir, key, ".fence")
+	var last uint64
+	if raw, err := ioutil.ReadFile(fence); err == nil {
+		last, _ = strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+	last++
+	if err := backend.write(key, fence, []byte(strconv.FormatUint(last, 10))); err != nil {
+		return 0, err
+	}
+
+	meta := fmeta{Host: backend.host, PID: backend.pid, Token: token, Fence: last, Expire: time.Now().Add(ttl)}
+	if err := writeMeta(file, meta); err != nil {
+		return 0, err
+	}
+	return last, nil
+}
+
+// replace changes or removes the lockfile by the key if the check passed.
+// It holds the guard file to prevent the same change by someone else
+// between the check and the change.
+func (backend *LockfileStorage) replace(key string, check func(fmeta, os.FileInfo) (*fmeta, bool)) (bool, error) {
+	release, err := backend.lock(key)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	name := filename(backend.dir, key, ".lock")
+	meta, info, err := backend.read(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	next, ok := check(meta, info)
+	if !ok {
+		return false, nil
+	}
+	if next == nil {
+		return true, os.Remove(name)
+	}
+	raw, err := json.Marshal(next)
+	if err != nil {
+		return false, err
+	}
+	return true, backend.write(key, name, raw)
+}
+
+// lock takes the guard file by the key. The guard is held only
+// for a short time, so it is broken if it is older than expected.
+func (backend *LockfileStorage) lock(key string) (func(), error) {
+	name := filename(backend.dir, key, ".break")
+	for {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(name) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > backend.guard {
+			_ = os.Remove(name)
+			continue
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// read returns the content of the lockfile and its attributes.
+func (backend *LockfileStorage) read(name string) (fmeta, os.FileInfo, error) {
+	var meta fmeta
+	file, err := os.Open(name)
+	if err != nil {
+		return meta, nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return meta, nil, err
+	}
+	meta, err = readMeta(file)
+	if _, ok := err.(*json.SyntaxError); ok || err == nil && meta.Token == "" {
+		// the lockfile is being filled right now or its owner has crashed
+		return fmeta{}, info, nil
+	}
+	return meta, info, err
+}
+
+// write atomically replaces the content of the file by the name.
+func (backend *LockfileStorage) write(key, name string, raw []byte) error {
+	file, err := ioutil.TempFile(backend.dir, url.PathEscape(key)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(raw)
+	if syncErr := file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+	return err
+}
+
+// stale returns true if the lock has expired or its owner has died.
+// The lockfile without a content is being filled by its owner right now,
+// so it is stale only if its modification time is older than the ttl
+// and the guard period, i.e. its owner has crashed before the filling.
+func (backend *LockfileStorage) stale(meta fmeta, info os.FileInfo, ttl time.Duration) bool {
+	if meta.Token == "" {
+		if ttl < backend.guard {
+			ttl = backend.guard
+		}
+		return time.Since(info.ModTime()) > ttl
+	}
+	if !time.Now().Before(meta.Expire) {
+		return true
+	}
+	return meta.Host == backend.host && meta.PID != backend.pid && !alive(meta.PID)
+}
@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package locker
+
+// alive returns true if the process by the pid is running.
+// It can't be checked on the platform, so the lock is considered
+// stale only after its expiration.
+func alive(int) bool {
+	return true
+}
@@ -0,0 +1,163 @@
+package locker_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+)
+
+func TestLockfileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locker")
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	host, _ := os.Hostname()
+	lockfile := func(key, host string, pid int, expire time.Time) {
+		raw, _ := json.Marshal(map[string]interface{}{
+			"host":   host,
+			"pid":    pid,
+			"token":  "crashed",
+			"fence":  1,
+			"expire": expire,
+		})
+		if err := ioutil.WriteFile(filepath.Join(dir, url.PathEscape(key)+".lock"), raw, 0644); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	}
+
+	t.Run("contract", func(t *testing.T) {
+		testBackend(t, LockfileBackend(dir))
+	})
+
+	t.Run("expired lock", func(t *testing.T) {
+		backend := LockfileBackend(dir)
+		fence, acquired, err := backend.Acquire(t.Name(), "first", time.Millisecond)
+		if err != nil || !acquired {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+		time.Sleep(2 * time.Millisecond)
+		if lease, err := backend.Inspect(t.Name()); err != nil || lease.Held() {
+			t.Error("the lock must be free")
+			t.FailNow()
+		}
+		next, acquired, err := LockfileBackend(dir).Acquire(t.Name(), "second", time.Minute)
+		if err != nil || !acquired || next <= fence {
+			t.Error("the stale lock must be broken")
+			t.FailNow()
+		}
+		if err := backend.Refresh(t.Name(), "first", time.Minute); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := backend.Release(t.Name(), "first"); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+
+	t.Run("lockfile being filled", func(t *testing.T) {
+		name := filepath.Join(dir, url.PathEscape(t.Name())+".lock")
+		if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		time.Sleep(2 * time.Millisecond)
+		if _, acquired, err := LockfileBackend(dir).Acquire(t.Name(), "impatient", time.Millisecond); err != nil || acquired {
+			t.Error("the lockfile being filled must be respected")
+			t.FailNow()
+		}
+		past := time.Now().Add(-time.Minute)
+		if err := os.Chtimes(name, past, past); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if _, acquired, err := LockfileBackend(dir).Acquire(t.Name(), "patient", time.Millisecond); err != nil || !acquired {
+			t.Error("the lockfile of the owner crashed before the filling must be broken")
+			t.FailNow()
+		}
+	})
+
+	t.Run("dead owner", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the owner can't be checked on the platform")
+		}
+		owner := exec.Command(os.Args[0], "-test.run=^$")
+		if err := owner.Run(); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		lockfile(t.Name(), host, owner.Process.Pid, time.Now().Add(time.Hour))
+		if _, acquired, err := LockfileBackend(dir).Acquire(t.Name(), "alive", time.Minute); err != nil || !acquired {
+			t.Error("the lock of the dead owner must be broken")
+			t.FailNow()
+		}
+	})
+
+	t.Run("owner on another host", func(t *testing.T) {
+		lockfile(t.Name(), host+".another", 1, time.Now().Add(time.Hour))
+		if _, acquired, err := LockfileBackend(dir).Acquire(t.Name(), "local", time.Minute); err != nil || acquired {
+			t.Error("the lock of the remote owner must be respected")
+			t.FailNow()
+		}
+		if lease, err := LockfileBackend(dir).Inspect(t.Name()); err != nil || lease.Token != "crashed" {
+			t.Errorf("unexpected lease %+v", lease)
+			t.FailNow()
+		}
+	})
+
+	t.Run("distributed lock", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		const workers = 5
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			owners  int
+			overlap bool
+		)
+		wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				lock := Distributed(time.Minute,
+					DistributedWithKey(t.Name()),
+					DistributedWithLockfile(dir),
+					DistributedWithRetry(time.Millisecond),
+				)
+				if err := lock.Lock(ctx); err != nil {
+					t.Error("unexpected error")
+					return
+				}
+				mu.Lock()
+				owners++
+				overlap = overlap || owners > 1
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				owners--
+				mu.Unlock()
+				_ = lock.Unlock(ctx)
+			}()
+		}
+		wg.Wait()
+		if overlap {
+			t.Error("the lock must be held by a single owner")
+		}
+	})
+}
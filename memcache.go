@@ -0,0 +1,215 @@
+package locker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kamilsk/locker/internal/memcache"
+)
+
+// DistributedWithMemcache sets up the memcached server by the address
+// as a storage of the lock state.
+//
+//  lock := locker.Distributed(time.Minute, locker.DistributedWithMemcache("127.0.0.1:11211"))
+//
+func DistributedWithMemcache(addr string) DistributedOption {
+	return DistributedWithBackend(MemcacheBackend(addr))
+}
+
+// MemcacheBackend returns a new storage of the distributed lock state
+// based on the memcached server by the address.
+//
+// The lock is taken by the add command and expires after the ttl
+// rounded up to seconds, the exact expiration time is kept
+// with the owner token. The lock is changed and released only
+// if it has not been changed since it was checked.
+//
+// The fencing token is monotonic only while the server doesn't lose
+// its data, e.g. by the restart or the eviction of the counter.
+// The release requires the meta commands of memcached 1.6 or higher.
+// The key is written into the commands as is, so InvalidIntent is
+// returned for the key which is empty, contains spaces or control
+// characters or, with the suffix of its counter, is longer
+// than memcached accepts.
+func MemcacheBackend(addr string) *MemcacheStorage {
+	return &MemcacheStorage{client: memcache.New(addr, time.Second)}
+}
+
+// A MemcacheStorage keeps the distributed lock state in memcached,
+// see MemcacheBackend.
+type MemcacheStorage struct {
+	client *memcache.Client
+}
+
+// mcvalue is a state of the lock stored by the key.
+type mcvalue struct {
+	token  string
+	fence  uint64
+	expire time.Time
+}
+
+// Acquire tries to take the lock by the key for the token
+// and returns true if it succeeded with its fencing token.
+func (backend *MemcacheStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	if !validKey(key) {
+		return 0, false, InvalidIntent
+	}
+	item, value, err := backend.get(key)
+	if err != nil {
+		return 0, false, err
+	}
+	if item != nil && value.held() {
+		if value.token != token {
+			return 0, false, nil
+		}
+		if err := backend.Refresh(key, token, ttl); err != nil {
+			return 0, false, err
+		}
+		return value.fence, true, nil
+	}
+
+	fence, err := backend.next(key)
+	if err != nil {
+		return 0, false, err
+	}
+	value = mcvalue{token: token, fence: fence, expire: time.Now().Add(ttl)}
+	var acquired bool
+	if item == nil {
+		acquired, err = backend.client.Add(key, value.encode(), exptime(ttl))
+	} else {
+		// the lock has expired but the server has not dropped it yet
+		item.Value = value.encode()
+		acquired, err = backend.client.CompareAndSwap(item, exptime(ttl))
+	}
+	if err != nil || !acquired {
+		return 0, false, err
+	}
+	return fence, true, nil
+}
+
+// Release releases the lock by the key if it is held by the token.
+func (backend *MemcacheStorage) Release(key, token string) error {
+	if !validKey(key) {
+		return InvalidIntent
+	}
+	item, value, err := backend.get(key)
+	if err != nil {
+		return err
+	}
+	if item == nil || !value.held() || value.token != token {
+		return InvalidIntent
+	}
+	deleted, err := backend.client.CompareAndDelete(item)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return InvalidIntent
+	}
+	return nil
+}
+
+// Refresh extends the lock by the key for the ttl if it is held by the token.
+func (backend *MemcacheStorage) Refresh(key, token string, ttl time.Duration) error {
+	if !validKey(key) {
+		return InvalidIntent
+	}
+	item, value, err := backend.get(key)
+	if err != nil {
+		return err
+	}
+	if item == nil || !value.held() || value.token != token {
+		return InvalidIntent
+	}
+	value.expire = time.Now().Add(ttl)
+	item.Value = value.encode()
+	stored, err := backend.client.CompareAndSwap(item, exptime(ttl))
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return InvalidIntent
+	}
+	return nil
+}
+
+// Inspect returns the current state of the lock by the key.
+func (backend *MemcacheStorage) Inspect(key string) (Lease, error) {
+	if !validKey(key) {
+		return Lease{Key: key}, InvalidIntent
+	}
+	item, value, err := backend.get(key)
+	if err != nil || item == nil || !value.held() {
+		return Lease{Key: key}, err
+	}
+	return Lease{Key: key, Token: value.token, TTL: time.Until(value.expire), Fence: value.fence}, nil
+}
+
+func (backend *MemcacheStorage) get(key string) (*memcache.Item, mcvalue, error) {
+	var value mcvalue
+	item, err := backend.client.Gets(key)
+	if err != nil || item == nil {
+		return nil, value, err
+	}
+	value.decode(item.Value)
+	return item, value, nil
+}
+
+// next returns the next fencing token of the lock by the key.
+// The counter never expires to guarantee the monotonicity.
+func (backend *MemcacheStorage) next(key string) (uint64, error) {
+	for {
+		fence, found, err := backend.client.Increment(fenceKey(key), 1)
+		if err != nil || found {
+			return fence, err
+		}
+		if _, err := backend.client.Add(fenceKey(key), []byte("0"), 0); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// validKey returns true if the key and the key of its counter
+// can be written into the commands.
+func validKey(key string) bool {
+	return memcache.ValidKey(key) && memcache.ValidKey(fenceKey(key))
+}
+
+// exptime returns the ttl rounded up to seconds. The greater one than
+// memcached reads as relative is converted to the unix time.
+func exptime(ttl time.Duration) int64 {
+	if s := seconds(ttl); s <= memcache.MaxRelativeExptime {
+		return s
+	}
+	return time.Now().Add(ttl + time.Second - 1).Unix()
+}
+
+func (value mcvalue) held() bool {
+	return value.token != "" && time.Now().Before(value.expire)
+}
+
+// encode stores the token last, so it can contain spaces.
+func (value mcvalue) encode() []byte {
+	return []byte(strconv.FormatUint(value.fence, 10) + " " +
+		strconv.FormatInt(value.expire.UnixNano(), 10) + " " +
+		value.token)
+}
+
+// decode restores the state of the lock, the malformed state
+// is considered as expired.
+func (value *mcvalue) decode(raw []byte) {
+	fields := strings.SplitN(string(raw), " ", 3)
+	if len(fields) != 3 {
+		return
+	}
+	fence, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return
+	}
+	expire, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return
+	}
+	*value = mcvalue{token: fields[2], fence: fence, expire: time.Unix(0, expire)}
+}
@@ -0,0 +1,149 @@
+package locker_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+	"github.com/kamilsk/locker/internal/memcache"
+)
+
+func TestMemcacheBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	server, err := memcache.NewServer()
+	if err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	defer server.Close()
+
+	backend := MemcacheBackend(server.Addr())
+
+	t.Run("expired lock", func(t *testing.T) {
+		fence, acquired, err := backend.Acquire(t.Name(), "first", time.Millisecond)
+		if err != nil || !acquired {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+		time.Sleep(2 * time.Millisecond)
+		if lease, err := backend.Inspect(t.Name()); err != nil || lease.Held() {
+			t.Error("the lock must be free before the server drops it")
+			t.FailNow()
+		}
+		next, acquired, err := backend.Acquire(t.Name(), "second", time.Minute)
+		if err != nil || !acquired || next <= fence {
+			t.Error("the expired lock must be taken")
+			t.FailNow()
+		}
+		if err := backend.Refresh(t.Name(), "first", time.Minute); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := backend.Release(t.Name(), "first"); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := backend.Release(t.Name(), "second"); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("malformed key", func(t *testing.T) {
+		for _, key := range []string{"", "with space", "with\r\nflush_all", "with\x00control", strings.Repeat("k", 250)} {
+			if _, _, err := backend.Acquire(key, "token", time.Minute); err != InvalidIntent {
+				t.Errorf("unexpected error value %v for %q", err, key)
+				t.FailNow()
+			}
+			if err := backend.Refresh(key, "token", time.Minute); err != InvalidIntent {
+				t.Errorf("unexpected error value %v for %q", err, key)
+				t.FailNow()
+			}
+			if err := backend.Release(key, "token"); err != InvalidIntent {
+				t.Errorf("unexpected error value %v for %q", err, key)
+				t.FailNow()
+			}
+			if _, err := backend.Inspect(key); err != InvalidIntent {
+				t.Errorf("unexpected error value %v for %q", err, key)
+				t.FailNow()
+			}
+		}
+	})
+
+	t.Run("long ttl", func(t *testing.T) {
+		const ttl = 31 * 24 * time.Hour
+		if _, acquired, err := backend.Acquire(t.Name(), "first", ttl); err != nil || !acquired {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+		if err := backend.Refresh(t.Name(), "first", ttl); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if _, acquired, err := backend.Acquire(t.Name(), "second", time.Minute); err != nil || acquired {
+			t.Error("the lock must be held for the ttl longer than 30 days")
+			t.FailNow()
+		}
+		if err := backend.Release(t.Name(), "first"); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("distributed lock", func(t *testing.T) {
+		options := []DistributedOption{
+			DistributedWithKey(t.Name()),
+			DistributedWithMemcache(server.Addr()),
+			DistributedWithRetry(time.Millisecond),
+		}
+		first, second := Distributed(time.Minute, options...), Distributed(time.Minute, options...)
+		if err := first.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := first.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := second.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("restarted server", func(t *testing.T) {
+		lock := Distributed(time.Minute,
+			DistributedWithKey(t.Name()),
+			DistributedWithMemcache(server.Addr()),
+			DistributedWithRefresh(time.Millisecond),
+		)
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		server.Flush()
+		select {
+		case <-lock.Lost().Done():
+		case <-ctx.Done():
+			t.Error("the lock must be lost")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+}
@@ -0,0 +1,381 @@
+package locker
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBackend returns a new in-process storage of the distributed
+// lock state. It is useful for tests and to share locks by keys
+// between independent parts of a single process.
+func MemoryBackend(options ...MemoryBackendOption) *MemoryStorage {
+	backend := &MemoryStorage{
+		now:    time.Now,
+		leases: make(map[string]mlease),
+		fences: make(map[string]uint64),
+		signal: make(chan struct{}),
+	}
+	for _, option := range options {
+		option(backend)
+	}
+	return backend
+}
+
+// MemoryBackendOption configures the in-process storage.
+type MemoryBackendOption func(*MemoryStorage)
+
+// MemoryBackendWithClock sets up the source of the current time
+// used to expire locks, e.g. a virtual clock of a simulation.
+// The Wait method still sleeps in real time.
+func MemoryBackendWithClock(now func() time.Time) MemoryBackendOption {
+	return func(backend *MemoryStorage) { backend.now = now }
+}
+
+// A MemoryStorage keeps the distributed lock state in memory,
+// see MemoryBackend.
+type MemoryStorage struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	leases map[string]mlease
+	fences map[string]uint64
+	signal chan struct{}
+}
+
+type mlease struct {
+	token  string
+	fence  uint64
+	expire time.Time
+}
+
+// Acquire tries to take the lock by the key for the token
+// and returns true if it succeeded with its fencing token.
+func (backend *MemoryStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	lease, found := backend.lease(key)
+	if found && lease.token != token {
+		return 0, false, nil
+	}
+	if !found {
+		backend.fences[key]++
+		lease = mlease{token: token, fence: backend.fences[key]}
+	}
+	lease.expire = backend.now().Add(ttl)
+	backend.leases[key] = lease
+	return lease.fence, true, nil
+}
+
+// Release releases the lock by the key if it is held by the token.
+func (backend *MemoryStorage) Release(key, token string) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	if lease, found := backend.lease(key); !found || lease.token != token {
+		return InvalidIntent
+	}
+	delete(backend.leases, key)
+	backend.broadcast()
+	return nil
+}
+
+// Refresh extends the lock by the key for the ttl if it is held by the token.
+func (backend *MemoryStorage) Refresh(key, token string, ttl time.Duration) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	lease, found := backend.lease(key)
+	if !found || lease.token != token {
+		return InvalidIntent
+	}
+	lease.expire = backend.now().Add(ttl)
+	backend.leases[key] = lease
+	return nil
+}
+
+// Inspect returns the current state of the lock by the key.
+func (backend *MemoryStorage) Inspect(key string) (Lease, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	lease, found := backend.lease(key)
+	if !found {
+		return Lease{Key: key}, nil
+	}
+	return Lease{Key: key, Token: lease.token, TTL: lease.expire.Sub(backend.now()), Fence: lease.fence}, nil
+}
+
+// List returns the keys of the held locks with the prefix.
+func (backend *MemoryStorage) List(prefix string) ([]string, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	keys := make([]string, 0, len(backend.leases))
+	for key := range backend.leases {
+		if _, found := backend.lease(key); found && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Wait blocks until the lock by the key is released, expired
+// or the Breaker is done.
+func (backend *MemoryStorage) Wait(breaker Breaker, key, _ string) error {
+	backend.mu.Lock()
+	lease, found := backend.lease(key)
+	signal := backend.signal
+	backend.mu.Unlock()
+	if !found {
+		return nil
+	}
+
+	timer := time.NewTimer(lease.expire.Sub(backend.now()))
+	defer timer.Stop()
+	select {
+	case <-breaker.Done():
+		return Interrupted
+	case <-signal:
+		return nil
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (backend *MemoryStorage) lease(key string) (mlease, bool) {
+	lease, found := backend.leases[key]
+	if found && !backend.now().Before(lease.expire) {
+		delete(backend.leases, key)
+		return mlease{}, false
+	}
+	return lease, found
+}
+
+func (backend *MemoryStorage) broadcast() {
+	close(backend.signal)
+	backend.signal = make(chan struct{})
+}
+
+// MemorySemaphoreBackend returns a new in-process storage
+// of the distributed semaphore state. It is useful for tests.
+func MemorySemaphoreBackend() *MemorySemaphoreStorage {
+	return &MemorySemaphoreStorage{
+		now:     time.Now,
+		holders: make(map[string]map[string]mholder),
+		limits:  make(map[string]uint32),
+	}
+}
+
+// A MemorySemaphoreStorage keeps the distributed semaphore state
+// in memory, see MemorySemaphoreBackend.
+type MemorySemaphoreStorage struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	holders map[string]map[string]mholder
+	limits  map[string]uint32
+}
+
+type mholder struct {
+	weight uint32
+	expire time.Time
+}
+
+// Acquire adds the weight to the holder by the token if the total weight
+// of alive holders doesn't exceed the limit.
+func (backend *MemorySemaphoreStorage) Acquire(key, token string, weight, capacity uint32, ttl time.Duration) (bool, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	holders, count := backend.alive(key)
+	if uint64(count)+uint64(weight) > uint64(backend.limit(key, capacity)) {
+		return false, nil
+	}
+	holder := holders[token]
+	holder.weight += weight
+	holder.expire = backend.now().Add(ttl)
+	holders[token] = holder
+	return true, nil
+}
+
+// Release subtracts the weight from the holder by the token and returns
+// the total weight before the release.
+func (backend *MemorySemaphoreStorage) Release(key, token string, weight uint32) (uint32, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	holders, count := backend.alive(key)
+	holder, found := holders[token]
+	if !found || holder.weight < weight {
+		return count, InvalidIntent
+	}
+	if holder.weight -= weight; holder.weight == 0 {
+		delete(holders, token)
+	} else {
+		holders[token] = holder
+	}
+	return count, nil
+}
+
+// Refresh extends the lease of the holder by the token for the ttl.
+func (backend *MemorySemaphoreStorage) Refresh(key, token string, ttl time.Duration) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	holders, _ := backend.alive(key)
+	holder, found := holders[token]
+	if !found {
+		return InvalidIntent
+	}
+	holder.expire = backend.now().Add(ttl)
+	holders[token] = holder
+	return nil
+}
+
+// State returns the total weight of alive holders and the limit.
+func (backend *MemorySemaphoreStorage) State(key string, capacity uint32) (uint32, uint32, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	_, count := backend.alive(key)
+	return count, backend.limit(key, capacity), nil
+}
+
+// Resize sets the limit and returns the previous one.
+func (backend *MemorySemaphoreStorage) Resize(key string, capacity, limit uint32) (uint32, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	prev := backend.limit(key, capacity)
+	backend.limits[key] = limit
+	return prev, nil
+}
+
+// alive drops expired holders and returns the rest
+// with their total weight.
+func (backend *MemorySemaphoreStorage) alive(key string) (map[string]mholder, uint32) {
+	holders, found := backend.holders[key]
+	if !found {
+		holders = make(map[string]mholder)
+		backend.holders[key] = holders
+	}
+	var count uint32
+	now := backend.now()
+	for token, holder := range holders {
+		if !now.Before(holder.expire) {
+			delete(holders, token)
+			continue
+		}
+		count += holder.weight
+	}
+	return holders, count
+}
+
+func (backend *MemorySemaphoreStorage) limit(key string, capacity uint32) uint32 {
+	if limit, found := backend.limits[key]; found {
+		return limit
+	}
+	return capacity
+}
+
+// MemoryRWBackend returns a new in-process storage of the distributed
+// reader/writer lock state. It is useful for tests.
+func MemoryRWBackend() *MemoryRWStorage {
+	return &MemoryRWStorage{locks: make(map[string]*mrwlock)}
+}
+
+// A MemoryRWStorage keeps the distributed reader/writer lock state
+// in memory, see MemoryRWBackend.
+type MemoryRWStorage struct {
+	mu    sync.Mutex
+	locks map[string]*mrwlock
+}
+
+type mrwlock struct {
+	writer  string
+	expire  time.Time
+	readers map[string]time.Time
+}
+
+// AcquireRead adds the reader by the token if there is
+// no writer holding or waiting for the lock.
+func (backend *MemoryRWStorage) AcquireRead(key, token string, ttl time.Duration) (bool, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	lock := backend.lock(key)
+	if lock.writer != "" {
+		return false, nil
+	}
+	lock.readers[token] = time.Now().Add(ttl)
+	return true, nil
+}
+
+// AcquireWrite registers the writer by the token to block
+// new readers and returns true if there are no readers left.
+func (backend *MemoryRWStorage) AcquireWrite(key, token string, ttl time.Duration) (bool, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	lock := backend.lock(key)
+	if lock.writer != "" && lock.writer != token {
+		return false, nil
+	}
+	lock.writer, lock.expire = token, time.Now().Add(ttl)
+	return len(lock.readers) == 0, nil
+}
+
+// Release removes the reader or the writer by the token.
+func (backend *MemoryRWStorage) Release(key, token string) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	lock := backend.lock(key)
+	if lock.writer == token {
+		lock.writer = ""
+		return nil
+	}
+	if _, found := lock.readers[token]; found {
+		delete(lock.readers, token)
+		return nil
+	}
+	return InvalidIntent
+}
+
+// Refresh extends the lease of the reader or the writer by the token.
+func (backend *MemoryRWStorage) Refresh(key, token string, ttl time.Duration) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	lock := backend.lock(key)
+	if lock.writer == token {
+		lock.expire = time.Now().Add(ttl)
+		return nil
+	}
+	if _, found := lock.readers[token]; found {
+		lock.readers[token] = time.Now().Add(ttl)
+		return nil
+	}
+	return InvalidIntent
+}
+
+// lock returns the state of the lock by the key without expired leases.
+func (backend *MemoryRWStorage) lock(key string) *mrwlock {
+	lock, found := backend.locks[key]
+	if !found {
+		lock = &mrwlock{readers: make(map[string]time.Time)}
+		backend.locks[key] = lock
+	}
+	now := time.Now()
+	if lock.writer != "" && !now.Before(lock.expire) {
+		lock.writer = ""
+	}
+	for token, expire := range lock.readers {
+		if !now.Before(expire) {
+			delete(lock.readers, token)
+		}
+	}
+	return lock
+}
@@ -0,0 +1,323 @@
+package locker
+
+import (
+	"sync"
+	"time"
+)
+
+// WithPriority returns the Breaker carrying the priority of the waiter
+// of the Prioritized mutex or semaphore. The higher the priority,
+// the earlier the waiter gets the lock. The priority is zero by default.
+// The deadline of the Breaker, if it has one, is passed through.
+//
+//  if err := lock.Lock(locker.WithPriority(req.Context(), 10)); err != nil {
+//  	return err
+//  }
+//  defer lock.MustUnlock()
+//
+func WithPriority(breaker Breaker, priority int) *PrioritizedBreaker {
+	return &PrioritizedBreaker{Breaker: breaker, priority: priority}
+}
+
+// A PrioritizedBreaker is the Breaker carrying the priority
+// of the waiter, see WithPriority.
+type PrioritizedBreaker struct {
+	Breaker
+	priority int
+}
+
+// Priority returns the priority of the waiter.
+func (breaker *PrioritizedBreaker) Priority() int {
+	return breaker.priority
+}
+
+// Deadline returns the deadline of the underlying Breaker if it has one.
+func (breaker *PrioritizedBreaker) Deadline() (time.Time, bool) {
+	return deadlineOf(breaker.Breaker)
+}
+
+// Prioritized returns a new instance of safe interruptible mutex
+// which grants the lock to the most urgent waiter first: the one with
+// the highest priority, see WithPriority, then the one with the earliest
+// deadline of its Breaker, e.g. the context.Context, then the earliest one.
+//
+//  lock := locker.Prioritized(locker.PrioritizedWithAging(time.Second))
+//
+//  var handler http.HandlerFunc = func(rw http.ResponseWriter, req *http.Request) {
+//  	priority := 0
+//  	if req.Header.Get("X-Interactive") != "" {
+//  		priority = 10
+//  	}
+//  	if err := lock.Lock(locker.WithPriority(req.Context(), priority)); err != nil {
+//  		http.Error(rw, http.StatusText(http.StatusRequestTimeout), http.StatusRequestTimeout)
+//  		return
+//  	}
+//  	defer lock.MustUnlock()
+//  	// interactive requests get here before the batch ones
+//  }
+//
+func Prioritized(options ...PrioritizedOption) *PrioritizedLock {
+	lock := &PrioritizedLock{pqueue{capacity: 1}}
+	for _, option := range options {
+		option(&lock.pqueue)
+	}
+	return lock
+}
+
+// PrioritizedLimited returns a new instance of semaphore which grants
+// its slots to the most urgent waiter first like the Prioritized mutex.
+// The most urgent waiter is never bypassed by the less urgent ones,
+// even if they need fewer slots.
+func PrioritizedLimited(capacity uint, options ...PrioritizedOption) *PrioritizedLimitedLock {
+	lock := &PrioritizedLimitedLock{pqueue{capacity: uint32(capacity)}}
+	for _, option := range options {
+		option(&lock.pqueue)
+	}
+	return lock
+}
+
+// PrioritizedOption configures the prioritized mutex or semaphore.
+type PrioritizedOption func(*pqueue)
+
+// PrioritizedWithAging sets up the interval after which a waiter gets
+// an extra point of priority, so the waiters with a low priority
+// are not starved by the stream of the urgent ones.
+// The non-positive interval disables the aging.
+func PrioritizedWithAging(interval time.Duration) PrioritizedOption {
+	return func(queue *pqueue) { queue.aging = interval }
+}
+
+// A PrioritizedLock is the mutex granting the lock to the most urgent
+// waiter first, see Prioritized.
+type PrioritizedLock struct{ pqueue }
+
+// Lock takes an exclusive lock. If the lock is already in use,
+// the calling goroutine waits in the queue ordered by urgency
+// until the mutex is passed to it or an error occurred,
+// e.g. if the Breaker is done.
+func (lock *PrioritizedLock) Lock(breaker Breaker) error {
+	return lock.acquire(breaker, 1)
+}
+
+// TryLock is a fail-fast version of the Lock method.
+// It returns true if the mutex is locked by the calling goroutine
+// or false otherwise. It never jumps the queue.
+func (lock *PrioritizedLock) TryLock() bool {
+	return lock.tryAcquire(1)
+}
+
+// Unlock releases an exclusive lock and passes it to the most urgent
+// waiter. It returns InvalidIntent if the mutex is not locked
+// on entry to Unlock. The release never blocks, so the Breaker
+// is never used.
+func (lock *PrioritizedLock) Unlock(Breaker) error {
+	_, err := lock.release(1)
+	return err
+}
+
+// MustUnlock is a fail-fast version of the Unlock method.
+// It is a runtime error if the mutex is not locked on entry to Unlock.
+func (lock *PrioritizedLock) MustUnlock() {
+	if _, err := lock.release(1); err != nil {
+		panic(CriticalIssue)
+	}
+}
+
+// A PrioritizedLimitedLock is the semaphore granting its slots
+// to the most urgent waiter first, see PrioritizedLimited.
+type PrioritizedLimitedLock struct{ pqueue }
+
+// Lock takes all slots of the semaphore.
+func (lock *PrioritizedLimitedLock) Lock(breaker Breaker) error {
+	return lock.acquire(breaker, lock.capacity)
+}
+
+// Unlock releases all slots of the semaphore.
+func (lock *PrioritizedLimitedLock) Unlock(Breaker) error {
+	_, err := lock.release(lock.capacity)
+	return err
+}
+
+// Acquire takes the slots. If they are not available, the calling
+// goroutine waits in the queue ordered by urgency until they are
+// passed to it or an error occurred, e.g. if the Breaker is done.
+func (lock *PrioritizedLimitedLock) Acquire(breaker Breaker, slot uint32) error {
+	return lock.acquire(breaker, slot)
+}
+
+// TryAcquire is a fail-fast version of the Acquire method.
+// It never jumps the queue.
+func (lock *PrioritizedLimitedLock) TryAcquire(slot uint32) bool {
+	return lock.tryAcquire(slot)
+}
+
+// Release releases the slots and passes them to the most urgent waiters.
+// It returns the number of acquired slots before the release.
+func (lock *PrioritizedLimitedLock) Release(slot uint32) (uint32, error) {
+	return lock.release(slot)
+}
+
+// Count returns the number of acquired slots.
+func (lock *PrioritizedLimitedLock) Count() uint32 {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return lock.count
+}
+
+// Limit returns the capacity of the semaphore.
+func (lock *PrioritizedLimitedLock) Limit() uint32 {
+	return lock.capacity
+}
+
+// pqueue is a counter of acquired slots
+// with the queue of waiters ordered by urgency.
+type pqueue struct {
+	capacity uint32
+	aging    time.Duration
+
+	mu      sync.Mutex
+	count   uint32
+	waiters []*pwaiter
+	seq     uint64
+}
+
+// pwaiter is a goroutine waiting for the slots.
+type pwaiter struct {
+	slots    uint32
+	priority int
+	deadline time.Time
+	since    time.Time
+	seq      uint64
+	ready    chan struct{}
+}
+
+// Len returns the number of goroutines waiting for the lock.
+func (queue *pqueue) Len() int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	return len(queue.waiters)
+}
+
+func (queue *pqueue) acquire(breaker Breaker, slot uint32) error {
+	if slot == 0 || slot > queue.capacity {
+		return InvalidIntent
+	}
+	queue.mu.Lock()
+	if len(queue.waiters) == 0 && queue.count+slot <= queue.capacity {
+		queue.count += slot
+		queue.mu.Unlock()
+		return nil
+	}
+	waiter := &pwaiter{slots: slot, since: time.Now(), seq: queue.seq, ready: make(chan struct{})}
+	if breaker, is := breaker.(interface{ Priority() int }); is {
+		waiter.priority = breaker.Priority()
+	}
+	waiter.deadline, _ = deadlineOf(breaker)
+	queue.seq++
+	queue.waiters = append(queue.waiters, waiter)
+	queue.mu.Unlock()
+
+	select {
+	case <-breaker.Done():
+	case <-waiter.ready:
+		return nil
+	}
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	select {
+	case <-waiter.ready:
+		// the slots were passed right before the interruption,
+		// so pass them further
+		queue.count -= slot
+	default:
+		queue.remove(waiter)
+	}
+	queue.grant()
+	return Interrupted
+}
+
+func (queue *pqueue) tryAcquire(slot uint32) bool {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if slot == 0 || len(queue.waiters) > 0 || queue.count+slot > queue.capacity {
+		return false
+	}
+	queue.count += slot
+	return true
+}
+
+func (queue *pqueue) release(slot uint32) (uint32, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	count := queue.count
+	if slot == 0 || count < slot {
+		return count, InvalidIntent
+	}
+	queue.count -= slot
+	queue.grant()
+	return count, nil
+}
+
+// grant passes the free slots to the most urgent waiters
+// while there is enough of them for the next one.
+// It must be called under the guard.
+func (queue *pqueue) grant() {
+	now := time.Now()
+	for len(queue.waiters) > 0 {
+		next := queue.waiters[0]
+		for _, waiter := range queue.waiters[1:] {
+			if queue.urgent(waiter, next, now) {
+				next = waiter
+			}
+		}
+		if queue.count+next.slots > queue.capacity {
+			return
+		}
+		queue.count += next.slots
+		queue.remove(next)
+		close(next.ready)
+	}
+}
+
+// urgent returns true if the waiter is more urgent than the other one.
+func (queue *pqueue) urgent(waiter, other *pwaiter, now time.Time) bool {
+	if priority, another := queue.priority(waiter, now), queue.priority(other, now); priority != another {
+		return priority > another
+	}
+	if !waiter.deadline.Equal(other.deadline) {
+		if waiter.deadline.IsZero() || other.deadline.IsZero() {
+			return other.deadline.IsZero()
+		}
+		return waiter.deadline.Before(other.deadline)
+	}
+	return waiter.seq < other.seq
+}
+
+// priority returns the priority of the waiter raised by the aging.
+func (queue *pqueue) priority(waiter *pwaiter, now time.Time) int {
+	if queue.aging <= 0 {
+		return waiter.priority
+	}
+	return waiter.priority + int(now.Sub(waiter.since)/queue.aging)
+}
+
+// remove removes the waiter from the queue keeping the order of arrival.
+func (queue *pqueue) remove(waiter *pwaiter) {
+	for i := range queue.waiters {
+		if queue.waiters[i] == waiter {
+			copy(queue.waiters[i:], queue.waiters[i+1:])
+			queue.waiters[len(queue.waiters)-1] = nil
+			queue.waiters = queue.waiters[:len(queue.waiters)-1]
+			return
+		}
+	}
+}
+
+// deadlineOf returns the deadline of the Breaker if it has one.
+func deadlineOf(breaker Breaker) (time.Time, bool) {
+	if breaker, is := breaker.(interface{ Deadline() (time.Time, bool) }); is {
+		return breaker.Deadline()
+	}
+	return time.Time{}, false
+}
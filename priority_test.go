@@ -0,0 +1,172 @@
+package locker_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+)
+
+func TestPrioritized(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// order returns the order in which the lock was granted
+	// to the waiters with the breakers queued one by one.
+	order := func(t *testing.T, lock SafeLocker, breakers ...Breaker) []int {
+		var (
+			mu      sync.Mutex
+			granted []int
+			wg      sync.WaitGroup
+			queue   = lock.(interface{ Len() int })
+			queued  = queue.Len()
+		)
+		for i, breaker := range breakers {
+			wg.Add(1)
+			go func(i int, breaker Breaker) {
+				defer wg.Done()
+				if err := lock.Lock(breaker); err != nil {
+					t.Error("unexpected error")
+					return
+				}
+				mu.Lock()
+				granted = append(granted, i)
+				mu.Unlock()
+				lock.MustUnlock()
+			}(i, breaker)
+			waitQueue(ctx, t, queue, queued+i+1)
+		}
+		lock.MustUnlock()
+		wg.Wait()
+		return granted
+	}
+
+	t.Run("by priority", func(t *testing.T) {
+		lock := Prioritized()
+		if !lock.TryLock() {
+			t.Error("lock is expected")
+			t.FailNow()
+		}
+		granted := order(t, lock, WithPriority(ctx, 0), WithPriority(ctx, 10), ctx, WithPriority(ctx, 5))
+		if len(granted) != 4 || granted[0] != 1 || granted[1] != 3 || granted[2] != 0 || granted[3] != 2 {
+			t.Errorf("unexpected order %v", granted)
+			t.FailNow()
+		}
+	})
+
+	t.Run("by deadline", func(t *testing.T) {
+		lock := Prioritized()
+		if !lock.TryLock() {
+			t.Error("lock is expected")
+			t.FailNow()
+		}
+		late, cancelLate := context.WithTimeout(context.Background(), time.Hour)
+		defer cancelLate()
+		soon, cancelSoon := context.WithTimeout(context.Background(), time.Minute)
+		defer cancelSoon()
+		granted := order(t, lock, context.Background(), late, WithPriority(soon, 0))
+		if len(granted) != 3 || granted[0] != 2 || granted[1] != 1 || granted[2] != 0 {
+			t.Errorf("unexpected order %v", granted)
+			t.FailNow()
+		}
+	})
+
+	t.Run("with aging", func(t *testing.T) {
+		lock := Prioritized(PrioritizedWithAging(10 * time.Millisecond))
+		if !lock.TryLock() {
+			t.Error("lock is expected")
+			t.FailNow()
+		}
+		lowest := make(chan error, 1)
+		go func() {
+			err := lock.Lock(WithPriority(ctx, 0))
+			if err == nil {
+				lock.MustUnlock()
+			}
+			lowest <- err
+		}()
+		waitQueue(ctx, t, lock, 1)
+		time.Sleep(100 * time.Millisecond)
+
+		granted := order(t, lock, WithPriority(ctx, 0), WithPriority(ctx, 5))
+		if err := <-lowest; err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if len(granted) != 2 || granted[0] != 1 || granted[1] != 0 {
+			t.Errorf("unexpected order %v", granted)
+			t.FailNow()
+		}
+	})
+
+	t.Run("interrupted waiter leaves the queue", func(t *testing.T) {
+		lock := Prioritized()
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		br := breaker.BreakByContext(context.WithCancel(ctx))
+		interrupted := make(chan error, 1)
+		go func() { interrupted <- lock.Lock(WithPriority(br, 10)) }()
+		waitQueue(ctx, t, lock, 1)
+		br.Close()
+		if err := <-interrupted; err != Interrupted || lock.Len() != 0 {
+			t.Error("the waiter must be interrupted")
+			t.FailNow()
+		}
+		lock.MustUnlock()
+		if err := lock.Unlock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+	})
+}
+
+func TestPrioritizedLimited(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	lock := PrioritizedLimited(3)
+	if err := lock.Acquire(ctx, 2); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := lock.Acquire(ctx, 4); err != InvalidIntent {
+		t.Error("unexpected error value")
+		t.FailNow()
+	}
+
+	urgent, batch := make(chan error, 1), make(chan error, 1)
+	go func() { urgent <- lock.Acquire(WithPriority(ctx, 10), 2) }()
+	waitQueue(ctx, t, lock, 1)
+	go func() { batch <- lock.Acquire(ctx, 1) }()
+	waitQueue(ctx, t, lock, 2)
+	if lock.TryAcquire(1) {
+		t.Error("the free slot must be kept for the urgent waiter")
+		t.FailNow()
+	}
+
+	if count, err := lock.Release(2); err != nil || count != 2 {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := <-urgent; err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := <-batch; err != nil || lock.Count() != lock.Limit() {
+		t.Error("all slots must be acquired")
+		t.FailNow()
+	}
+	if _, err := lock.Release(3); err != nil || lock.Count() != 0 {
+		t.Error("all slots must be released")
+		t.FailNow()
+	}
+	if _, err := lock.Release(1); err != InvalidIntent {
+		t.Error("unexpected error value")
+		t.FailNow()
+	}
+}
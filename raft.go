@@ -0,0 +1,444 @@
+package locker
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kamilsk/locker/raft"
+)
+
+// RaftBackend returns a new storage of the distributed lock and semaphore
+// state replicated by the Raft group through the node. Each process
+// of the group embeds its node and the storage, so the state survives
+// crashes of the minority of processes without external services.
+// The storage consumes committed entries of the node, so the node
+// must not be shared with another consumer.
+//
+//  network := raft.NewHTTPTransport(peers, nil)
+//  backend := locker.RaftBackend(raft.NewNode("a", ids, network))
+//
+//  lock := locker.Distributed(time.Minute, locker.DistributedWithBackend(backend))
+//  sem := locker.DistributedLimited(10, time.Minute, locker.DistributedLimitedWithBackend(backend.Semaphore()))
+//
+// Commands are applied in the order of the log on the time of their
+// proposal, so the clocks of processes should be synchronized.
+// The storage snapshots its state periodically to compact the log.
+func RaftBackend(node *raft.Node, options ...RaftOption) *RaftStorage {
+	backend := &RaftStorage{
+		node:       node,
+		timeout:    time.Second,
+		retry:      100 * time.Millisecond,
+		compaction: 1024,
+		locks:      MemoryBackend(),
+		semaphores: MemorySemaphoreBackend(),
+		pending:    make(map[string]chan rfresult),
+		applied:    make(map[string]rfresult),
+	}
+	for _, option := range options {
+		option(backend)
+	}
+	backend.locks.now = backend.time
+	backend.semaphores.now = backend.time
+	go backend.apply()
+	return backend
+}
+
+// RaftOption configures the Raft storage.
+type RaftOption func(*RaftStorage)
+
+// RaftWithTimeout sets up the timeout of a single call.
+func RaftWithTimeout(timeout time.Duration) RaftOption {
+	return func(backend *RaftStorage) { backend.timeout = timeout }
+}
+
+// RaftWithRetry sets up the interval between repeated proposals
+// of a command which is not committed yet, e.g. lost on the way
+// to the leader.
+func RaftWithRetry(interval time.Duration) RaftOption {
+	return func(backend *RaftStorage) { backend.retry = interval }
+}
+
+// RaftWithCompaction sets up the number of applied commands
+// after which the state is snapshotted and the log is compacted.
+func RaftWithCompaction(commands int) RaftOption {
+	return func(backend *RaftStorage) { backend.compaction = commands }
+}
+
+// A RaftStorage keeps the distributed lock and semaphore state
+// replicated by the Raft group, see RaftBackend.
+type RaftStorage struct {
+	clock int64 // the time of the last applied command, is accessed atomically
+
+	node       *raft.Node
+	timeout    time.Duration
+	retry      time.Duration
+	compaction int
+	locks      *MemoryStorage
+	semaphores *MemorySemaphoreStorage
+
+	mu      sync.Mutex
+	pending map[string]chan rfresult
+	applied map[string]rfresult
+	history []string
+}
+
+// rfcommand is an operation replicated by the log.
+type rfcommand struct {
+	ID       string        `json:"id"`
+	Op       string        `json:"op"`
+	Time     int64         `json:"time"`
+	Key      string        `json:"key"`
+	Token    string        `json:"token,omitempty"`
+	TTL      time.Duration `json:"ttl,omitempty"`
+	Weight   uint32        `json:"weight,omitempty"`
+	Capacity uint32        `json:"capacity,omitempty"`
+	Limit    uint32        `json:"limit,omitempty"`
+}
+
+// rfresult is an outcome of the command computed by each process.
+type rfresult struct {
+	fence uint64
+	ok    bool
+	count uint32
+	limit uint32
+	lease Lease
+	err   error
+}
+
+// rfsnapshot is the state of the storage after the applied commands.
+type rfsnapshot struct {
+	Clock   int64                          `json:"clock"`
+	Leases  map[string]rflease             `json:"leases"`
+	Fences  map[string]uint64              `json:"fences"`
+	Holders map[string]map[string]rfholder `json:"holders"`
+	Limits  map[string]uint32              `json:"limits"`
+	Applied []rfapplied                    `json:"applied"`
+}
+
+type rflease struct {
+	Token  string `json:"token"`
+	Fence  uint64 `json:"fence"`
+	Expire int64  `json:"expire"`
+}
+
+type rfholder struct {
+	Weight uint32 `json:"weight"`
+	Expire int64  `json:"expire"`
+}
+
+// rfapplied is the result of the recent command
+// in the order of their application.
+type rfapplied struct {
+	ID    string `json:"id"`
+	Fence uint64 `json:"fence,omitempty"`
+	OK    bool   `json:"ok,omitempty"`
+	Count uint32 `json:"count,omitempty"`
+	Limit uint32 `json:"limit,omitempty"`
+	Lease Lease  `json:"lease"`
+	Err   string `json:"err,omitempty"`
+}
+
+// Acquire tries to take the lock by the key for the token
+// and returns true if it succeeded with its fencing token.
+func (backend *RaftStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	result, err := backend.call(rfcommand{Op: "acquire", Key: key, Token: token, TTL: ttl})
+	return result.fence, result.ok, err
+}
+
+// Release releases the lock by the key if it is held by the token.
+func (backend *RaftStorage) Release(key, token string) error {
+	_, err := backend.call(rfcommand{Op: "release", Key: key, Token: token})
+	return err
+}
+
+// Refresh extends the lock by the key for the ttl if it is held by the token.
+func (backend *RaftStorage) Refresh(key, token string, ttl time.Duration) error {
+	_, err := backend.call(rfcommand{Op: "refresh", Key: key, Token: token, TTL: ttl})
+	return err
+}
+
+// Inspect returns the current state of the lock by the key.
+// It passes through the log to not return a stale state.
+func (backend *RaftStorage) Inspect(key string) (Lease, error) {
+	result, err := backend.call(rfcommand{Op: "inspect", Key: key})
+	if err != nil {
+		return Lease{Key: key}, err
+	}
+	return result.lease, nil
+}
+
+// List returns the keys of the held locks with the prefix.
+// It reads the state of the local replica, so it can be stale.
+func (backend *RaftStorage) List(prefix string) ([]string, error) {
+	return backend.locks.List(prefix)
+}
+
+// Semaphore returns the view of the storage which implements
+// the SemaphoreBackend interface.
+func (backend *RaftStorage) Semaphore() *RaftSemaphoreStorage {
+	return &RaftSemaphoreStorage{backend}
+}
+
+// A RaftSemaphoreStorage is the view of the RaftStorage
+// which implements the SemaphoreBackend interface.
+type RaftSemaphoreStorage struct {
+	backend *RaftStorage
+}
+
+// Acquire adds the weight to the holder by the token if the total weight
+// of alive holders doesn't exceed the limit.
+func (view *RaftSemaphoreStorage) Acquire(key, token string, weight, capacity uint32, ttl time.Duration) (bool, error) {
+	result, err := view.backend.call(rfcommand{Op: "sem-acquire", Key: key, Token: token, Weight: weight, Capacity: capacity, TTL: ttl})
+	return result.ok, err
+}
+
+// Release subtracts the weight from the holder by the token and returns
+// the total weight before the release.
+func (view *RaftSemaphoreStorage) Release(key, token string, weight uint32) (uint32, error) {
+	result, err := view.backend.call(rfcommand{Op: "sem-release", Key: key, Token: token, Weight: weight})
+	return result.count, err
+}
+
+// Refresh extends the lease of the holder by the token for the ttl.
+func (view *RaftSemaphoreStorage) Refresh(key, token string, ttl time.Duration) error {
+	_, err := view.backend.call(rfcommand{Op: "sem-refresh", Key: key, Token: token, TTL: ttl})
+	return err
+}
+
+// State returns the total weight of alive holders and the limit.
+func (view *RaftSemaphoreStorage) State(key string, capacity uint32) (uint32, uint32, error) {
+	result, err := view.backend.call(rfcommand{Op: "sem-state", Key: key, Capacity: capacity})
+	return result.count, result.limit, err
+}
+
+// Resize sets the limit and returns the previous one.
+func (view *RaftSemaphoreStorage) Resize(key string, capacity, limit uint32) (uint32, error) {
+	result, err := view.backend.call(rfcommand{Op: "sem-resize", Key: key, Capacity: capacity, Limit: limit})
+	return result.limit, err
+}
+
+// call proposes the command and waits until it is applied.
+// The command is proposed again if it is not committed in time,
+// the applied commands are deduplicated by their ids.
+func (backend *RaftStorage) call(command rfcommand) (rfresult, error) {
+	id, err := newToken()
+	if err != nil {
+		return rfresult{}, err
+	}
+	command.ID, command.Time = id, time.Now().UnixNano()
+	data, err := json.Marshal(command)
+	if err != nil {
+		return rfresult{}, err
+	}
+
+	applied := make(chan rfresult, 1)
+	backend.mu.Lock()
+	backend.pending[id] = applied
+	backend.mu.Unlock()
+	defer func() {
+		backend.mu.Lock()
+		delete(backend.pending, id)
+		backend.mu.Unlock()
+	}()
+
+	deadline := time.NewTimer(backend.timeout)
+	defer deadline.Stop()
+	retry := time.NewTicker(backend.retry)
+	defer retry.Stop()
+	err = backend.node.Propose(data)
+	for {
+		select {
+		case result := <-applied:
+			return result, result.err
+		case <-deadline.C:
+			if err == nil {
+				err = Interrupted
+			}
+			return rfresult{}, err
+		case <-retry.C:
+			err = backend.node.Propose(data)
+		}
+	}
+}
+
+// apply executes committed commands on the local state
+// and notifies their callers.
+func (backend *RaftStorage) apply() {
+	applied := 0
+	for entry := range backend.node.Committed() {
+		if entry.Snapshot {
+			backend.restore(entry.Data)
+			continue
+		}
+		var command rfcommand
+		if err := json.Unmarshal(entry.Data, &command); err != nil {
+			continue
+		}
+
+		backend.mu.Lock()
+		result, found := backend.applied[command.ID]
+		backend.mu.Unlock()
+		if !found {
+			// the clock must not go back because of delayed proposals
+			if command.Time > atomic.LoadInt64(&backend.clock) {
+				atomic.StoreInt64(&backend.clock, command.Time)
+			}
+			result = backend.execute(command)
+		}
+
+		backend.mu.Lock()
+		if !found {
+			backend.remember(command.ID, result)
+		}
+		if caller, waiting := backend.pending[command.ID]; waiting {
+			select {
+			case caller <- result:
+			default:
+			}
+		}
+		backend.mu.Unlock()
+
+		if applied++; applied >= backend.compaction {
+			applied = 0
+			backend.node.Compact(entry.Index, backend.snapshot())
+		}
+	}
+}
+
+func (backend *RaftStorage) execute(command rfcommand) rfresult {
+	var result rfresult
+	switch command.Op {
+	case "acquire":
+		result.fence, result.ok, result.err = backend.locks.Acquire(command.Key, command.Token, command.TTL)
+	case "release":
+		result.err = backend.locks.Release(command.Key, command.Token)
+	case "refresh":
+		result.err = backend.locks.Refresh(command.Key, command.Token, command.TTL)
+	case "inspect":
+		result.lease, result.err = backend.locks.Inspect(command.Key)
+	case "sem-acquire":
+		result.ok, result.err = backend.semaphores.Acquire(command.Key, command.Token, command.Weight, command.Capacity, command.TTL)
+	case "sem-release":
+		result.count, result.err = backend.semaphores.Release(command.Key, command.Token, command.Weight)
+	case "sem-refresh":
+		result.err = backend.semaphores.Refresh(command.Key, command.Token, command.TTL)
+	case "sem-state":
+		result.count, result.limit, result.err = backend.semaphores.State(command.Key, command.Capacity)
+	case "sem-resize":
+		result.limit, result.err = backend.semaphores.Resize(command.Key, command.Capacity, command.Limit)
+	default:
+		result.err = CriticalIssue
+	}
+	return result
+}
+
+// remember keeps results of the recent commands
+// to not apply their repeated proposals twice.
+func (backend *RaftStorage) remember(id string, result rfresult) {
+	backend.applied[id] = result
+	backend.history = append(backend.history, id)
+	if len(backend.history) > 4096 {
+		delete(backend.applied, backend.history[0])
+		backend.history = backend.history[1:]
+	}
+}
+
+// snapshot returns the encoded state of the storage.
+// It must be called by the apply loop.
+func (backend *RaftStorage) snapshot() []byte {
+	state := rfsnapshot{
+		Clock:   atomic.LoadInt64(&backend.clock),
+		Leases:  make(map[string]rflease),
+		Fences:  make(map[string]uint64),
+		Holders: make(map[string]map[string]rfholder),
+		Limits:  make(map[string]uint32),
+	}
+
+	backend.locks.mu.Lock()
+	for key, lease := range backend.locks.leases {
+		state.Leases[key] = rflease{Token: lease.token, Fence: lease.fence, Expire: lease.expire.UnixNano()}
+	}
+	for key, fence := range backend.locks.fences {
+		state.Fences[key] = fence
+	}
+	backend.locks.mu.Unlock()
+
+	backend.semaphores.mu.Lock()
+	for key, holders := range backend.semaphores.holders {
+		state.Holders[key] = make(map[string]rfholder, len(holders))
+		for token, holder := range holders {
+			state.Holders[key][token] = rfholder{Weight: holder.weight, Expire: holder.expire.UnixNano()}
+		}
+	}
+	for key, limit := range backend.semaphores.limits {
+		state.Limits[key] = limit
+	}
+	backend.semaphores.mu.Unlock()
+
+	backend.mu.Lock()
+	for _, id := range backend.history {
+		result := backend.applied[id]
+		applied := rfapplied{ID: id, Fence: result.fence, OK: result.ok, Count: result.count, Limit: result.limit, Lease: result.lease}
+		if result.err != nil {
+			applied.Err = result.err.Error()
+		}
+		state.Applied = append(state.Applied, applied)
+	}
+	backend.mu.Unlock()
+
+	data, _ := json.Marshal(state)
+	return data
+}
+
+// restore replaces the state of the storage by the snapshot.
+// It must be called by the apply loop.
+func (backend *RaftStorage) restore(data []byte) {
+	var state rfsnapshot
+	if err := json.Unmarshal(data, &state); err != nil {
+		return
+	}
+	atomic.StoreInt64(&backend.clock, state.Clock)
+
+	backend.locks.mu.Lock()
+	backend.locks.leases = make(map[string]mlease, len(state.Leases))
+	for key, lease := range state.Leases {
+		backend.locks.leases[key] = mlease{token: lease.Token, fence: lease.Fence, expire: time.Unix(0, lease.Expire)}
+	}
+	backend.locks.fences = make(map[string]uint64, len(state.Fences))
+	for key, fence := range state.Fences {
+		backend.locks.fences[key] = fence
+	}
+	backend.locks.broadcast()
+	backend.locks.mu.Unlock()
+
+	backend.semaphores.mu.Lock()
+	backend.semaphores.holders = make(map[string]map[string]mholder, len(state.Holders))
+	for key, holders := range state.Holders {
+		backend.semaphores.holders[key] = make(map[string]mholder, len(holders))
+		for token, holder := range holders {
+			backend.semaphores.holders[key][token] = mholder{weight: holder.Weight, expire: time.Unix(0, holder.Expire)}
+		}
+	}
+	backend.semaphores.limits = make(map[string]uint32, len(state.Limits))
+	for key, limit := range state.Limits {
+		backend.semaphores.limits[key] = limit
+	}
+	backend.semaphores.mu.Unlock()
+
+	backend.mu.Lock()
+	backend.applied, backend.history = make(map[string]rfresult, len(state.Applied)), nil
+	for _, applied := range state.Applied {
+		result := rfresult{fence: applied.Fence, ok: applied.OK, count: applied.Count, limit: applied.Limit, lease: applied.Lease}
+		if applied.Err != "" {
+			result.err = Error(applied.Err)
+		}
+		backend.remember(applied.ID, result)
+	}
+	backend.mu.Unlock()
+}
+
+func (backend *RaftStorage) time() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&backend.clock))
+}
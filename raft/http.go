@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewHTTPTransport returns a new transport which delivers messages
+// between processes over HTTP. The peers map ids of all nodes
+// of the group to their base URLs. The transport must be served
+// by the node's http.Server at the /raft path of its base URL.
+//
+//  peers := map[string]string{"a": "http://10.0.0.1:7000", "b": "http://10.0.0.2:7000", "c": "http://10.0.0.3:7000"}
+//  transport := raft.NewHTTPTransport(peers, nil)
+//  http.Handle("/raft", transport)
+//  go http.ListenAndServe(":7000", nil)
+//
+//  node := raft.NewNode("a", []string{"a", "b", "c"}, transport)
+//
+func NewHTTPTransport(peers map[string]string, client *http.Client) *HTTPTransport {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	urls := make(map[string]string, len(peers))
+	for id, url := range peers {
+		urls[id] = strings.TrimRight(url, "/") + "/raft"
+	}
+	return &HTTPTransport{urls: urls, http: client, timeout: time.Second, inbox: make(chan Message, 1024)}
+}
+
+// HTTPTransport is a transport over HTTP which implements
+// the http.Handler interface to receive messages.
+type HTTPTransport struct {
+	urls    map[string]string
+	http    *http.Client
+	timeout time.Duration
+	inbox   chan Message
+}
+
+// Send sends the message to the node by its To field in background.
+// The message is lost if the node is unavailable.
+func (transport *HTTPTransport) Send(message Message) {
+	url, found := transport.urls[message.To]
+	if !found {
+		return
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), transport.timeout)
+		defer cancel()
+		req.Header.Set("Content-Type", "application/json")
+		response, err := transport.http.Do(req.WithContext(ctx))
+		if err != nil {
+			return
+		}
+		_ = response.Body.Close()
+	}()
+}
+
+// Receive returns the channel of messages addressed to the node.
+func (transport *HTTPTransport) Receive() <-chan Message {
+	return transport.inbox
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (transport *HTTPTransport) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var message Message
+	if err := json.NewDecoder(req.Body).Decode(&message); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case transport.inbox <- message:
+	default:
+		// the node is overloaded, so the message is lost
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
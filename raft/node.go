@@ -0,0 +1,560 @@
+// Package raft implements a minimal Raft consensus to replicate a log
+// of commands between a group of nodes. It covers the leader election,
+// the log replication and the log compaction by snapshots of the state
+// of the consumer, but not membership changes or persistence. The log
+// is kept in memory, so a crashed node must not rejoin the group
+// with the same id.
+package raft
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// NewNode returns a new member of the group by the id which exchanges
+// messages with the peers through the transport. The peers must contain
+// ids of all other members of the group. The node works in background
+// until the Stop method is called.
+//
+//  network := raft.NewNetwork()
+//  ids := []string{"a", "b", "c"}
+//  nodes := make([]*raft.Node, 0, len(ids))
+//  for _, id := range ids {
+//  	nodes = append(nodes, raft.NewNode(id, ids, network.Transport(id)))
+//  }
+//
+func NewNode(id string, peers []string, transport Transport, options ...NodeOption) *Node {
+	node := &Node{
+		id:        id,
+		transport: transport,
+		heartbeat: 50 * time.Millisecond,
+		election:  500 * time.Millisecond,
+		log:       []Entry{{}},
+		signal:    make(chan struct{}),
+		committed: make(chan Entry),
+		stop:      make(chan struct{}),
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, peer := range peers {
+		if peer != id {
+			node.peers = append(node.peers, peer)
+		}
+	}
+	for _, option := range options {
+		option(node)
+	}
+	node.resetDeadline()
+
+	node.wg.Add(2)
+	go node.run()
+	go node.deliver()
+	return node
+}
+
+// NodeOption configures the member of the group.
+type NodeOption func(*Node)
+
+// NodeWithHeartbeat sets up the interval between messages of the leader
+// to the followers. It must be much less than the election timeout.
+func NodeWithHeartbeat(interval time.Duration) NodeOption {
+	return func(node *Node) { node.heartbeat = interval }
+}
+
+// NodeWithElectionTimeout sets up the minimal time without messages
+// from the leader after which the follower starts a new election.
+// The actual timeout is randomized up to its double.
+func NodeWithElectionTimeout(timeout time.Duration) NodeOption {
+	return func(node *Node) { node.election = timeout }
+}
+
+// Node is a member of the group.
+type Node struct {
+	id        string
+	peers     []string
+	transport Transport
+	heartbeat time.Duration
+	election  time.Duration
+
+	mu       sync.Mutex
+	role     role
+	term     uint64
+	votedFor string
+	leader   string
+	log      []Entry // the first entry is a sentinel of the snapshot
+	snapshot []byte
+	commit   uint64
+	applied  uint64
+	signal   chan struct{}
+	votes    map[string]struct{}
+	next     map[string]uint64
+	match    map[string]uint64
+	contact  map[string]time.Time
+	deadline time.Time
+	random   *rand.Rand
+
+	committed chan Entry
+	once      sync.Once
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+// ID returns the id of the node.
+func (node *Node) ID() string {
+	return node.id
+}
+
+// Leader returns the id of the current leader known by the node
+// or an empty string if it is unknown.
+func (node *Node) Leader() string {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.leader
+}
+
+// Committed returns the channel of entries committed by the group
+// in the order of the log. It is closed when the node is stopped.
+// The channel must have a single consumer which applies entries
+// to its state, the node doesn't proceed until they are received.
+// If the node is far behind the leader which compacted its log,
+// the consumer receives the snapshot entry to replace its state.
+func (node *Node) Committed() <-chan Entry {
+	return node.committed
+}
+
+// Compact discards entries of the log up to the index, which must be
+// already received from the Committed channel, and keeps the state
+// of the consumer after them as the snapshot. The snapshot is sent
+// to followers which need the discarded entries.
+//
+//  for entry := range node.Committed() {
+//  	if entry.Snapshot {
+//  		restore(entry.Data)
+//  		continue
+//  	}
+//  	apply(entry.Data)
+//  	if entry.Index%1024 == 0 {
+//  		node.Compact(entry.Index, snapshot())
+//  	}
+//  }
+//
+func (node *Node) Compact(index uint64, state []byte) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	offset := node.offset()
+	if index <= offset || index > node.applied {
+		return
+	}
+	// the copy releases the memory of discarded entries
+	log := make([]Entry, 0, len(node.log)-int(index-offset))
+	log = append(log, Entry{Term: node.entry(index).Term, Index: index})
+	node.log = append(log, node.log[index-offset+1:]...)
+	node.snapshot = state
+}
+
+// Propose appends the command to the log through the leader.
+// It doesn't wait for the commit, and the command could be lost
+// if the leader has changed, so it is the caller's duty to watch
+// the committed entries and repeat the proposal.
+func (node *Node) Propose(data []byte) error {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	select {
+	case <-node.stop:
+		return Stopped
+	default:
+	}
+	switch {
+	case node.role == leader:
+		node.append(data)
+	case node.leader != "":
+		node.send(Message{Type: Proposal, To: node.leader, Entries: []Entry{{Data: data}}})
+	default:
+		return NoLeader
+	}
+	return nil
+}
+
+// Stop stops the node. It stops to respond to messages as it crashed.
+func (node *Node) Stop() {
+	node.once.Do(func() { close(node.stop) })
+	node.wg.Wait()
+}
+
+func (node *Node) run() {
+	defer node.wg.Done()
+
+	ticker := time.NewTicker(node.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-node.stop:
+			return
+		case message := <-node.transport.Receive():
+			node.mu.Lock()
+			node.step(message)
+			node.mu.Unlock()
+		case <-ticker.C:
+			node.mu.Lock()
+			node.tick()
+			node.mu.Unlock()
+		}
+	}
+}
+
+// deliver sends committed entries to the consumer, or the snapshot
+// if they are compacted already. It skips empty entries appended
+// by new leaders.
+func (node *Node) deliver() {
+	defer node.wg.Done()
+	defer close(node.committed)
+
+	for {
+		node.mu.Lock()
+		signal := node.signal
+		var entries []Entry
+		if offset := node.offset(); node.applied < offset {
+			entries = append(entries, Entry{Term: node.log[0].Term, Index: offset, Data: node.snapshot, Snapshot: true})
+		} else if node.commit > node.applied {
+			entries = append(entries, node.log[node.applied+1-offset:node.commit+1-offset]...)
+		}
+		node.mu.Unlock()
+
+		if len(entries) == 0 {
+			select {
+			case <-node.stop:
+				return
+			case <-signal:
+			}
+			continue
+		}
+		for _, entry := range entries {
+			// the entry is applied since it is sent,
+			// so the consumer can compact the log by it
+			node.mu.Lock()
+			if entry.Index > node.applied {
+				node.applied = entry.Index
+			}
+			node.mu.Unlock()
+			if entry.Data == nil && !entry.Snapshot {
+				continue
+			}
+			select {
+			case <-node.stop:
+				return
+			case node.committed <- entry:
+			}
+		}
+	}
+}
+
+func (node *Node) tick() {
+	if node.role != leader {
+		if time.Now().After(node.deadline) {
+			node.campaign()
+		}
+		return
+	}
+
+	// the leader steps down if it lost the majority,
+	// so its clients look for a new one
+	now, alive := time.Now(), 1
+	for _, peer := range node.peers {
+		if now.Sub(node.contact[peer]) < node.election {
+			alive++
+		}
+	}
+	if alive < node.quorum() {
+		node.becomeFollower(node.term, "")
+		return
+	}
+	for _, peer := range node.peers {
+		node.replicate(peer)
+	}
+}
+
+func (node *Node) step(message Message) {
+	if message.Type == Proposal {
+		if node.role == leader {
+			for _, entry := range message.Entries {
+				node.append(entry.Data)
+			}
+		}
+		return
+	}
+	if message.Term > node.term {
+		node.becomeFollower(message.Term, "")
+	}
+
+	switch message.Type {
+	case VoteRequest:
+		last := node.lastIndex()
+		granted := message.Term == node.term &&
+			(node.votedFor == "" || node.votedFor == message.From) &&
+			(message.LogTerm > node.entry(last).Term || message.LogTerm == node.entry(last).Term && message.Index >= last)
+		if granted {
+			node.votedFor = message.From
+			node.resetDeadline()
+		}
+		node.send(Message{Type: VoteResponse, To: message.From, Term: node.term, Success: granted})
+	case VoteResponse:
+		if node.role != candidate || message.Term != node.term || !message.Success {
+			return
+		}
+		node.votes[message.From] = struct{}{}
+		if len(node.votes) >= node.quorum() {
+			node.becomeLeader()
+		}
+	case AppendRequest:
+		node.accept(message)
+	case SnapshotRequest:
+		node.install(message)
+	case AppendResponse:
+		if node.role != leader || message.Term != node.term {
+			return
+		}
+		node.contact[message.From] = time.Now()
+		if !message.Success {
+			// the follower's log diverges, so move back to the hint
+			next := node.next[message.From] - 1
+			if message.Index+1 < next {
+				next = message.Index + 1
+			}
+			if next < 1 {
+				next = 1
+			}
+			node.next[message.From] = next
+			node.replicate(message.From)
+			return
+		}
+		if message.Index > node.match[message.From] {
+			node.match[message.From] = message.Index
+		}
+		if message.Index+1 > node.next[message.From] {
+			node.next[message.From] = message.Index + 1
+		}
+		node.advance()
+	}
+}
+
+// accept appends entries of the leader to the log
+// if it contains the entry preceding them.
+func (node *Node) accept(message Message) {
+	last := node.lastIndex()
+	if message.Term < node.term {
+		node.send(Message{Type: AppendResponse, To: message.From, Term: node.term, Index: last})
+		return
+	}
+	node.becomeFollower(message.Term, message.From)
+
+	prev, term, entries := message.Index, message.LogTerm, message.Entries
+	if offset := node.offset(); prev < offset {
+		// the compacted entries are committed, so they match
+		if skip := offset - prev; skip < uint64(len(entries)) {
+			entries = entries[skip:]
+		} else {
+			entries = nil
+		}
+		prev, term = offset, node.log[0].Term
+	}
+	if prev > last || node.entry(prev).Term != term {
+		hint := last
+		if prev <= last {
+			hint = prev - 1
+		}
+		node.send(Message{Type: AppendResponse, To: message.From, Term: node.term, Index: hint})
+		return
+	}
+	for i, entry := range entries {
+		index := prev + 1 + uint64(i)
+		if index <= node.lastIndex() {
+			if node.entry(index).Term == entry.Term {
+				continue
+			}
+			// the conflicting entries are never committed
+			node.log = node.log[:index-node.offset()]
+		}
+		node.log = append(node.log, entry)
+	}
+	matched := prev + uint64(len(entries))
+	if commit := min(message.Commit, matched); commit > node.commit {
+		node.setCommit(commit)
+	}
+	node.send(Message{Type: AppendResponse, To: message.From, Term: node.term, Index: matched, Success: true})
+}
+
+// install replaces the log by the snapshot of the leader
+// if it is ahead of the committed entries.
+func (node *Node) install(message Message) {
+	if message.Term < node.term {
+		node.send(Message{Type: AppendResponse, To: message.From, Term: node.term, Index: node.lastIndex()})
+		return
+	}
+	node.becomeFollower(message.Term, message.From)
+
+	if message.Index > node.commit {
+		sentinel := Entry{Term: message.LogTerm, Index: message.Index}
+		if message.Index <= node.lastIndex() && node.entry(message.Index).Term == message.LogTerm {
+			// the entries after the snapshot could be committed later
+			node.log = append([]Entry{sentinel}, node.log[message.Index-node.offset()+1:]...)
+		} else {
+			node.log = []Entry{sentinel}
+		}
+		node.snapshot = message.Snapshot
+		node.setCommit(message.Index)
+	}
+	node.send(Message{Type: AppendResponse, To: message.From, Term: node.term, Index: message.Index, Success: true})
+}
+
+func (node *Node) campaign() {
+	node.role, node.leader = candidate, ""
+	node.term++
+	node.votedFor = node.id
+	node.votes = map[string]struct{}{node.id: {}}
+	node.resetDeadline()
+	if len(node.votes) >= node.quorum() {
+		node.becomeLeader()
+		return
+	}
+
+	last := node.lastIndex()
+	for _, peer := range node.peers {
+		node.send(Message{Type: VoteRequest, To: peer, Term: node.term, Index: last, LogTerm: node.entry(last).Term})
+	}
+}
+
+func (node *Node) becomeFollower(term uint64, leader string) {
+	if term > node.term {
+		node.term, node.votedFor = term, ""
+	}
+	node.role, node.leader = follower, leader
+	node.resetDeadline()
+}
+
+func (node *Node) becomeLeader() {
+	node.role, node.leader = leader, node.id
+	node.next = make(map[string]uint64, len(node.peers))
+	node.match = make(map[string]uint64, len(node.peers))
+	node.contact = make(map[string]time.Time, len(node.peers))
+	now := time.Now()
+	for _, peer := range node.peers {
+		node.next[peer], node.contact[peer] = node.lastIndex()+1, now
+	}
+	// the empty entry of the new term commits entries of previous ones
+	node.append(nil)
+}
+
+// append adds the command to the log of the leader and replicates it.
+func (node *Node) append(data []byte) {
+	node.log = append(node.log, Entry{Term: node.term, Index: node.lastIndex() + 1, Data: data})
+	for _, peer := range node.peers {
+		node.replicate(peer)
+	}
+	node.advance()
+}
+
+// replicate sends the entries the peer doesn't have yet,
+// or the snapshot if they are compacted already.
+func (node *Node) replicate(peer string) {
+	next := node.next[peer]
+	if last := node.lastIndex(); next > last+1 {
+		next = last + 1
+	}
+	offset := node.offset()
+	if next <= offset {
+		node.send(Message{
+			Type:     SnapshotRequest,
+			To:       peer,
+			Term:     node.term,
+			Index:    offset,
+			LogTerm:  node.log[0].Term,
+			Snapshot: node.snapshot,
+		})
+		return
+	}
+	entries := node.log[next-offset:]
+	if len(entries) > maxBatch {
+		entries = entries[:maxBatch]
+	}
+	node.send(Message{
+		Type:    AppendRequest,
+		To:      peer,
+		Term:    node.term,
+		Index:   next - 1,
+		LogTerm: node.entry(next - 1).Term,
+		Entries: append([]Entry(nil), entries...),
+		Commit:  node.commit,
+	})
+}
+
+// advance commits the last entry of the current term
+// replicated by the majority.
+func (node *Node) advance() {
+	for index := node.lastIndex(); index > node.commit && node.entry(index).Term == node.term; index-- {
+		replicated := 1
+		for _, peer := range node.peers {
+			if node.match[peer] >= index {
+				replicated++
+			}
+		}
+		if replicated >= node.quorum() {
+			node.setCommit(index)
+			return
+		}
+	}
+}
+
+func (node *Node) setCommit(index uint64) {
+	node.commit = index
+	close(node.signal)
+	node.signal = make(chan struct{})
+}
+
+func (node *Node) send(message Message) {
+	message.From = node.id
+	node.transport.Send(message)
+}
+
+func (node *Node) resetDeadline() {
+	timeout := node.election + time.Duration(node.random.Int63n(int64(node.election)+1))
+	node.deadline = time.Now().Add(timeout)
+}
+
+// entry returns the entry of the log by the index
+// which must not be compacted.
+func (node *Node) entry(index uint64) Entry {
+	return node.log[index-node.offset()]
+}
+
+// offset returns the index of the last compacted entry.
+func (node *Node) offset() uint64 {
+	return node.log[0].Index
+}
+
+func (node *Node) lastIndex() uint64 {
+	return node.offset() + uint64(len(node.log)-1)
+}
+
+func (node *Node) quorum() int {
+	return (len(node.peers)+1)/2 + 1
+}
+
+// maxBatch limits the number of entries in a single message.
+const maxBatch = 64
+
+func min(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
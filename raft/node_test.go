@@ -0,0 +1,335 @@
+package raft_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker/raft"
+)
+
+func TestNode(t *testing.T) {
+	t.Run("replication", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		group := newGroup(NewNetwork().Transport, "a", "b", "c")
+		defer group.stop()
+
+		leader := group.leader(ctx, t)
+		follower := group.other(leader)
+		for _, command := range []string{"x", "y", "z"} {
+			group.commit(ctx, t, follower, command)
+		}
+		group.converge(ctx, t, group.nodes, []string{"x", "y", "z"})
+	})
+
+	t.Run("http transport", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		ids := []string{"a", "b", "c"}
+		peers := make(map[string]string, len(ids))
+		transports := make(map[string]*HTTPTransport, len(ids))
+		for _, id := range ids {
+			id := id
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				transports[id].ServeHTTP(rw, req)
+			}))
+			defer server.Close()
+			peers[id] = server.URL
+		}
+		for _, id := range ids {
+			transports[id] = NewHTTPTransport(peers, nil)
+		}
+
+		group := newGroup(func(id string) Transport { return transports[id] }, ids...)
+		defer group.stop()
+
+		group.commit(ctx, t, group.other(group.leader(ctx, t)), "x")
+		group.converge(ctx, t, group.nodes, []string{"x"})
+	})
+
+	t.Run("leader crash", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		group := newGroup(NewNetwork().Transport, "a", "b", "c")
+		defer group.stop()
+
+		leader := group.leader(ctx, t)
+		group.commit(ctx, t, leader, "before")
+		leader.Stop()
+
+		alive := group.without(leader)
+		next := group.leader(ctx, t, alive...)
+		if next == leader {
+			t.Error("the crashed node must not lead")
+			t.FailNow()
+		}
+		group.commit(ctx, t, next, "after")
+		group.converge(ctx, t, alive, []string{"before", "after"})
+	})
+
+	t.Run("partition", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		network := NewNetwork()
+		group := newGroup(network.Transport, "a", "b", "c", "d", "e")
+		defer group.stop()
+
+		leader := group.leader(ctx, t)
+		group.commit(ctx, t, leader, "before")
+
+		majority := group.without(leader, group.other(leader))
+		ids := make([]string, 0, len(majority))
+		for _, node := range majority {
+			ids = append(ids, node.ID())
+		}
+		network.Partition(ids)
+
+		for leader.Leader() != "" {
+			select {
+			case <-ctx.Done():
+				t.Error("the leader of the minority must step down")
+				t.FailNow()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		if err := leader.Propose([]byte("lost")); err != NoLeader {
+			t.Errorf("unexpected error %v", err)
+			t.FailNow()
+		}
+
+		next := group.leader(ctx, t, majority...)
+		group.commit(ctx, t, next, "during")
+
+		network.Heal()
+		group.commit(ctx, t, group.leader(ctx, t), "after")
+		group.converge(ctx, t, group.nodes, []string{"before", "during", "after"})
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		network := NewNetwork()
+		group := newGroup(network.Transport, "a", "b", "c")
+		defer group.stop()
+
+		leader := group.leader(ctx, t)
+		lagging := group.other(leader)
+		alive := group.without(lagging)
+		network.Partition([]string{alive[0].ID(), alive[1].ID()})
+
+		expected := make([]string, 0, 3*compaction)
+		for i := 0; i < cap(expected); i++ {
+			command := strconv.Itoa(i)
+			group.commit(ctx, t, leader, command)
+			expected = append(expected, command)
+		}
+		network.Heal()
+		group.converge(ctx, t, group.nodes, expected)
+
+		group.mu.Lock()
+		restored := group.restored[lagging]
+		group.mu.Unlock()
+		if restored == 0 {
+			t.Error("the lagging node must restore the state from the snapshot")
+			t.FailNow()
+		}
+	})
+
+	t.Run("message loss", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		network := NewNetwork()
+		group := newGroup(network.Transport, "a", "b", "c")
+		defer group.stop()
+
+		network.SetLoss(0.2)
+		expected := make([]string, 0, 20)
+		for i := 0; i < 20; i++ {
+			command := strconv.Itoa(i)
+			group.commit(ctx, t, group.nodes[i%len(group.nodes)], command)
+			expected = append(expected, command)
+		}
+		network.SetLoss(0)
+
+		// repeated proposals could be committed twice,
+		// but all nodes must agree on the same log
+		logs := make([][]string, 0, len(group.nodes))
+		for _, node := range group.nodes {
+			group.wait(ctx, t, node, expected[len(expected)-1])
+			logs = append(logs, group.log(node))
+		}
+		for _, log := range logs[1:] {
+			size := len(log)
+			if len(logs[0]) < size {
+				size = len(logs[0])
+			}
+			if !reflect.DeepEqual(log[:size], logs[0][:size]) {
+				t.Errorf("the logs diverge: %v and %v", logs[0], log)
+				t.FailNow()
+			}
+		}
+	})
+}
+
+// compaction is the number of entries after which nodes of the group
+// compact their logs.
+const compaction = 4
+
+type group struct {
+	nodes []*Node
+
+	mu        sync.Mutex
+	committed map[*Node][]string
+	restored  map[*Node]int
+}
+
+func newGroup(transport func(string) Transport, ids ...string) *group {
+	g := &group{committed: make(map[*Node][]string), restored: make(map[*Node]int)}
+	for _, id := range ids {
+		node := NewNode(id, ids, transport(id),
+			NodeWithHeartbeat(5*time.Millisecond),
+			NodeWithElectionTimeout(50*time.Millisecond),
+		)
+		g.nodes = append(g.nodes, node)
+		go func() {
+			applied := 0
+			for entry := range node.Committed() {
+				g.mu.Lock()
+				if entry.Snapshot {
+					var log []string
+					_ = json.Unmarshal(entry.Data, &log)
+					g.committed[node] = log
+					g.restored[node]++
+					g.mu.Unlock()
+					continue
+				}
+				g.committed[node] = append(g.committed[node], string(entry.Data))
+				state, _ := json.Marshal(g.committed[node])
+				g.mu.Unlock()
+				if applied++; applied%compaction == 0 {
+					node.Compact(entry.Index, state)
+				}
+			}
+		}()
+	}
+	return g
+}
+
+func (g *group) stop() {
+	for _, node := range g.nodes {
+		node.Stop()
+	}
+}
+
+// leader waits for the node which leads the majority of the nodes.
+func (g *group) leader(ctx context.Context, t *testing.T, nodes ...*Node) *Node {
+	if len(nodes) == 0 {
+		nodes = g.nodes
+	}
+	for {
+		votes := make(map[string]int)
+		for _, node := range nodes {
+			votes[node.Leader()]++
+		}
+		for _, node := range nodes {
+			if node.Leader() == node.ID() && votes[node.ID()] > len(g.nodes)/2 {
+				return node
+			}
+		}
+		select {
+		case <-ctx.Done():
+			t.Error("the leader must be elected")
+			t.FailNow()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func (g *group) other(node *Node) *Node {
+	return g.without(node)[0]
+}
+
+func (g *group) without(excluded ...*Node) []*Node {
+	nodes := make([]*Node, 0, len(g.nodes))
+	for _, node := range g.nodes {
+		found := false
+		for _, candidate := range excluded {
+			found = found || node == candidate
+		}
+		if !found {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// commit proposes the command through the node
+// until it is committed by the node.
+func (g *group) commit(ctx context.Context, t *testing.T, node *Node, command string) {
+	for {
+		_ = node.Propose([]byte(command))
+		retry := time.After(200 * time.Millisecond)
+		for waiting := true; waiting; {
+			for _, committed := range g.log(node) {
+				if committed == command {
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				t.Errorf("the command %q must be committed", command)
+				t.FailNow()
+			case <-retry:
+				waiting = false
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}
+}
+
+// wait waits until the node commits the command.
+func (g *group) wait(ctx context.Context, t *testing.T, node *Node, command string) {
+	for {
+		for _, committed := range g.log(node) {
+			if committed == command {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			t.Errorf("the command %q must be committed by %s", command, node.ID())
+			t.FailNow()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// converge waits until the nodes commit exactly the commands.
+func (g *group) converge(ctx context.Context, t *testing.T, nodes []*Node, commands []string) {
+	for _, node := range nodes {
+		g.wait(ctx, t, node, commands[len(commands)-1])
+		if log := g.log(node); !reflect.DeepEqual(log, commands) {
+			t.Errorf("unexpected log %v of %s", log, node.ID())
+			t.FailNow()
+		}
+	}
+}
+
+func (g *group) log(node *Node) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.committed[node]...)
+}
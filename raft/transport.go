@@ -0,0 +1,179 @@
+package raft
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Error defines the package errors.
+type Error string
+
+// Error returns the string representation of the error.
+func (err Error) Error() string {
+	return string(err)
+}
+
+// NoLeader is the error related to an election in progress
+// or a node cut off from the majority.
+const NoLeader Error = "raft: leader is unknown"
+
+// Stopped is the error related to a call of the stopped node.
+const Stopped Error = "raft: node is stopped"
+
+// Entry is a command of the replicated log.
+type Entry struct {
+	Term  uint64 `json:"term"`
+	Index uint64 `json:"index"`
+	Data  []byte `json:"data,omitempty"`
+	// Snapshot means the Data is the state of the consumer
+	// after the entry by the Index instead of a command.
+	Snapshot bool `json:"snapshot,omitempty"`
+}
+
+// MessageType defines a kind of the message.
+type MessageType string
+
+const (
+	// VoteRequest asks for a vote in the election.
+	VoteRequest MessageType = "vote"
+	// VoteResponse grants or rejects the vote.
+	VoteResponse MessageType = "vote-response"
+	// AppendRequest replicates entries of the leader, it is also a heartbeat.
+	AppendRequest MessageType = "append"
+	// AppendResponse confirms or rejects the replicated entries.
+	AppendResponse MessageType = "append-response"
+	// Proposal forwards a command from a follower to the leader.
+	Proposal MessageType = "proposal"
+	// SnapshotRequest replaces the log of a follower far behind
+	// the leader by its snapshot, it is confirmed by the AppendResponse.
+	SnapshotRequest MessageType = "snapshot"
+)
+
+// Message is a unit of communication between nodes.
+type Message struct {
+	Type MessageType `json:"type"`
+	From string      `json:"from"`
+	To   string      `json:"to"`
+	Term uint64      `json:"term,omitempty"`
+	// Index is the last index of the candidate's log in the VoteRequest,
+	// the index preceding entries in the AppendRequest, the last index
+	// of the snapshot in the SnapshotRequest or the last matched index,
+	// or the hint on rejection, in the AppendResponse.
+	Index uint64 `json:"index,omitempty"`
+	// LogTerm is the term of the entry by the Index.
+	LogTerm uint64  `json:"log_term,omitempty"`
+	Entries []Entry `json:"entries,omitempty"`
+	Commit  uint64  `json:"commit,omitempty"`
+	// Success means the vote is granted or entries are accepted.
+	Success bool `json:"success,omitempty"`
+	// Snapshot is the state of the consumer of the leader.
+	Snapshot []byte `json:"snapshot,omitempty"`
+}
+
+// Transport delivers messages between nodes. It may lose, duplicate
+// or reorder them, so the Send method must not block.
+type Transport interface {
+	// Send sends the message to the node by its To field.
+	Send(Message)
+	// Receive returns the channel of messages addressed to the node.
+	Receive() <-chan Message
+}
+
+// NewNetwork returns a new in-memory network to connect nodes
+// of a single process. It can simulate partitions and message loss,
+// and the Stop method of a node simulates its crash.
+//
+//  network := raft.NewNetwork()
+//  network.Partition([]string{"a"}, []string{"b", "c"})
+//  network.SetLoss(0.1)
+//
+func NewNetwork() *Network {
+	return &Network{
+		inboxes: make(map[string]chan Message),
+		groups:  make(map[string]int),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Network is an in-memory network of nodes.
+type Network struct {
+	mu      sync.Mutex
+	inboxes map[string]chan Message
+	groups  map[string]int
+	loss    float64
+	random  *rand.Rand
+}
+
+// Transport returns the transport of the node by the id.
+func (network *Network) Transport(id string) Transport {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+
+	inbox, found := network.inboxes[id]
+	if !found {
+		inbox = make(chan Message, 1024)
+		network.inboxes[id] = inbox
+	}
+	return &mtransport{network: network, inbox: inbox}
+}
+
+// Partition splits the network into the groups of nodes, so nodes
+// of different groups can't exchange messages. Nodes not listed
+// in any group form a separate one.
+func (network *Network) Partition(groups ...[]string) {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+
+	network.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, id := range group {
+			network.groups[id] = i + 1
+		}
+	}
+}
+
+// Heal removes all partitions of the network.
+func (network *Network) Heal() {
+	network.Partition()
+}
+
+// SetLoss sets up the probability to lose a message.
+func (network *Network) SetLoss(rate float64) {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+
+	network.loss = rate
+}
+
+func (network *Network) deliver(message Message) {
+	network.mu.Lock()
+	inbox, found := network.inboxes[message.To]
+	lost := network.groups[message.From] != network.groups[message.To] ||
+		network.loss > 0 && network.random.Float64() < network.loss
+	network.mu.Unlock()
+	if !found || lost {
+		return
+	}
+
+	select {
+	case inbox <- message:
+	default:
+		// the node is overloaded or stopped
+	}
+}
+
+type mtransport struct {
+	network *Network
+	inbox   chan Message
+}
+
+// Send sends the message to the node by its To field.
+func (transport *mtransport) Send(message Message) {
+	transport.network.deliver(message)
+}
+
+// Receive returns the channel of messages addressed to the node.
+func (transport *mtransport) Receive() <-chan Message {
+	return transport.inbox
+}
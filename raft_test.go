@@ -0,0 +1,210 @@
+package locker_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/raft"
+)
+
+func TestRaftBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	nodes, _, stop := raftGroup(t, 3)
+	defer stop()
+
+	backends := make(map[string]Backend, len(nodes))
+	for _, node := range nodes {
+		backends[node.ID()] = RaftBackend(node, RaftWithRetry(20*time.Millisecond))
+	}
+	leader := nodes[0].Leader()
+	follower := nodes[0].ID()
+	if follower == leader {
+		follower = nodes[1].ID()
+	}
+
+	t.Run("replication", func(t *testing.T) {
+		lock := Distributed(time.Minute, DistributedWithKey(t.Name()), DistributedWithBackend(backends[follower]))
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		for id, backend := range backends {
+			lease, err := backend.Inspect(t.Name())
+			if err != nil || !lease.Held() || lease.Fence != lock.Fence() {
+				t.Errorf("unexpected lease %+v on %s", lease, id)
+				t.FailNow()
+			}
+		}
+		if _, acquired, err := backends[leader].Acquire(t.Name(), "stranger", time.Minute); err != nil || acquired {
+			t.Error("the lock must be held")
+			t.FailNow()
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("list during refreshes", func(t *testing.T) {
+		lock := Distributed(time.Minute,
+			DistributedWithKey(t.Name()),
+			DistributedWithBackend(backends[follower]),
+			DistributedWithRefresh(time.Millisecond),
+		)
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		// the local state is read while the refreshes are applied
+		for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); {
+			if keys, err := backends[follower].(Lister).List(t.Name()); err != nil || len(keys) != 1 {
+				t.Errorf("unexpected keys %v: %v", keys, err)
+				t.FailNow()
+			}
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("leader crash", func(t *testing.T) {
+		lock := Distributed(time.Minute, DistributedWithKey(t.Name()), DistributedWithBackend(backends[follower]))
+		if err := lock.Lock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		for _, node := range nodes {
+			if node.ID() == leader {
+				node.Stop()
+			}
+		}
+
+		for id, backend := range backends {
+			if id == leader {
+				continue
+			}
+			if lease, err := backend.Inspect(t.Name()); err != nil || lease.Fence != lock.Fence() {
+				t.Errorf("the lease must survive the crash of the leader: %+v, %v", lease, err)
+				t.FailNow()
+			}
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("majority crash", func(t *testing.T) {
+		backend := backends[follower]
+		for _, node := range nodes {
+			if node.ID() != follower {
+				node.Stop()
+			}
+		}
+		if _, _, err := backend.Acquire(t.Name(), "token", time.Minute); err == nil {
+			t.Error("the lock must not be taken without the majority")
+			t.FailNow()
+		}
+	})
+}
+
+func TestRaftBackend_Compaction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	nodes, network, stop := raftGroup(t, 3)
+	defer stop()
+
+	backends := make(map[string]Backend, len(nodes))
+	for _, node := range nodes {
+		backends[node.ID()] = RaftBackend(node, RaftWithRetry(20*time.Millisecond), RaftWithCompaction(4))
+	}
+	leader := nodes[0].Leader()
+	var alive []string
+	var lagging string
+	for _, node := range nodes {
+		if node.ID() != leader && lagging == "" {
+			lagging = node.ID()
+			continue
+		}
+		alive = append(alive, node.ID())
+	}
+	network.Partition(alive)
+
+	// the log of the majority is compacted while the node is cut off
+	for i := 0; i < 16; i++ {
+		if _, acquired, err := backends[leader].Acquire(t.Name(), strconv.Itoa(i), time.Minute); err != nil || !acquired {
+			t.Errorf("unexpected result %v, %v", acquired, err)
+			t.FailNow()
+		}
+		if err := backends[leader].Release(t.Name(), strconv.Itoa(i)); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	}
+	fence, acquired, err := backends[leader].Acquire(t.Name(), "token", time.Minute)
+	if err != nil || !acquired {
+		t.Errorf("unexpected result %v, %v", acquired, err)
+		t.FailNow()
+	}
+	network.Heal()
+
+	for {
+		if keys, _ := backends[lagging].(Lister).List(t.Name()); len(keys) == 1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Error("the lagging node must restore the state from the snapshot")
+			t.FailNow()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if lease, err := backends[lagging].Inspect(t.Name()); err != nil || lease.Token != "token" || lease.Fence != fence {
+		t.Errorf("unexpected lease %+v: %v", lease, err)
+		t.FailNow()
+	}
+	if _, acquired, err := backends[lagging].Acquire(t.Name(), "stranger", time.Minute); err != nil || acquired {
+		t.Error("the lock must be held")
+		t.FailNow()
+	}
+}
+
+// raftGroup starts the group of nodes connected by the in-memory
+// network and waits for its leader.
+func raftGroup(t *testing.T, size int) ([]*raft.Node, *raft.Network, func()) {
+	network := raft.NewNetwork()
+	ids := make([]string, 0, size)
+	for i := 0; i < size; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	nodes := make([]*raft.Node, 0, size)
+	for _, id := range ids {
+		nodes = append(nodes, raft.NewNode(id, ids, network.Transport(id),
+			raft.NodeWithHeartbeat(5*time.Millisecond),
+			raft.NodeWithElectionTimeout(50*time.Millisecond),
+		))
+	}
+	stop := func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for nodes[0].Leader() == "" {
+		if time.Now().After(deadline) {
+			stop()
+			t.Error("the leader must be elected")
+			t.FailNow()
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nodes, network, stop
+}
@@ -0,0 +1,338 @@
+package locker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kamilsk/locker/internal/redis"
+)
+
+// DistributedWithRedis sets up the Redis server by the address
+// as a storage of the lock state.
+//
+//  lock := locker.Distributed(time.Minute, locker.DistributedWithRedis("127.0.0.1:6379"))
+//
+func DistributedWithRedis(addr string) DistributedOption {
+	return DistributedWithBackend(RedisBackend(addr))
+}
+
+// RedisBackend returns a new storage of the distributed lock state
+// based on the Redis server by the address.
+//
+// The key holds a random owner token and expires after the ttl,
+// so the lock can't be held forever by a crashed process.
+func RedisBackend(addr string) *RedisStorage {
+	return &RedisStorage{client: redis.New(addr, time.Second)}
+}
+
+// A RedisStorage keeps the distributed lock state in Redis,
+// see RedisBackend.
+type RedisStorage struct {
+	client *redis.Client
+}
+
+// Acquire tries to take the lock by the key for the token
+// and returns true if it succeeded with its fencing token.
+func (backend *RedisStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	reply, err := backend.client.Do("EVAL", redis.AcquireScript, "2", key, fenceKey(key), token, milliseconds(ttl))
+	if err != nil {
+		return 0, false, err
+	}
+	fence, _ := reply.(int64)
+	return uint64(fence), fence > 0, nil
+}
+
+// Release releases the lock by the key if it is held by the token.
+func (backend *RedisStorage) Release(key, token string) error {
+	reply, err := backend.client.Do("EVAL", redis.ReleaseScript, "1", key, token)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := reply.(int64); deleted != 1 {
+		return InvalidIntent
+	}
+	return nil
+}
+
+// Refresh extends the lock by the key for the ttl if it is held by the token.
+func (backend *RedisStorage) Refresh(key, token string, ttl time.Duration) error {
+	reply, err := backend.client.Do("EVAL", redis.RefreshScript, "1", key, token, milliseconds(ttl))
+	if err != nil {
+		return err
+	}
+	if updated, _ := reply.(int64); updated != 1 {
+		return InvalidIntent
+	}
+	return nil
+}
+
+// raise raises the fencing counter of the lock by the key held
+// by the token to the fence and returns the counter. It returns
+// InvalidIntent if the lock is not held by the token.
+func (backend *RedisStorage) raise(key, token string, fence uint64) (uint64, error) {
+	reply, err := backend.client.Do("EVAL", redis.FenceScript, "2", key, fenceKey(key), token, strconv.FormatUint(fence, 10))
+	if err != nil {
+		return 0, err
+	}
+	counter, _ := reply.(int64)
+	if counter < 1 {
+		return 0, InvalidIntent
+	}
+	return uint64(counter), nil
+}
+
+// Inspect returns the current state of the lock by the key.
+func (backend *RedisStorage) Inspect(key string) (Lease, error) {
+	reply, err := backend.client.Do("EVAL", redis.InspectScript, "2", key, fenceKey(key))
+	if err != nil {
+		return Lease{}, err
+	}
+	lease := Lease{Key: key}
+	if values, is := reply.([]interface{}); is && len(values) == 3 {
+		lease.Token, _ = values[0].(string)
+		if !lease.Held() {
+			return lease, nil
+		}
+		if ms, _ := values[1].(int64); ms > 0 {
+			lease.TTL = time.Duration(ms) * time.Millisecond
+		}
+		if fence, is := values[2].(string); is {
+			lease.Fence, _ = strconv.ParseUint(fence, 10, 64)
+		}
+	}
+	return lease, nil
+}
+
+// List returns the keys of the locks with the prefix. It scans
+// the fencing counters which never expire, so the keys of released
+// locks are returned too.
+func (backend *RedisStorage) List(prefix string) ([]string, error) {
+	pattern := redis.Escape(prefix) + "*" + redis.Escape(fenceKey(""))
+	var keys []string
+	for cursor := "0"; ; {
+		reply, err := backend.client.Do("SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+		values, is := reply.([]interface{})
+		if !is || len(values) != 2 {
+			return nil, redis.Error("unexpected reply of SCAN")
+		}
+		cursor, _ = values[0].(string)
+		found, _ := values[1].([]interface{})
+		for _, value := range found {
+			if key, is := value.(string); is {
+				keys = append(keys, strings.TrimSuffix(key, fenceKey("")))
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// fenceKey returns the key of the fencing counter of the lock.
+// The counter never expires to guarantee the monotonicity.
+func fenceKey(key string) string {
+	return key + ":fence"
+}
+
+func milliseconds(ttl time.Duration) string {
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+// DistributedLimitedWithRedis sets up the Redis server by the address
+// as a storage of the semaphore state.
+//
+//  sem := locker.DistributedLimited(10, time.Minute, locker.DistributedLimitedWithRedis("127.0.0.1:6379"))
+//
+func DistributedLimitedWithRedis(addr string) DistributedLimitedOption {
+	return DistributedLimitedWithBackend(RedisSemaphoreBackend(addr))
+}
+
+// RedisSemaphoreBackend returns a new storage of the distributed
+// semaphore state based on the Redis server by the address.
+//
+// Holders are kept in the sorted set by their expiration time,
+// so permits of a crashed process are returned after the ttl.
+// The expiration time is calculated by the clock of the holder,
+// so processes should keep their clocks synchronized.
+func RedisSemaphoreBackend(addr string) *RedisSemaphoreStorage {
+	return &RedisSemaphoreStorage{client: redis.New(addr, time.Second)}
+}
+
+// A RedisSemaphoreStorage keeps the distributed semaphore state
+// in Redis, see RedisSemaphoreBackend.
+type RedisSemaphoreStorage struct {
+	client *redis.Client
+}
+
+// Acquire adds the weight to the holder by the token if the total weight
+// of alive holders doesn't exceed the limit.
+func (backend *RedisSemaphoreStorage) Acquire(key, token string, weight, capacity uint32, ttl time.Duration) (bool, error) {
+	reply, err := backend.client.Do("EVAL", redis.SemaphoreAcquireScript, "3",
+		key, weightsKey(key), limitKey(key),
+		token, formatUint32(weight), formatUint32(capacity), milliseconds(ttl), unixMilliseconds())
+	if err != nil {
+		return false, err
+	}
+	acquired, _ := reply.(int64)
+	return acquired == 1, nil
+}
+
+// Release subtracts the weight from the holder by the token and returns
+// the total weight before the release.
+func (backend *RedisSemaphoreStorage) Release(key, token string, weight uint32) (uint32, error) {
+	reply, err := backend.client.Do("EVAL", redis.SemaphoreReleaseScript, "2",
+		key, weightsKey(key),
+		token, formatUint32(weight), unixMilliseconds())
+	if err != nil {
+		return 0, err
+	}
+	count, _ := reply.(int64)
+	if count < 0 {
+		return 0, InvalidIntent
+	}
+	return uint32(count), nil
+}
+
+// Refresh extends the lease of the holder by the token for the ttl.
+func (backend *RedisSemaphoreStorage) Refresh(key, token string, ttl time.Duration) error {
+	reply, err := backend.client.Do("EVAL", redis.SemaphoreRefreshScript, "2",
+		key, weightsKey(key),
+		token, milliseconds(ttl), unixMilliseconds())
+	if err != nil {
+		return err
+	}
+	if updated, _ := reply.(int64); updated != 1 {
+		return InvalidIntent
+	}
+	return nil
+}
+
+// State returns the total weight of alive holders and the limit.
+func (backend *RedisSemaphoreStorage) State(key string, capacity uint32) (uint32, uint32, error) {
+	reply, err := backend.client.Do("EVAL", redis.SemaphoreStateScript, "3",
+		key, weightsKey(key), limitKey(key),
+		formatUint32(capacity), unixMilliseconds())
+	if err != nil {
+		return 0, 0, err
+	}
+	values, _ := reply.([]interface{})
+	if len(values) != 2 {
+		return 0, 0, redis.Error("unexpected reply of the script")
+	}
+	count, _ := values[0].(int64)
+	limit, _ := values[1].(int64)
+	return uint32(count), uint32(limit), nil
+}
+
+// Resize sets the limit and returns the previous one.
+func (backend *RedisSemaphoreStorage) Resize(key string, capacity, limit uint32) (uint32, error) {
+	reply, err := backend.client.Do("EVAL", redis.SemaphoreResizeScript, "1",
+		limitKey(key),
+		formatUint32(limit), formatUint32(capacity))
+	if err != nil {
+		return 0, err
+	}
+	prev, _ := reply.(int64)
+	return uint32(prev), nil
+}
+
+// weightsKey returns the key of the hash of holder weights.
+func weightsKey(key string) string {
+	return key + ":weights"
+}
+
+// limitKey returns the key of the shared semaphore limit.
+func limitKey(key string) string {
+	return key + ":limit"
+}
+
+func formatUint32(n uint32) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+func unixMilliseconds() string {
+	return strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+}
+
+// DistributedRWWithRedis sets up the Redis server by the address
+// as a storage of the reader/writer lock state.
+//
+//  lock := locker.DistributedRW(time.Minute, locker.DistributedRWWithRedis("127.0.0.1:6379"))
+//
+func DistributedRWWithRedis(addr string) DistributedRWOption {
+	return DistributedRWWithBackend(RedisRWBackend(addr))
+}
+
+// RedisRWBackend returns a new storage of the distributed reader/writer
+// lock state based on the Redis server by the address.
+//
+// The writer holds the key with the ttl, readers are kept
+// in the sorted set by their expiration time calculated by
+// their clocks, so processes should keep their clocks synchronized.
+func RedisRWBackend(addr string) *RedisRWStorage {
+	return &RedisRWStorage{client: redis.New(addr, time.Second)}
+}
+
+// A RedisRWStorage keeps the distributed reader/writer lock state
+// in Redis, see RedisRWBackend.
+type RedisRWStorage struct {
+	client *redis.Client
+}
+
+// AcquireRead adds the reader by the token if there is
+// no writer holding or waiting for the lock.
+func (backend *RedisRWStorage) AcquireRead(key, token string, ttl time.Duration) (bool, error) {
+	return backend.eval(redis.RWReadScript, key, token, milliseconds(ttl), unixMilliseconds())
+}
+
+// AcquireWrite registers the writer by the token to block
+// new readers and returns true if there are no readers left.
+func (backend *RedisRWStorage) AcquireWrite(key, token string, ttl time.Duration) (bool, error) {
+	return backend.eval(redis.RWWriteScript, key, token, milliseconds(ttl), unixMilliseconds())
+}
+
+// Release removes the reader or the writer by the token.
+func (backend *RedisRWStorage) Release(key, token string) error {
+	released, err := backend.eval(redis.RWReleaseScript, key, token, unixMilliseconds())
+	if err == nil && !released {
+		err = InvalidIntent
+	}
+	return err
+}
+
+// Refresh extends the lease of the reader or the writer by the token.
+func (backend *RedisRWStorage) Refresh(key, token string, ttl time.Duration) error {
+	refreshed, err := backend.eval(redis.RWRefreshScript, key, token, milliseconds(ttl), unixMilliseconds())
+	if err == nil && !refreshed {
+		err = InvalidIntent
+	}
+	return err
+}
+
+func (backend *RedisRWStorage) eval(script, key string, args ...string) (bool, error) {
+	reply, err := backend.client.Do(append([]string{"EVAL", script, "2", writerKey(key), readersKey(key)}, args...)...)
+	if err != nil {
+		return false, err
+	}
+	ok, _ := reply.(int64)
+	return ok == 1, nil
+}
+
+// writerKey returns the key of the writer of the reader/writer lock.
+func writerKey(key string) string {
+	return key + ":writer"
+}
+
+// readersKey returns the key of the sorted set of readers
+// of the reader/writer lock.
+func readersKey(key string) string {
+	return key + ":readers"
+}
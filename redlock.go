@@ -0,0 +1,252 @@
+package locker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kamilsk/locker/internal/redis"
+)
+
+// RedlockBackend returns a new storage of the distributed lock state
+// based on independent Redis servers by the addresses. It implements
+// the Redlock algorithm: the lock is taken if the majority of servers
+// accepted it before its ttl has expired.
+//
+//  lock := locker.Distributed(time.Minute, locker.DistributedWithBackend(
+//  	locker.RedlockBackend([]string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.3:6379"}),
+//  ))
+//
+// The fencing token is the highest one of the majority, and the counters
+// of the majority are raised to it before the lock is taken, so any next
+// majority issues a greater one. It is monotonic only while the servers
+// don't lose their data.
+func RedlockBackend(addrs []string, options ...RedlockOption) *RedlockStorage {
+	backend := &RedlockStorage{timeout: 50 * time.Millisecond, drift: 0.01}
+	for _, option := range options {
+		option(backend)
+	}
+	backend.nodes = make([]*RedisStorage, 0, len(addrs))
+	for _, addr := range addrs {
+		backend.nodes = append(backend.nodes, &RedisStorage{client: redis.New(addr, backend.timeout)})
+	}
+	return backend
+}
+
+// RedlockOption configures the Redlock storage.
+type RedlockOption func(*RedlockStorage)
+
+// RedlockWithTimeout sets up the timeout of a single server call.
+// It should be much less than the ttl of the lock to not waste it
+// on the unavailable servers.
+func RedlockWithTimeout(timeout time.Duration) RedlockOption {
+	return func(backend *RedlockStorage) { backend.timeout = timeout }
+}
+
+// RedlockWithDrift sets up the factor of the clock drift between servers
+// relative to the ttl.
+func RedlockWithDrift(factor float64) RedlockOption {
+	return func(backend *RedlockStorage) { backend.drift = factor }
+}
+
+// A RedlockStorage keeps the distributed lock state on the majority
+// of independent Redis servers, see RedlockBackend.
+type RedlockStorage struct {
+	nodes   []*RedisStorage
+	timeout time.Duration
+	drift   float64
+}
+
+// Acquire tries to take the lock by the key for the token
+// on the majority of servers and returns true if it succeeded
+// with its fencing token.
+func (backend *RedlockStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	fence, validity, err := backend.AcquireValidity(key, token, ttl)
+	return fence, validity > 0, err
+}
+
+// AcquireValidity works like Acquire, but returns the validity
+// of the lock instead of the flag. It is not positive if the lock
+// is not taken.
+func (backend *RedlockStorage) AcquireValidity(key, token string, ttl time.Duration) (uint64, time.Duration, error) {
+	start := time.Now()
+	fences := make([]uint64, len(backend.nodes))
+	results := backend.each(func(i int, node *RedisStorage) (bool, error) {
+		fence, acquired, err := node.Acquire(key, token, ttl)
+		fences[i] = fence
+		return acquired, err
+	})
+
+	var fence uint64
+	for i, result := range results {
+		if result.ok && fences[i] > fence {
+			fence = fences[i]
+		}
+	}
+	if results.succeeded() >= backend.quorum() {
+		// each majority intersects this one, so the next fence must be greater
+		results = backend.each(func(i int, node *RedisStorage) (bool, error) {
+			if !results[i].ok {
+				return false, nil
+			}
+			raised, err := node.raise(key, token, fence)
+			if err == InvalidIntent {
+				return false, nil
+			}
+			return err == nil && raised == fence, err
+		})
+	}
+	if validity := backend.validity(start, ttl); results.succeeded() >= backend.quorum() && validity > 0 {
+		return fence, validity, nil
+	}
+
+	// the lock is not taken, so release it on all servers
+	// including ones that didn't respond in time
+	backend.each(func(_ int, node *RedisStorage) (bool, error) {
+		return true, node.Release(key, token)
+	})
+	if err := results.failure(backend.quorum()); err != nil {
+		return 0, 0, err
+	}
+	return 0, 0, nil
+}
+
+// Release releases the lock by the key on all servers.
+func (backend *RedlockStorage) Release(key, token string) error {
+	results := backend.each(func(_ int, node *RedisStorage) (bool, error) {
+		err := node.Release(key, token)
+		if err == InvalidIntent {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if results.succeeded() > 0 {
+		return nil
+	}
+	if err := results.failure(backend.quorum()); err != nil {
+		return err
+	}
+	return InvalidIntent
+}
+
+// Refresh extends the lock by the key for the ttl if the majority
+// of servers confirmed it before the ttl has expired.
+func (backend *RedlockStorage) Refresh(key, token string, ttl time.Duration) error {
+	_, err := backend.RefreshValidity(key, token, ttl)
+	return err
+}
+
+// RefreshValidity works like Refresh and returns the validity
+// of the renewed lock.
+func (backend *RedlockStorage) RefreshValidity(key, token string, ttl time.Duration) (time.Duration, error) {
+	start := time.Now()
+	results := backend.each(func(_ int, node *RedisStorage) (bool, error) {
+		err := node.Refresh(key, token, ttl)
+		if err == InvalidIntent {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if validity := backend.validity(start, ttl); results.succeeded() >= backend.quorum() && validity > 0 {
+		return validity, nil
+	}
+	if err := results.failure(backend.quorum()); err != nil {
+		return 0, err
+	}
+	return 0, InvalidIntent
+}
+
+// Inspect returns the state of the lock by the key
+// agreed by the majority of servers.
+func (backend *RedlockStorage) Inspect(key string) (Lease, error) {
+	leases := make([]Lease, len(backend.nodes))
+	results := backend.each(func(i int, node *RedisStorage) (bool, error) {
+		lease, err := node.Inspect(key)
+		leases[i] = lease
+		return err == nil, err
+	})
+	if err := results.failure(backend.quorum()); err != nil {
+		return Lease{Key: key}, err
+	}
+
+	votes := make(map[string][]Lease)
+	for i, result := range results {
+		if result.ok && leases[i].Held() {
+			votes[leases[i].Token] = append(votes[leases[i].Token], leases[i])
+		}
+	}
+	for token, agreed := range votes {
+		if len(agreed) < backend.quorum() {
+			continue
+		}
+		lease := Lease{Key: key, Token: token, TTL: agreed[0].TTL}
+		for _, vote := range agreed {
+			if vote.TTL < lease.TTL {
+				lease.TTL = vote.TTL
+			}
+			if vote.Fence > lease.Fence {
+				lease.Fence = vote.Fence
+			}
+		}
+		return lease, nil
+	}
+	return Lease{Key: key}, nil
+}
+
+func (backend *RedlockStorage) quorum() int {
+	return len(backend.nodes)/2 + 1
+}
+
+// validity returns the time remaining before the lock expires
+// taking into account the time of acquisition and the clock drift.
+func (backend *RedlockStorage) validity(start time.Time, ttl time.Duration) time.Duration {
+	drift := time.Duration(float64(ttl)*backend.drift) + 2*time.Millisecond
+	return ttl - time.Since(start) - drift
+}
+
+func (backend *RedlockStorage) each(call func(int, *RedisStorage) (bool, error)) rlresults {
+	results := make(rlresults, len(backend.nodes))
+	wg := sync.WaitGroup{}
+	wg.Add(len(backend.nodes))
+	for i, node := range backend.nodes {
+		go func(i int, node *RedisStorage) {
+			defer wg.Done()
+			results[i].ok, results[i].err = call(i, node)
+		}(i, node)
+	}
+	wg.Wait()
+	return results
+}
+
+type rlresult struct {
+	ok  bool
+	err error
+}
+
+type rlresults []rlresult
+
+func (results rlresults) succeeded() int {
+	var count int
+	for _, result := range results {
+		if result.ok {
+			count++
+		}
+	}
+	return count
+}
+
+// failure returns an error if so many servers failed that
+// the threshold of successful calls is unreachable.
+func (results rlresults) failure(threshold int) error {
+	var count int
+	var err error
+	for _, result := range results {
+		if result.err != nil {
+			count++
+			err = result.err
+		}
+	}
+	if count > len(results)-threshold {
+		return err
+	}
+	return nil
+}
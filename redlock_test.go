@@ -0,0 +1,253 @@
+package locker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+	"github.com/kamilsk/locker/internal/redis"
+)
+
+func TestRedlockBackend(t *testing.T) {
+	setup := func(t *testing.T, size int) ([]*redis.Server, []string) {
+		servers, addrs := make([]*redis.Server, 0, size), make([]string, 0, size)
+		for i := 0; i < size; i++ {
+			server, err := redis.NewServer()
+			if err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			servers, addrs = append(servers, server), append(addrs, server.Addr())
+		}
+		return servers, addrs
+	}
+	teardown := func(servers []*redis.Server) {
+		for _, server := range servers {
+			_ = server.Close()
+		}
+	}
+
+	t.Run("all servers are available", func(t *testing.T) {
+		servers, addrs := setup(t, 3)
+		defer teardown(servers)
+
+		testBackend(t, RedlockBackend(addrs))
+	})
+
+	t.Run("minority of servers are down", func(t *testing.T) {
+		servers, addrs := setup(t, 5)
+		defer teardown(servers)
+		_ = servers[0].Close()
+		_ = servers[1].Close()
+
+		testBackend(t, RedlockBackend(addrs))
+	})
+
+	t.Run("majority of servers are down", func(t *testing.T) {
+		servers, addrs := setup(t, 5)
+		defer teardown(servers)
+		_ = servers[0].Close()
+		_ = servers[1].Close()
+		_ = servers[2].Close()
+
+		backend := RedlockBackend(addrs)
+		if _, acquired, err := backend.Acquire(t.Name(), "token", time.Minute); err == nil || acquired {
+			t.Error("error is expected")
+			t.FailNow()
+		}
+	})
+
+	t.Run("minority of servers are slow", func(t *testing.T) {
+		servers, addrs := setup(t, 3)
+		defer teardown(servers)
+		servers[0].SetLatency(100 * time.Millisecond)
+
+		testBackend(t, RedlockBackend(addrs, RedlockWithTimeout(30*time.Millisecond)))
+	})
+
+	t.Run("slow servers exhaust the ttl", func(t *testing.T) {
+		servers, addrs := setup(t, 3)
+		defer teardown(servers)
+		for _, server := range servers {
+			server.SetLatency(20 * time.Millisecond)
+		}
+
+		backend := RedlockBackend(addrs, RedlockWithTimeout(100*time.Millisecond))
+		if _, acquired, err := backend.Acquire(t.Name(), "token", 20*time.Millisecond); err != nil || acquired {
+			t.Error("the lock must not be taken")
+			t.FailNow()
+		}
+		for _, server := range servers {
+			server.SetLatency(0)
+		}
+		if lease, err := backend.Inspect(t.Name()); err != nil || lease.Held() {
+			t.Error("the lock must be released on all servers")
+			t.FailNow()
+		}
+	})
+
+	t.Run("validity", func(t *testing.T) {
+		servers, addrs := setup(t, 3)
+		defer teardown(servers)
+
+		backend := RedlockBackend(addrs, RedlockWithDrift(0.5))
+		fence, validity, err := backend.AcquireValidity(t.Name(), "token", time.Minute)
+		if err != nil || fence == 0 || validity <= 0 || validity > 30*time.Second {
+			t.Errorf("unexpected validity %v", validity)
+			t.FailNow()
+		}
+		if validity, err := backend.RefreshValidity(t.Name(), "token", time.Minute); err != nil || validity <= 0 || validity > 30*time.Second {
+			t.Errorf("unexpected validity %v", validity)
+			t.FailNow()
+		}
+		if _, validity, err := backend.AcquireValidity(t.Name(), "another", time.Minute); err != nil || validity > 0 {
+			t.Error("the lock must be busy")
+			t.FailNow()
+		}
+	})
+
+	t.Run("fences of different majorities", func(t *testing.T) {
+		servers, addrs := setup(t, 4)
+		defer teardown(servers)
+		_ = servers[3].Close()
+		down := addrs[3]
+
+		for i := 0; i < 5; i++ {
+			if _, acquired, err := RedisBackend(addrs[0]).Acquire(t.Name(), "stranger", time.Minute); err != nil || !acquired {
+				t.Error("unexpected result")
+				t.FailNow()
+			}
+			if err := RedisBackend(addrs[0]).Release(t.Name(), "stranger"); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		}
+
+		first := RedlockBackend([]string{addrs[0], addrs[1], down})
+		fence, acquired, err := first.Acquire(t.Name(), "first", time.Minute)
+		if err != nil || !acquired {
+			t.Error("the lock must be taken by the majority")
+			t.FailNow()
+		}
+		if err := first.Release(t.Name(), "first"); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		second := RedlockBackend([]string{down, addrs[1], addrs[2]})
+		if next, acquired, err := second.Acquire(t.Name(), "second", time.Minute); err != nil || !acquired || next <= fence {
+			t.Errorf("the fencing token must increase, %d after %d", next, fence)
+			t.FailNow()
+		}
+	})
+
+	t.Run("split vote", func(t *testing.T) {
+		servers, addrs := setup(t, 3)
+		defer teardown(servers)
+
+		if _, acquired, err := RedisBackend(addrs[0]).Acquire(t.Name(), "stranger", time.Minute); err != nil || !acquired {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+		backend := RedlockBackend(addrs)
+		if _, acquired, err := backend.Acquire(t.Name(), "token", time.Minute); err != nil || !acquired {
+			t.Error("the lock must be taken by the majority")
+			t.FailNow()
+		}
+		if _, acquired, err := backend.Acquire(t.Name(), "another", time.Minute); err != nil || acquired {
+			t.Error("the lock must be busy")
+			t.FailNow()
+		}
+		if lease, err := backend.Inspect(t.Name()); err != nil || lease.Token != "token" {
+			t.Error("unexpected lease")
+			t.FailNow()
+		}
+	})
+}
+
+func TestDistributedWithRedlock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	addrs := make([]string, 0, 3)
+	for range make([]struct{}, 3) {
+		server, err := redis.NewServer()
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		defer server.Close()
+		addrs = append(addrs, server.Addr())
+	}
+
+	options := []DistributedOption{
+		DistributedWithKey(t.Name()),
+		DistributedWithBackend(RedlockBackend(addrs)),
+		DistributedWithRetry(time.Millisecond),
+	}
+	first, second := Distributed(time.Minute, options...), Distributed(time.Minute, options...)
+	if err := first.Lock(ctx); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+		t.Error("unexpected error value")
+		t.FailNow()
+	}
+	if err := first.Unlock(ctx); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if err := second.Lock(ctx); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	if second.Fence() == 0 {
+		t.Error("the fencing token is expected")
+		t.FailNow()
+	}
+	if err := second.Unlock(ctx); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+}
+
+func TestDistributedWithRedlock_Validity(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	addrs := make([]string, 0, 3)
+	for range make([]struct{}, 3) {
+		server, err := redis.NewServer()
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		defer server.Close()
+		addrs = append(addrs, server.Addr())
+	}
+
+	const ttl = 200 * time.Millisecond
+	lock := Distributed(ttl,
+		DistributedWithKey(t.Name()),
+		DistributedWithBackend(RedlockBackend(addrs, RedlockWithDrift(0.5))),
+		DistributedWithRefresh(0),
+	)
+	start := time.Now()
+	if err := lock.Lock(ctx); err != nil {
+		t.Error("unexpected error")
+		t.FailNow()
+	}
+	select {
+	case <-lock.Lost().Done():
+	case <-ctx.Done():
+		t.Error("the lock must be lost after its validity")
+		t.FailNow()
+	}
+	// the validity is reduced by the half of the ttl for the clock drift
+	if elapsed := time.Since(start); elapsed > ttl*3/4 {
+		t.Errorf("the lock is lost after %v, but its validity is less than %v", elapsed, ttl/2)
+		t.FailNow()
+	}
+}
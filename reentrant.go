@@ -0,0 +1,162 @@
+package locker
+
+import (
+	"sync"
+	"time"
+)
+
+// Reentrant returns a new instance of safe interruptible reentrant mutex.
+// The mutex can be taken by its owner many times and it is released
+// when the owner unlocks it the same number of times. The owner
+// is set by the WithOwner, the calls without it are rejected.
+// Only the owner can unlock the mutex.
+//
+//  lock := locker.Reentrant()
+//
+//  func (repo *Repository) Save(ctx context.Context, user User) error {
+//  	if err := lock.Lock(locker.WithOwner(ctx, user.ID)); err != nil {
+//  		return err
+//  	}
+//  	defer lock.MustUnlock(user.ID)
+//  	// the same owner can call Save again here
+//  	return repo.saveFriends(ctx, user)
+//  }
+//
+func Reentrant() *ReentrantLock {
+	return &ReentrantLock{}
+}
+
+// A ReentrantLock is the mutex which can be taken by its owner
+// many times, see Reentrant.
+type ReentrantLock struct {
+	mu     sync.Mutex
+	holder Holder
+	holds  uint
+	signal chan struct{}
+}
+
+// Lock takes an exclusive lock. If the lock is already held by the owner
+// carried by the Breaker, the hold count is incremented. Otherwise,
+// the calling goroutine blocks until the mutex is available or
+// an error occurred, e.g. if the Breaker is done. It returns
+// InvalidIntent if the Breaker doesn't carry the owner.
+func (lock *ReentrantLock) Lock(breaker Breaker) error {
+	id, found := owner(breaker)
+	if !found || id == "" {
+		return InvalidIntent
+	}
+	for {
+		lock.mu.Lock()
+		if lock.enter(id) {
+			lock.mu.Unlock()
+			return nil
+		}
+		signal := lock.wait()
+		lock.mu.Unlock()
+
+		select {
+		case <-breaker.Done():
+			return Interrupted
+		case <-signal:
+			// potentially the mutex is available
+		}
+	}
+}
+
+// TryLock is a fail-fast version of the Lock method.
+// It returns true if the mutex is locked by the owner
+// or false otherwise.
+func (lock *ReentrantLock) TryLock(owner string) bool {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return lock.enter(owner)
+}
+
+// Unlock decrements the hold count of the owner carried by the Breaker
+// and releases the mutex if it reaches zero. It returns InvalidIntent
+// if the mutex is not locked on entry to Unlock or the Breaker doesn't
+// carry the owner, and NotOwner if the mutex is held by someone else.
+// The release never blocks, so the Breaker is used only to identify
+// the owner.
+func (lock *ReentrantLock) Unlock(breaker Breaker) error {
+	id, found := owner(breaker)
+	if !found || id == "" {
+		return InvalidIntent
+	}
+	return lock.leave(id)
+}
+
+// MustUnlock is a fail-fast version of the Unlock method
+// on behalf of the owner. It is a runtime error if the mutex
+// is not locked by the owner on entry to MustUnlock.
+func (lock *ReentrantLock) MustUnlock(owner string) {
+	if err := lock.leave(owner); err != nil {
+		panic(CriticalIssue)
+	}
+}
+
+// Holder returns the current owner of the mutex
+// or the zero Holder if the mutex is not locked.
+func (lock *ReentrantLock) Holder() Holder {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return lock.holder
+}
+
+// Holds returns how many times the mutex is taken by its owner.
+func (lock *ReentrantLock) Holds() uint {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return lock.holds
+}
+
+// enter takes the mutex if it is free or increments the hold count
+// if it is held by the owner. It must be called under the guard.
+func (lock *ReentrantLock) enter(owner string) bool {
+	if owner == "" {
+		return false
+	}
+	if lock.holds == 0 {
+		lock.holder = Holder{ID: owner, Since: time.Now()}
+	} else if lock.holder.ID != owner {
+		return false
+	}
+	lock.holds++
+	return true
+}
+
+// leave decrements the hold count of the owner
+// and wakes up waiters if the mutex is released.
+func (lock *ReentrantLock) leave(owner string) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.holds == 0 {
+		return InvalidIntent
+	}
+	if lock.holder.ID != owner {
+		return NotOwner
+	}
+	if lock.holds--; lock.holds == 0 {
+		lock.holder = Holder{}
+		lock.broadcast()
+	}
+	return nil
+}
+
+// wait returns the channel closed on the next release of the mutex.
+// It must be called under the guard.
+func (lock *ReentrantLock) wait() <-chan struct{} {
+	if lock.signal == nil {
+		lock.signal = make(chan struct{})
+	}
+	return lock.signal
+}
+
+// broadcast wakes up all waiters to try to take the mutex.
+// It must be called under the guard.
+func (lock *ReentrantLock) broadcast() {
+	if lock.signal != nil {
+		close(lock.signal)
+		lock.signal = nil
+	}
+}
@@ -0,0 +1,126 @@
+package locker_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+)
+
+func TestReentrant(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	t.Run("owner is required", func(t *testing.T) {
+		lock := Reentrant()
+		if err := lock.Lock(ctx); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := lock.Lock(WithOwner(ctx, "")); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if lock.TryLock("") || lock.Holder().Held() {
+			t.Error("the lock must not be taken without the owner")
+			t.FailNow()
+		}
+	})
+
+	t.Run("nested acquisitions by the owner", func(t *testing.T) {
+		lock, owner := Reentrant(), WithOwner(ctx, "owner")
+		if err := lock.Lock(owner); err != nil || !lock.TryLock("owner") || lock.Holds() != 2 {
+			t.Error("reentrant lock is expected")
+			t.FailNow()
+		}
+		done := make(chan error, 1)
+		go func() { done <- lock.Lock(owner) }()
+		if err := <-done; err != nil || lock.Holds() != 3 || lock.Holder().ID != "owner" {
+			t.Error("reentrant lock is expected")
+			t.FailNow()
+		}
+		if lock.TryLock("another") {
+			t.Error("unexpected lock by another owner")
+			t.FailNow()
+		}
+		if err := lock.Lock(WithOwner(breaker.BreakByContext(context.WithTimeout(ctx, time.Millisecond)), "another")); err != Interrupted {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		lock.MustUnlock("owner")
+		for range make([]struct{}, 2) {
+			if !lock.Holder().Held() {
+				t.Error("the lock must be held until the last unlock")
+				t.FailNow()
+			}
+			if err := lock.Unlock(owner); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		}
+		if lock.Holder().Held() || lock.Holds() != 0 {
+			t.Error("the lock must be released")
+			t.FailNow()
+		}
+		if err := lock.Lock(WithOwner(ctx, "another")); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+	})
+
+	t.Run("concurrent acquisitions", func(t *testing.T) {
+		lock := Reentrant()
+		wg := sync.WaitGroup{}
+		for _, id := range []string{"first", "first", "second", "second"} {
+			wg.Add(1)
+			go func(owner Breaker) {
+				defer wg.Done()
+				for range make([]struct{}, 100) {
+					if err := lock.Lock(owner); err != nil {
+						t.Error("unexpected error")
+						return
+					}
+					if err := lock.Unlock(owner); err != nil {
+						t.Error("unexpected error")
+						return
+					}
+				}
+			}(WithOwner(ctx, id))
+		}
+		wg.Wait()
+		if lock.Holder().Held() || lock.Holds() != 0 {
+			t.Error("the lock must be released")
+			t.FailNow()
+		}
+	})
+
+	t.Run("try to unlock by non-owner", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != CriticalIssue {
+				t.Error("panic with CriticalIssue is expected")
+			}
+		}()
+
+		lock := Reentrant()
+		if err := lock.Unlock(WithOwner(ctx, "owner")); err != InvalidIntent {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if err := lock.Lock(WithOwner(ctx, "owner")); err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		if err := lock.Unlock(WithOwner(ctx, "another")); err != NotOwner {
+			t.Error("unexpected error value")
+			t.FailNow()
+		}
+		if lock.Holds() != 1 {
+			t.Error("the lock must be held by its owner")
+			t.FailNow()
+		}
+		lock.MustUnlock("another")
+	})
+}
@@ -3,8 +3,7 @@ package locker
 import (
 	"sync"
 	"sync/atomic"
-
-	"github.com/kamilsk/locker/internal"
+	"time"
 )
 
 // Limited returns a new instance of resizable semaphore
@@ -12,29 +11,54 @@ import (
 //
 // Fully reworked of github.com/kamilsk/semaphore,
 // inspired by github.com/marusama/semaphore.
-func Limited(capacity uint) *llock {
-	return &llock{
+func Limited(capacity uint, options ...LimitedOption) *LimitedLock {
+	lock := &LimitedLock{
 		state:  uint64(capacity) << 32,
 		signal: make(chan struct{}),
 	}
+	for _, option := range options {
+		option(lock)
+	}
+	return lock
+}
+
+// LimitedOption configures the resizable semaphore.
+type LimitedOption func(*LimitedLock)
+
+// LimitedWithHolders enables tracking of the holders of the slots
+// reported by the Holder and Holders methods. It serializes
+// acquisitions and releases on a guard, so it is disabled by default.
+func LimitedWithHolders() LimitedOption {
+	return func(lock *LimitedLock) { lock.track = true }
 }
 
-type llock struct {
+// A LimitedLock is the resizable semaphore, see Limited.
+type LimitedLock struct {
 	state  uint64
 	guard  sync.RWMutex
 	signal chan struct{}
+	track  bool
+
+	mu      sync.Mutex
+	holders []lholder
+}
+
+// lholder is an owner of the slots.
+type lholder struct {
+	Holder
+	slots uint32
 }
 
-func (lock *llock) Lock(breaker internal.Breaker) error {
+func (lock *LimitedLock) Lock(breaker Breaker) error {
 	return lock.Acquire(breaker, lock.Limit())
 }
 
-func (lock *llock) Unlock(internal.Breaker) error {
-	_, err := lock.Release(lock.Limit())
+func (lock *LimitedLock) Unlock(breaker Breaker) error {
+	_, err := lock.release(lock.Limit(), breaker)
 	return err
 }
 
-func (lock *llock) Acquire(breaker internal.Breaker, slot uint32) error {
+func (lock *LimitedLock) Acquire(breaker Breaker, slot uint32) error {
 	if slot == 0 {
 		return InvalidIntent
 	}
@@ -47,7 +71,8 @@ func (lock *llock) Acquire(breaker internal.Breaker, slot uint32) error {
 
 		state, count, limit := lock.splitState()
 		if newCount := count + slot; newCount <= limit {
-			if atomic.CompareAndSwapUint64(&lock.state, state, uint64(limit<<32+newCount)) {
+			if atomic.CompareAndSwapUint64(&lock.state, state, uint64(limit)<<32+uint64(newCount)) {
+				lock.hold(breaker, slot)
 				return nil
 			}
 			continue
@@ -70,14 +95,15 @@ func (lock *llock) Acquire(breaker internal.Breaker, slot uint32) error {
 	}
 }
 
-func (lock *llock) TryAcquire(slot uint32) bool {
+func (lock *LimitedLock) TryAcquire(slot uint32) bool {
 	if slot == 0 {
 		return false
 	}
 	for {
 		state, count, limit := lock.splitState()
 		if newCount := count + slot; newCount <= limit {
-			if atomic.CompareAndSwapUint64(&lock.state, state, uint64(limit<<32+newCount)) {
+			if atomic.CompareAndSwapUint64(&lock.state, state, uint64(limit)<<32+uint64(newCount)) {
+				lock.hold(nil, slot)
 				return true
 			}
 			continue
@@ -86,7 +112,11 @@ func (lock *llock) TryAcquire(slot uint32) bool {
 	}
 }
 
-func (lock *llock) Release(slot uint32) (uint32, error) {
+func (lock *LimitedLock) Release(slot uint32) (uint32, error) {
+	return lock.release(slot, nil)
+}
+
+func (lock *LimitedLock) release(slot uint32, breaker Breaker) (uint32, error) {
 	if slot == 0 {
 		return lock.Count(), nil
 	}
@@ -96,7 +126,7 @@ func (lock *llock) Release(slot uint32) (uint32, error) {
 			return count, InvalidIntent
 		}
 
-		if newCount := count - slot; atomic.CompareAndSwapUint64(&lock.state, state, uint64(limit<<32+newCount)) {
+		if newCount := count - slot; atomic.CompareAndSwapUint64(&lock.state, state, uint64(limit)<<32+uint64(newCount)) {
 			signal := make(chan struct{})
 
 			lock.guard.Lock()
@@ -105,27 +135,28 @@ func (lock *llock) Release(slot uint32) (uint32, error) {
 			lock.guard.Unlock()
 
 			close(broadcast)
+			lock.forget(breaker, slot)
 			return count, nil
 		}
 	}
 }
 
-func (lock *llock) Count() uint32 {
+func (lock *LimitedLock) Count() uint32 {
 	return uint32(atomic.LoadUint64(&lock.state))
 }
 
-func (lock *llock) Limit() uint32 {
+func (lock *LimitedLock) Limit() uint32 {
 	return uint32(atomic.LoadUint64(&lock.state) >> 32)
 }
 
-func (lock *llock) SetCapacity(capacity uint32) uint32 {
+func (lock *LimitedLock) SetCapacity(capacity uint32) uint32 {
 	if capacity == 0 {
 		return lock.Limit()
 	}
 
 	for {
 		state, count, limit := lock.splitState()
-		if atomic.CompareAndSwapUint64(&lock.state, state, uint64(capacity<<32+count)) {
+		if atomic.CompareAndSwapUint64(&lock.state, state, uint64(capacity)<<32+uint64(count)) {
 			signal := make(chan struct{})
 
 			lock.guard.Lock()
@@ -139,7 +170,79 @@ func (lock *llock) SetCapacity(capacity uint32) uint32 {
 	}
 }
 
-func (lock *llock) splitState() (state uint64, count uint32, limit uint32) {
+// Holder returns the earliest of the current holders or the zero Holder
+// if no slot is acquired or the semaphore doesn't track its holders,
+// see LimitedWithHolders.
+func (lock *LimitedLock) Holder() Holder {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if len(lock.holders) == 0 {
+		return Holder{}
+	}
+	return lock.holders[0].Holder
+}
+
+// Holders returns the current holders of the slots in order
+// of acquisition, one per successful call of Acquire.
+// The released slots are taken from the holders with the identity
+// of the caller first, and then from the earliest ones, because
+// the semaphore doesn't know who really releases them.
+func (lock *LimitedLock) Holders() []Holder {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	holders := make([]Holder, 0, len(lock.holders))
+	for _, holder := range lock.holders {
+		holders = append(holders, holder.Holder)
+	}
+	return holders
+}
+
+func (lock *LimitedLock) hold(breaker Breaker, slot uint32) {
+	if !lock.track {
+		return
+	}
+	holder := lholder{Holder: Holder{ID: identify(breaker), Since: time.Now()}, slots: slot}
+	lock.mu.Lock()
+	lock.holders = append(lock.holders, holder)
+	lock.mu.Unlock()
+}
+
+func (lock *LimitedLock) forget(breaker Breaker, slot uint32) {
+	if !lock.track {
+		return
+	}
+	id := identify(breaker)
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	for i := len(lock.holders) - 1; i >= 0 && slot > 0; i-- {
+		if lock.holders[i].ID == id {
+			slot = lock.holders[i].take(slot)
+		}
+	}
+	for i := 0; i < len(lock.holders) && slot > 0; i++ {
+		slot = lock.holders[i].take(slot)
+	}
+	holders := lock.holders[:0]
+	for _, holder := range lock.holders {
+		if holder.slots > 0 {
+			holders = append(holders, holder)
+		}
+	}
+	lock.holders = holders
+}
+
+// take takes up to the slot from the holder and returns the rest.
+func (holder *lholder) take(slot uint32) uint32 {
+	if holder.slots >= slot {
+		holder.slots -= slot
+		return 0
+	}
+	slot -= holder.slots
+	holder.slots = 0
+	return slot
+}
+
+func (lock *LimitedLock) splitState() (state uint64, count uint32, limit uint32) {
 	state = atomic.LoadUint64(&lock.state)
 	return state, uint32(state), uint32(state >> 32)
 }
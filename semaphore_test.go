@@ -1,11 +1,38 @@
 package locker_test
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	. "github.com/kamilsk/locker"
+)
 
 func ExampleLimited() {
 }
 
 func TestLimited(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	t.Run("limit survives state updates", func(t *testing.T) {
+		lock := Limited(1)
+		if limit := lock.SetCapacity(3); limit != 1 || lock.Limit() != 3 {
+			t.Errorf("unexpected limit %d", lock.Limit())
+			t.FailNow()
+		}
+		if err := lock.Acquire(ctx, 2); err != nil || lock.Count() != 2 || lock.Limit() != 3 {
+			t.Errorf("unexpected state after acquire: count %d, limit %d", lock.Count(), lock.Limit())
+			t.FailNow()
+		}
+		if !lock.TryAcquire(1) || lock.Count() != 3 || lock.Limit() != 3 {
+			t.Errorf("unexpected state after try acquire: count %d, limit %d", lock.Count(), lock.Limit())
+			t.FailNow()
+		}
+		if _, err := lock.Release(3); err != nil || lock.Count() != 0 || lock.Limit() != 3 {
+			t.Errorf("unexpected state after release: count %d, limit %d", lock.Count(), lock.Limit())
+			t.FailNow()
+		}
+	})
 }
 
 func BenchmarkLimited(b *testing.B) {
@@ -8,10 +8,10 @@ import (
 	"github.com/kamilsk/locker/internal"
 )
 
-func InterruptibleSet(capacity uint, options ...InterruptibleSetOption) *iset {
-	container := &iset{set: make([]ilock, 0, capacity), size: uint64(capacity)}
-	for range make([]struct{}, capacity) {
-		container.set = append(container.set, *Interruptible())
+func InterruptibleSet(capacity uint, options ...InterruptibleSetOption) *InterruptibleLockSet {
+	container := &InterruptibleLockSet{set: make([]InterruptibleLock, capacity), size: uint64(capacity)}
+	for i := range container.set {
+		container.set[i].signal = make(chan struct{}, 1)
 	}
 	for _, option := range options {
 		option(container)
@@ -25,24 +25,24 @@ func InterruptibleSet(capacity uint, options ...InterruptibleSetOption) *iset {
 	return container
 }
 
-type InterruptibleSetOption func(*iset)
+type InterruptibleSetOption func(*InterruptibleLockSet)
 
 func InterruptibleSetWithHash(builder func() hash.Hash) InterruptibleSetOption {
-	return func(c *iset) { c.hash = builder }
+	return func(c *InterruptibleLockSet) { c.hash = builder }
 }
 
 func InterruptibleSetWithMapping(index func([]byte, uint64) uint64) InterruptibleSetOption {
-	return func(c *iset) { c.idx = index }
+	return func(c *InterruptibleLockSet) { c.idx = index }
 }
 
-type iset struct {
+type InterruptibleLockSet struct {
 	hash func() hash.Hash
 	idx  func([]byte, uint64) uint64
-	set  []ilock
+	set  []InterruptibleLock
 	size uint64
 }
 
-func (c *iset) ByFingerprint(fingerprint []byte) *ilock {
+func (c *InterruptibleLockSet) ByFingerprint(fingerprint []byte) *InterruptibleLock {
 	h := c.hash()
 	_, _ = h.Write(fingerprint)
 	shard := c.idx(h.Sum(nil), c.size)
@@ -50,16 +50,71 @@ func (c *iset) ByFingerprint(fingerprint []byte) *ilock {
 	return &c.set[shard]
 }
 
-func (c *iset) ByKey(key string) *ilock {
+func (c *InterruptibleLockSet) ByKey(key string) *InterruptibleLock {
 	return c.ByFingerprint([]byte(key))
 }
 
-func (c *iset) ByVirtualShard(shard uint64) *ilock {
+func (c *InterruptibleLockSet) ByVirtualShard(shard uint64) *InterruptibleLock {
 	return &c.set[shard%c.size]
 }
 
-func Set(capacity uint, options ...SetOption) *mset {
-	container := &mset{set: make([]sync.Mutex, capacity), size: uint64(capacity)}
+func InterruptibleRWSet(capacity uint, options ...InterruptibleRWSetOption) *InterruptibleRWLockSet {
+	container := &InterruptibleRWLockSet{set: make([]InterruptibleRWLock, capacity), size: uint64(capacity)}
+	for _, option := range options {
+		option(container)
+	}
+	for i := range container.set {
+		container.set[i].policy = container.policy
+	}
+	if container.hash == nil {
+		container.hash = md5.New
+	}
+	if container.idx == nil {
+		container.idx = internal.ShardNumberFast
+	}
+	return container
+}
+
+type InterruptibleRWSetOption func(*InterruptibleRWLockSet)
+
+func InterruptibleRWSetWithHash(builder func() hash.Hash) InterruptibleRWSetOption {
+	return func(c *InterruptibleRWLockSet) { c.hash = builder }
+}
+
+func InterruptibleRWSetWithMapping(index func([]byte, uint64) uint64) InterruptibleRWSetOption {
+	return func(c *InterruptibleRWLockSet) { c.idx = index }
+}
+
+func InterruptibleRWSetWithPreference(policy Preference) InterruptibleRWSetOption {
+	return func(c *InterruptibleRWLockSet) { c.policy = policy }
+}
+
+type InterruptibleRWLockSet struct {
+	hash   func() hash.Hash
+	idx    func([]byte, uint64) uint64
+	policy Preference
+	set    []InterruptibleRWLock
+	size   uint64
+}
+
+func (c *InterruptibleRWLockSet) ByFingerprint(fingerprint []byte) *InterruptibleRWLock {
+	h := c.hash()
+	_, _ = h.Write(fingerprint)
+	shard := c.idx(h.Sum(nil), c.size)
+	h.Reset()
+	return &c.set[shard]
+}
+
+func (c *InterruptibleRWLockSet) ByKey(key string) *InterruptibleRWLock {
+	return c.ByFingerprint([]byte(key))
+}
+
+func (c *InterruptibleRWLockSet) ByVirtualShard(shard uint64) *InterruptibleRWLock {
+	return &c.set[shard%c.size]
+}
+
+func Set(capacity uint, options ...SetOption) *MutexSet {
+	container := &MutexSet{set: make([]sync.Mutex, capacity), size: uint64(capacity)}
 	for _, option := range options {
 		option(container)
 	}
@@ -72,24 +127,24 @@ func Set(capacity uint, options ...SetOption) *mset {
 	return container
 }
 
-type SetOption func(*mset)
+type SetOption func(*MutexSet)
 
 func SetWithHash(builder func() hash.Hash) SetOption {
-	return func(c *mset) { c.hash = builder }
+	return func(c *MutexSet) { c.hash = builder }
 }
 
 func SetWithMapping(index func([]byte, uint64) uint64) SetOption {
-	return func(c *mset) { c.idx = index }
+	return func(c *MutexSet) { c.idx = index }
 }
 
-type mset struct {
+type MutexSet struct {
 	hash func() hash.Hash
 	idx  func([]byte, uint64) uint64
 	set  []sync.Mutex
 	size uint64
 }
 
-func (c *mset) ByFingerprint(fingerprint []byte) *sync.Mutex {
+func (c *MutexSet) ByFingerprint(fingerprint []byte) *sync.Mutex {
 	h := c.hash()
 	_, _ = h.Write(fingerprint)
 	shard := c.idx(h.Sum(nil), c.size)
@@ -97,16 +152,16 @@ func (c *mset) ByFingerprint(fingerprint []byte) *sync.Mutex {
 	return &c.set[shard]
 }
 
-func (c *mset) ByKey(key string) *sync.Mutex {
+func (c *MutexSet) ByKey(key string) *sync.Mutex {
 	return c.ByFingerprint([]byte(key))
 }
 
-func (c *mset) ByVirtualShard(shard uint64) *sync.Mutex {
+func (c *MutexSet) ByVirtualShard(shard uint64) *sync.Mutex {
 	return &c.set[shard%c.size]
 }
 
-func RWSet(capacity uint, options ...RWSetOption) *rwset {
-	container := &rwset{set: make([]sync.RWMutex, capacity), size: uint64(capacity)}
+func RWSet(capacity uint, options ...RWSetOption) *RWMutexSet {
+	container := &RWMutexSet{set: make([]sync.RWMutex, capacity), size: uint64(capacity)}
 	for _, option := range options {
 		option(container)
 	}
@@ -119,24 +174,24 @@ func RWSet(capacity uint, options ...RWSetOption) *rwset {
 	return container
 }
 
-type RWSetOption func(*rwset)
+type RWSetOption func(*RWMutexSet)
 
 func RWSetWithHash(builder func() hash.Hash) RWSetOption {
-	return func(c *rwset) { c.hash = builder }
+	return func(c *RWMutexSet) { c.hash = builder }
 }
 
 func RWSetWithMapping(index func([]byte, uint64) uint64) RWSetOption {
-	return func(c *rwset) { c.idx = index }
+	return func(c *RWMutexSet) { c.idx = index }
 }
 
-type rwset struct {
+type RWMutexSet struct {
 	hash func() hash.Hash
 	idx  func([]byte, uint64) uint64
 	set  []sync.RWMutex
 	size uint64
 }
 
-func (c *rwset) ByFingerprint(fingerprint []byte) *sync.RWMutex {
+func (c *RWMutexSet) ByFingerprint(fingerprint []byte) *sync.RWMutex {
 	h := c.hash()
 	_, _ = h.Write(fingerprint)
 	shard := c.idx(h.Sum(nil), c.size)
@@ -144,10 +199,10 @@ func (c *rwset) ByFingerprint(fingerprint []byte) *sync.RWMutex {
 	return &c.set[shard]
 }
 
-func (c *rwset) ByKey(key string) *sync.RWMutex {
+func (c *RWMutexSet) ByKey(key string) *sync.RWMutex {
 	return c.ByFingerprint([]byte(key))
 }
 
-func (c *rwset) ByVirtualShard(shard uint64) *sync.RWMutex {
+func (c *RWMutexSet) ByVirtualShard(shard uint64) *sync.RWMutex {
 	return &c.set[shard%c.size]
 }
@@ -1,13 +1,16 @@
 package locker_test
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"hash"
 	"math"
 	"testing"
+	"time"
 
 	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
 )
 
 const (
@@ -572,3 +575,86 @@ func BenchmarkRWSet_ByVirtualShard(b *testing.B) {
 		})
 	}
 }
+
+func TestInterruptibleRWSet(t *testing.T) {
+	t.Run("with custom hash option", func(t *testing.T) {
+		container := InterruptibleRWSet(3, InterruptibleRWSetWithHash(sha1.New))
+		if container.ByKey(key1) == container.ByKey(key2) {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+	})
+	t.Run("with custom mapping option", func(t *testing.T) {
+		container := InterruptibleRWSet(3, InterruptibleRWSetWithMapping(func([]byte, uint64) uint64 { return 0 }))
+		if container.ByKey(key1) != container.ByKey(key2) {
+			t.Error("unexpected result")
+			t.FailNow()
+		}
+	})
+	t.Run("with custom preference option", func(t *testing.T) {
+		container := InterruptibleRWSet(3, InterruptibleRWSetWithPreference(PreferReaders))
+		lock := container.ByVirtualShard(0)
+		if !lock.TryRLock() {
+			t.Error("shared lock is expected")
+			t.FailNow()
+		}
+		writer := breaker.BreakByContext(context.WithCancel(context.Background()))
+		defer writer.Close()
+		go func() { _ = lock.Lock(writer) }()
+		time.Sleep(time.Millisecond)
+		if !lock.TryRLock() {
+			t.Error("readers must be preferred")
+			t.FailNow()
+		}
+	})
+}
+
+func TestInterruptibleRWSet_ByKey(t *testing.T) {
+	t.Parallel()
+
+	keys := [...]string{key1, key2}
+	set := InterruptibleRWSet(3)
+
+	for _, key := range keys {
+		origin := set.ByKey(key)
+		for range make([]struct{}, 1000) {
+			current := set.ByKey(key)
+			if origin != current {
+				t.Error("non-deterministic result")
+				t.FailNow()
+			}
+		}
+	}
+
+	for i, key := range keys {
+		current := set.ByKey(key)
+		for _, key := range keys[i+1:] {
+			next := set.ByKey(key)
+			if current == next {
+				t.Error("has deadlock")
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestInterruptibleRWSet_ByVirtualShard(t *testing.T) {
+	t.Parallel()
+
+	shards := [...]uint64{1, 5, 9}
+	set := InterruptibleRWSet(3)
+
+	for i, shard := range shards {
+		current := set.ByVirtualShard(shard)
+		if current != set.ByVirtualShard(shard) {
+			t.Error("non-deterministic result")
+			t.FailNow()
+		}
+		for _, shard := range shards[i+1:] {
+			if current == set.ByVirtualShard(shard) {
+				t.Error("has deadlock")
+				t.FailNow()
+			}
+		}
+	}
+}
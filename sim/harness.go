@@ -0,0 +1,573 @@
+// Package sim provides a simulation of processes which share
+// the Distributed lock through a Backend over an unreliable network.
+// Each process runs the real lock with its renewal, and the Backend
+// is reached through a link which injects latency, message loss
+// and process pauses. Scenarios also jump the clock of the Backend
+// and crash processes, and the harness checks that no two processes
+// believe they own the lock with valid fencing tokens at the same time.
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+)
+
+// NewHarness returns a new harness to run scenarios against a Backend.
+// The Backend must use the Now method of the harness as its clock
+// to follow jumps of the time.
+//
+//  harness := sim.NewHarness(sim.HarnessWithSeed(42))
+//  for _, scenario := range sim.Scenarios() {
+//  	backend := locker.MemoryBackend(locker.MemoryBackendWithClock(harness.Now))
+//  	if report := harness.Run(backend, scenario); len(report.Violations) > 0 {
+//  		log.Println(report)
+//  	}
+//  }
+//
+// Durations of the harness and scenarios are in the simulated time
+// which runs faster than the real one by the speed of the harness.
+// The faults of each process are reproduced by the seed, but the order
+// of goroutines is up to the scheduler, so runs could differ in details.
+func NewHarness(options ...HarnessOption) *Harness {
+	harness := &Harness{
+		key:     "sim",
+		seed:    1,
+		speed:   10,
+		ttl:     time.Second,
+		refresh: time.Second / 3,
+		retry:   50 * time.Millisecond,
+		timeout: 200 * time.Millisecond,
+		latency: time.Millisecond,
+	}
+	for _, option := range options {
+		option(harness)
+	}
+	return harness
+}
+
+// HarnessOption configures the harness.
+type HarnessOption func(*Harness)
+
+// HarnessWithSeed sets up the seed of random faults.
+func HarnessWithSeed(seed int64) HarnessOption {
+	return func(harness *Harness) { harness.seed = seed }
+}
+
+// HarnessWithSpeed sets up how many times the simulated time
+// runs faster than the real one.
+func HarnessWithSpeed(speed int) HarnessOption {
+	return func(harness *Harness) { harness.speed = speed }
+}
+
+// HarnessWithTTL sets up the ttl of the lock.
+func HarnessWithTTL(ttl time.Duration) HarnessOption {
+	return func(harness *Harness) { harness.ttl = ttl }
+}
+
+// HarnessWithRefresh sets up the interval of the lock renewal.
+// The non-positive interval disables the renewal.
+func HarnessWithRefresh(interval time.Duration) HarnessOption {
+	return func(harness *Harness) { harness.refresh = interval }
+}
+
+// HarnessWithRetry sets up the interval between attempts to take the lock.
+func HarnessWithRetry(interval time.Duration) HarnessOption {
+	return func(harness *Harness) { harness.retry = interval }
+}
+
+// HarnessWithTimeout sets up the time a process waits for a reply
+// of the Backend before it considers the call failed.
+func HarnessWithTimeout(timeout time.Duration) HarnessOption {
+	return func(harness *Harness) { harness.timeout = timeout }
+}
+
+// HarnessWithLatency sets up the default one-way latency of the network.
+func HarnessWithLatency(latency time.Duration) HarnessOption {
+	return func(harness *Harness) { harness.latency = latency }
+}
+
+// Harness runs scenarios. It must not run several of them at the same time.
+type Harness struct {
+	key     string
+	seed    int64
+	speed   int
+	ttl     time.Duration
+	refresh time.Duration
+	retry   time.Duration
+	timeout time.Duration
+	latency time.Duration
+
+	mu    sync.Mutex
+	world *world
+}
+
+// Now returns the current time of the Backend in the running scenario.
+func (harness *Harness) Now() time.Time {
+	harness.mu.Lock()
+	w := harness.world
+	harness.mu.Unlock()
+	if w == nil {
+		return time.Now()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Now().Add(w.skew)
+}
+
+// Run runs the scenario against the Backend and returns its report.
+// The Backend should be fresh, its state is not reset between runs.
+func (harness *Harness) Run(backend locker.Backend, scenario Scenario) Report {
+	w := &world{
+		harness:   harness,
+		backend:   backend,
+		start:     time.Now(),
+		closed:    make(chan struct{}),
+		processes: make(map[string]*process),
+		report:    Report{Scenario: scenario.Name},
+	}
+	harness.mu.Lock()
+	harness.world = w
+	harness.mu.Unlock()
+	defer func() {
+		harness.mu.Lock()
+		harness.world = nil
+		harness.mu.Unlock()
+	}()
+
+	steps := append([]Step(nil), scenario.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].At < steps[j].At })
+	for _, step := range steps {
+		if step.At > scenario.Duration {
+			break
+		}
+		time.Sleep(time.Until(w.start.Add(w.real(step.At))))
+		w.mu.Lock()
+		step.Action(w)
+		w.check()
+		w.mu.Unlock()
+	}
+	time.Sleep(time.Until(w.start.Add(w.real(scenario.Duration))))
+	return w.stop()
+}
+
+// world is the state of a single run.
+type world struct {
+	harness *Harness
+	backend locker.Backend
+	start   time.Time
+	closed  chan struct{}
+	wg      sync.WaitGroup
+
+	mu        sync.Mutex
+	skew      time.Duration
+	processes map[string]*process
+	order     []*process
+	fence     uint64
+	holder    string
+	violation string
+	report    Report
+}
+
+// real converts the simulated duration to the real one.
+func (w *world) real(duration time.Duration) time.Duration {
+	return duration / time.Duration(w.harness.speed)
+}
+
+// now returns the simulated time since the start of the run.
+func (w *world) now() time.Duration {
+	return time.Since(w.start) * time.Duration(w.harness.speed)
+}
+
+// stop interrupts processes, waits until their sessions are over
+// and returns the report.
+func (w *world) stop() Report {
+	w.mu.Lock()
+	close(w.closed)
+	for _, p := range w.order {
+		p.interrupt()
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+
+	// the renewals fail since then, so the sessions end by the ttl
+	for _, p := range w.order {
+		<-p.lock.Lost().Done()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.report
+}
+
+// later runs the action under the guard at the moment
+// unless the run is over.
+func (w *world) later(at time.Time, action func()) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if w.sleep(time.Until(at)) {
+			w.mu.Lock()
+			action()
+			w.check()
+			w.mu.Unlock()
+		}
+	}()
+}
+
+// sleep returns false if the run is over before the duration has passed.
+func (w *world) sleep(duration time.Duration) bool {
+	if duration <= 0 {
+		return true
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-w.closed:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// process returns the participant by the id. It must be called under the guard.
+func (w *world) process(id string) *process {
+	p, found := w.processes[id]
+	if !found {
+		p = &process{
+			id:      id,
+			latency: w.harness.latency,
+			random:  rand.New(rand.NewSource(w.harness.seed + int64(len(w.order)))),
+		}
+		p.lock = locker.Distributed(w.real(w.harness.ttl),
+			locker.DistributedWithKey(w.harness.key),
+			locker.DistributedWithBackend(&link{world: w, process: p}),
+			locker.DistributedWithRefresh(w.real(w.harness.refresh)),
+			locker.DistributedWithRetry(w.real(w.harness.retry)),
+			locker.DistributedWithOwner(id),
+		)
+		w.processes[id] = p
+		w.order = append(w.order, p)
+	}
+	return p
+}
+
+func (w *world) trace(format string, args ...interface{}) {
+	now := w.now().Round(time.Millisecond)
+	w.report.Trace = append(w.report.Trace, fmt.Sprintf("%v ", now)+fmt.Sprintf(format, args...))
+}
+
+// acquire takes the lock by the process until it succeeds
+// or the process gives up. It must be called under the guard.
+func (w *world) acquire(p *process) {
+	generation, interrupted := p.generation, make(chan struct{})
+	p.interrupted = interrupted
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		br := breaker.BreakByChannel(interrupted)
+		defer br.Close()
+
+		for {
+			err := p.lock.Lock(br)
+			if err == nil {
+				break
+			}
+			select {
+			case <-br.Done():
+				return
+			default:
+			}
+			// the storage is unavailable, so try again
+			if !w.sleep(w.real(w.harness.retry)) {
+				return
+			}
+		}
+		fence, lost := p.lock.Fence(), p.lock.Lost()
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if p.generation != generation {
+			w.release(p)
+			return
+		}
+		p.state, p.fence, p.lost = holding, fence, lost
+		w.trace("%s holds the lock with fence %d", p.id, fence)
+		w.check()
+		w.watch(p, generation)
+	}()
+}
+
+// watch waits until the process notices the loss of the lock.
+// It must be called under the guard.
+func (w *world) watch(p *process, generation uint64) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		select {
+		case <-w.closed:
+			return
+		case <-p.lost.Done():
+		}
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if p.generation != generation {
+			return
+		}
+		p.lose()
+		w.trace("%s lost the lock", p.id)
+		w.release(p)
+		w.check()
+	}()
+}
+
+// release ends the session of the process. The storage could be
+// unavailable, so it tries again until the release is confirmed.
+// It must be called under the guard.
+func (w *world) release(p *process) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			if err := p.lock.Unlock(context.Background()); err == nil || err == locker.InvalidIntent {
+				return
+			}
+			if !w.sleep(w.real(w.harness.retry)) {
+				return
+			}
+		}
+	}()
+}
+
+// call sends the request of the process to the Backend. It returns
+// the timeout error if the request or the reply is lost or late.
+// The paused process sends the request and receives the reply
+// only after the pause.
+func (w *world) call(p *process, request func()) error {
+	if !w.resume(p) {
+		return errTimeout
+	}
+	deadline := time.Now().Add(w.real(w.harness.timeout))
+	if w.lost(p) {
+		w.sleep(time.Until(deadline))
+		return errTimeout
+	}
+	if arrival := time.Now().Add(w.real(w.latency(p))); arrival.After(deadline) || !w.sleep(time.Until(arrival)) {
+		w.sleep(time.Until(deadline))
+		return errTimeout
+	}
+	request()
+	if arrival := time.Now().Add(w.real(w.latency(p))); w.lost(p) || arrival.After(deadline) || !w.sleep(time.Until(arrival)) {
+		w.sleep(time.Until(deadline))
+		return errTimeout
+	}
+	if !w.resume(p) {
+		return errTimeout
+	}
+	return nil
+}
+
+// resume waits for the end of the pause of the process.
+// It returns false if the process has crashed or the run is over.
+func (w *world) resume(p *process) bool {
+	for {
+		w.mu.Lock()
+		crashed, paused := p.crashed, p.paused
+		w.mu.Unlock()
+		if crashed {
+			return false
+		}
+		if !time.Now().Before(paused) {
+			return true
+		}
+		if !w.sleep(time.Until(paused)) {
+			return false
+		}
+	}
+}
+
+func (w *world) latency(p *process) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return p.latency
+}
+
+func (w *world) lost(p *process) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return p.drop > 0 && p.random.Float64() < p.drop
+}
+
+// grant registers the fencing token issued by the Backend.
+// A new owner must get a token higher than all issued before.
+// It must be called under the guard.
+func (w *world) grant(token string, fence uint64) {
+	w.report.Grants++
+	if token == w.holder {
+		return
+	}
+	if w.holder != "" && fence <= w.fence {
+		w.violate(fmt.Sprintf("fence %d of %s doesn't exceed fence %d of %s", fence, token, w.fence, w.holder))
+	}
+	if fence >= w.fence {
+		w.fence, w.holder = fence, token
+	}
+}
+
+// check verifies that at most one process believes it owns the lock
+// with the fencing token not lower than any issued before.
+// It must be called under the guard.
+func (w *world) check() {
+	var owners []*process
+	for _, p := range w.order {
+		if p.believes(time.Now()) && p.fence >= w.fence {
+			owners = append(owners, p)
+		}
+	}
+	if len(owners) < 2 {
+		w.violation = ""
+		return
+	}
+	message := "processes"
+	for _, p := range owners {
+		message += fmt.Sprintf(" %s(fence %d)", p.id, p.fence)
+	}
+	message += " believe they own the lock"
+	if message != w.violation {
+		w.violation = message
+		w.violate(message)
+	}
+}
+
+func (w *world) violate(message string) {
+	w.trace("violation: %s", message)
+	w.report.Violations = append(w.report.Violations, Violation{At: w.now(), Message: message})
+}
+
+// link is the Backend as it is seen by the process through the network.
+type link struct {
+	world   *world
+	process *process
+}
+
+// Acquire tries to take the lock by the key for the token
+// and returns true if it succeeded with its fencing token.
+func (link *link) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	var (
+		fence    uint64
+		acquired bool
+		err      error
+	)
+	if lost := link.world.call(link.process, func() {
+		fence, acquired, err = link.world.backend.Acquire(key, token, ttl)
+		if err == nil && acquired {
+			link.world.mu.Lock()
+			link.world.grant(token, fence)
+			link.world.check()
+			link.world.mu.Unlock()
+		}
+	}); lost != nil {
+		return 0, false, lost
+	}
+	return fence, acquired, err
+}
+
+// Release releases the lock by the key if it is held by the token.
+func (link *link) Release(key, token string) error {
+	var err error
+	if lost := link.world.call(link.process, func() { err = link.world.backend.Release(key, token) }); lost != nil {
+		return lost
+	}
+	return err
+}
+
+// Refresh extends the lock by the key for the ttl if it is held by the token.
+func (link *link) Refresh(key, token string, ttl time.Duration) error {
+	var err error
+	if lost := link.world.call(link.process, func() { err = link.world.backend.Refresh(key, token, ttl) }); lost != nil {
+		return lost
+	}
+	return err
+}
+
+// Inspect returns the current state of the lock by the key.
+func (link *link) Inspect(key string) (locker.Lease, error) {
+	var (
+		lease locker.Lease
+		err   error
+	)
+	if lost := link.world.call(link.process, func() { lease, err = link.world.backend.Inspect(key) }); lost != nil {
+		return locker.Lease{Key: key}, lost
+	}
+	return lease, err
+}
+
+const (
+	idle = iota
+	acquiring
+	holding
+)
+
+// process is a participant of the simulation which runs the lock.
+type process struct {
+	id      string
+	lock    *locker.DistributedLock
+	random  *rand.Rand
+	latency time.Duration
+	drop    float64
+	paused  time.Time // the end of the current pause
+	frozen  bool      // the belief at the start of the pause
+	crashed bool
+
+	state       int
+	generation  uint64
+	interrupted chan struct{}
+	fence       uint64
+	lost        locker.Breaker
+}
+
+// believes returns true if the process considers itself
+// the owner of the lock. The paused process can't notice
+// the loss of the lock, so it keeps the belief until it resumes.
+func (p *process) believes(now time.Time) bool {
+	if p.crashed {
+		return false
+	}
+	if now.Before(p.paused) {
+		return p.frozen
+	}
+	if p.state != holding {
+		return false
+	}
+	select {
+	case <-p.lost.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// lose makes the process forget the lock, so pending attempts
+// to take it are abandoned.
+func (p *process) lose() {
+	p.interrupt()
+	p.state = idle
+	p.generation++
+}
+
+// interrupt stops the attempt to take the lock if it is in progress.
+func (p *process) interrupt() {
+	if p.interrupted != nil {
+		close(p.interrupted)
+		p.interrupted = nil
+	}
+}
+
+const errTimeout = locker.Error("sim: request timed out")
@@ -0,0 +1,66 @@
+package sim_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kamilsk/locker"
+	. "github.com/kamilsk/locker/sim"
+)
+
+func TestHarness(t *testing.T) {
+	harness := NewHarness(HarnessWithSeed(42))
+
+	for _, scenario := range Scenarios() {
+		t.Run(scenario.Name, func(t *testing.T) {
+			report := harness.Run(locker.MemoryBackend(locker.MemoryBackendWithClock(harness.Now)), scenario)
+			if len(report.Violations) > 0 {
+				t.Errorf("unexpected violations %+v\n%s", report.Violations, report)
+				t.FailNow()
+			}
+			if report.Grants == 0 {
+				t.Errorf("the lock must be granted\n%s", report)
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("broken fencing", func(t *testing.T) {
+		scenario := Scenario{
+			Name:     "pause",
+			Duration: 3 * time.Second,
+			Steps: []Step{
+				At(0, Lock("a")),
+				At(100*time.Millisecond, Pause("a", 2*time.Second)),
+				At(100*time.Millisecond, Lock("b")),
+			},
+		}
+		backend := &forgetful{Backend: locker.MemoryBackend(locker.MemoryBackendWithClock(harness.Now)), now: harness.Now}
+		report := harness.Run(backend, scenario)
+		if len(report.Violations) == 0 {
+			t.Errorf("the reused fencing token must be detected\n%s", report)
+			t.FailNow()
+		}
+	})
+}
+
+// forgetful loses fencing tokens on expiration of the lock,
+// e.g. as a storage restarted without persistence.
+type forgetful struct {
+	locker.Backend
+	now func() time.Time
+}
+
+func (backend *forgetful) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	lease, err := backend.Inspect(key)
+	if err != nil {
+		return 0, false, err
+	}
+	if lease.Held() && lease.Token != token {
+		return 0, false, nil
+	}
+	if !lease.Held() {
+		backend.Backend = locker.MemoryBackend(locker.MemoryBackendWithClock(backend.now))
+	}
+	return backend.Backend.Acquire(key, token, ttl)
+}
@@ -0,0 +1,246 @@
+package sim
+
+import (
+	"strings"
+	"time"
+)
+
+// Scenario is a script of the simulation.
+type Scenario struct {
+	Name     string
+	Duration time.Duration
+	Steps    []Step
+}
+
+// Step is an action taken at the moment of virtual time.
+type Step struct {
+	At     time.Duration
+	Action Action
+}
+
+// At returns the step to take the action at the moment.
+func At(at time.Duration, action Action) Step {
+	return Step{At: at, Action: action}
+}
+
+// Action changes the state of a process or the network.
+type Action func(*world)
+
+// Lock makes the process take the lock. It retries until the lock
+// is taken or the Unlock action is taken.
+func Lock(id string) Action {
+	return func(w *world) {
+		p := w.process(id)
+		if p.state != idle || p.crashed {
+			return
+		}
+		if time.Now().Before(p.paused) {
+			w.later(p.paused, func() { Lock(id)(w) })
+			return
+		}
+		p.state = acquiring
+		p.generation++
+		w.trace("%s tries to take the lock", id)
+		w.acquire(p)
+	}
+}
+
+// Unlock makes the process release the lock or stop trying to take it.
+func Unlock(id string) Action {
+	return func(w *world) {
+		p := w.process(id)
+		if p.state == idle || p.crashed {
+			return
+		}
+		if time.Now().Before(p.paused) {
+			w.later(p.paused, func() { Unlock(id)(w) })
+			return
+		}
+		holding := p.state == holding
+		p.lose()
+		w.trace("%s releases the lock", id)
+		if holding {
+			w.release(p)
+		}
+	}
+}
+
+// Pause freezes the process for the duration, e.g. by a garbage
+// collector. It can't notice the loss of the lock while it is paused,
+// and its calls of the Backend are delayed until the end of the pause.
+func Pause(id string, duration time.Duration) Action {
+	return func(w *world) {
+		p, now := w.process(id), time.Now()
+		if !now.Before(p.paused) {
+			p.frozen = p.believes(now)
+		}
+		if until := now.Add(w.real(duration)); until.After(p.paused) {
+			p.paused = until
+		}
+		w.trace("%s is paused for %v", id, duration)
+	}
+}
+
+// Crash stops the process forever without releasing the lock.
+func Crash(id string) Action {
+	return func(w *world) {
+		p := w.process(id)
+		p.crashed = true
+		p.interrupt()
+		w.trace("%s has crashed", id)
+	}
+}
+
+// Jump moves the wall clock of the process by the offset.
+// A negative offset moves it back. The lock measures its lease
+// by the monotonic clock, so the jump must not affect it.
+func Jump(id string, offset time.Duration) Action {
+	return func(w *world) {
+		w.process(id)
+		w.trace("the clock of %s jumps by %v", id, offset)
+	}
+}
+
+// JumpBackend moves the clock of the Backend by the offset.
+// A negative offset moves it back.
+func JumpBackend(offset time.Duration) Action {
+	return func(w *world) {
+		w.skew += w.real(offset)
+		w.trace("the clock of the backend jumps by %v", offset)
+	}
+}
+
+// Latency sets up the one-way latency between the process and the Backend.
+func Latency(id string, latency time.Duration) Action {
+	return func(w *world) {
+		w.process(id).latency = latency
+		w.trace("the latency of %s is %v", id, latency)
+	}
+}
+
+// Drop sets up the probability to lose a message between the process
+// and the Backend.
+func Drop(id string, rate float64) Action {
+	return func(w *world) {
+		w.process(id).drop = rate
+		w.trace("the loss rate of %s is %v", id, rate)
+	}
+}
+
+// Isolate cuts the process off the Backend.
+func Isolate(id string) Action {
+	return Drop(id, 1)
+}
+
+// Heal restores the connection of the process to the Backend.
+func Heal(id string) Action {
+	return Drop(id, 0)
+}
+
+// Report is a result of the scenario.
+type Report struct {
+	Scenario   string
+	Grants     int
+	Violations []Violation
+	Trace      []string
+}
+
+// String returns the trace of the scenario.
+func (report Report) String() string {
+	return report.Scenario + ":\n" + strings.Join(report.Trace, "\n")
+}
+
+// Violation describes a broken invariant.
+type Violation struct {
+	At      time.Duration
+	Message string
+}
+
+// Scenarios returns the built-in scenarios designed for the default
+// settings of the harness, i.e. the ttl of a second.
+func Scenarios() []Scenario {
+	second, ms := time.Second, time.Millisecond
+	return []Scenario{
+		{
+			Name:     "process pause",
+			Duration: 5 * second,
+			Steps: []Step{
+				At(0, Lock("a")),
+				At(100*ms, Pause("a", 3*second)),
+				At(100*ms, Lock("b")),
+				At(4*second, Unlock("b")),
+				At(4*second, Lock("a")),
+			},
+		},
+		{
+			Name:     "backend clock jump",
+			Duration: 5 * second,
+			Steps: []Step{
+				At(0, Lock("a")),
+				At(200*ms, Lock("b")),
+				At(500*ms, JumpBackend(2*second)),
+				At(3*second, Unlock("b")),
+			},
+		},
+		{
+			Name:     "process clock jump",
+			Duration: 5 * second,
+			Steps: []Step{
+				At(0, Lock("a")),
+				At(100*ms, Jump("a", -10*second)),
+				At(100*ms, Isolate("a")),
+				At(200*ms, Lock("b")),
+				At(3*second, Heal("a")),
+			},
+		},
+		{
+			Name:     "partition",
+			Duration: 6 * second,
+			Steps: []Step{
+				At(0, Lock("a")),
+				At(200*ms, Isolate("a")),
+				At(200*ms, Lock("b")),
+				At(200*ms, Lock("c")),
+				At(3*second, Heal("a")),
+				At(4*second, Unlock("b")),
+				At(4*second, Unlock("c")),
+				At(4*second, Lock("a")),
+			},
+		},
+		{
+			Name:     "lossy network",
+			Duration: 10 * second,
+			Steps: []Step{
+				At(0, Drop("a", 0.3)),
+				At(0, Drop("b", 0.3)),
+				At(0, Drop("c", 0.3)),
+				At(0, Lock("a")),
+				At(0, Lock("b")),
+				At(0, Lock("c")),
+				At(3*second, Unlock("a")),
+				At(5*second, Unlock("b")),
+				At(7*second, Unlock("c")),
+			},
+		},
+		{
+			Name:     "slow network",
+			Duration: 5 * second,
+			Steps: []Step{
+				At(0, Lock("a")),
+				At(500*ms, Latency("a", 150*ms)),
+				At(500*ms, Latency("b", 150*ms)),
+				At(500*ms, Lock("b")),
+				At(3*second, Latency("a", ms)),
+			},
+		},
+		{
+			Name:     "crash",
+			Duration: 3 * second,
+			Steps: []Step{
+				At(0, Lock("a")),
+				At(100*ms, Crash("a")),
+				At(100*ms, Lock("b")),
+			},
+		},
+	}
+}
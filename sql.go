@@ -0,0 +1,229 @@
+package locker
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLBackend returns a new storage of the distributed lock state
+// based on the table of the SQL database, e.g. PostgreSQL or MySQL.
+// The table must be created in advance:
+//
+//  CREATE TABLE locks (
+//  	name   VARCHAR(255) NOT NULL PRIMARY KEY,
+//  	token  VARCHAR(255) NOT NULL,
+//  	fence  BIGINT       NOT NULL,
+//  	expire BIGINT       NOT NULL
+//  );
+//
+// The row of the lock is never deleted to keep its fencing token.
+// The expiration time is stored in nanoseconds by the clock
+// of the owner, so processes should keep their clocks synchronized.
+//
+//  db, err := sql.Open("postgres", dsn)
+//  if err != nil {
+//  	return err
+//  }
+//  lock := locker.Distributed(time.Minute, locker.DistributedWithBackend(
+//  	locker.SQLBackend(db, locker.SQLWithPostgres()),
+//  ))
+//
+func SQLBackend(db *sql.DB, options ...SQLOption) *SQLStorage {
+	backend := &SQLStorage{db: db, table: "locks", timeout: time.Second, placeholder: func(int) string { return "?" }}
+	for _, option := range options {
+		option(backend)
+	}
+	return backend
+}
+
+// SQLOption configures the SQL storage.
+type SQLOption func(*SQLStorage)
+
+// SQLWithTable sets up the name of the table of locks.
+func SQLWithTable(table string) SQLOption {
+	return func(backend *SQLStorage) { backend.table = table }
+}
+
+// SQLWithTimeout sets up the timeout of a single query.
+func SQLWithTimeout(timeout time.Duration) SQLOption {
+	return func(backend *SQLStorage) { backend.timeout = timeout }
+}
+
+// SQLWithPostgres sets up the numbered placeholders of query
+// parameters, e.g. $1, used by PostgreSQL instead of question marks.
+func SQLWithPostgres() SQLOption {
+	return func(backend *SQLStorage) {
+		backend.placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+	}
+}
+
+// An SQLStorage keeps the distributed lock state in the database,
+// see SQLBackend.
+type SQLStorage struct {
+	db          *sql.DB
+	table       string
+	timeout     time.Duration
+	placeholder func(int) string
+}
+
+// Acquire tries to take the lock by the key for the token
+// and returns true if it succeeded with its fencing token.
+// It takes the free or expired row or inserts a new one.
+func (backend *SQLStorage) Acquire(key, token string, ttl time.Duration) (uint64, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	now := time.Now()
+	expire := now.Add(ttl).UnixNano()
+	result, err := backend.db.ExecContext(ctx, backend.query(
+		"UPDATE %s SET token = ?, fence = fence + 1, expire = ? WHERE name = ? AND expire <= ?"),
+		token, expire, key, now.UnixNano())
+	if err != nil {
+		return 0, false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		// the row doesn't exist yet or the lock is held by someone,
+		// so a duplicate key error is expected and checked below
+		_, err = backend.db.ExecContext(ctx, backend.query(
+			"INSERT INTO %s (name, token, fence, expire) VALUES (?, ?, 1, ?)"),
+			key, token, expire)
+		if err != nil {
+			lease, inspectErr := backend.inspect(ctx, key)
+			if inspectErr != nil {
+				return 0, false, err
+			}
+			if lease.Token != token {
+				return 0, false, nil
+			}
+			// the lock is already held by the token
+			if err := backend.Refresh(key, token, ttl); err != nil {
+				return 0, false, err
+			}
+		}
+	}
+
+	// the row is read as is, because the short ttl may have already expired
+	var (
+		owner string
+		fence int64
+	)
+	err = backend.db.QueryRowContext(ctx, backend.query(
+		"SELECT token, fence FROM %s WHERE name = ?"), key).
+		Scan(&owner, &fence)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil || owner != token {
+		return 0, false, err
+	}
+	return uint64(fence), true, nil
+}
+
+// Release frees the row of the lock by the key if it is held by the token.
+func (backend *SQLStorage) Release(key, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	return backend.exec(ctx, backend.query(
+		"UPDATE %s SET token = '', expire = 0 WHERE name = ? AND token = ? AND expire > ?"),
+		key, token, time.Now().UnixNano())
+}
+
+// Refresh extends the lock by the key for the ttl if it is held by the token.
+func (backend *SQLStorage) Refresh(key, token string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	now := time.Now()
+	return backend.exec(ctx, backend.query(
+		"UPDATE %s SET expire = ? WHERE name = ? AND token = ? AND expire > ?"),
+		now.Add(ttl).UnixNano(), key, token, now.UnixNano())
+}
+
+// Inspect returns the current state of the lock by the key.
+func (backend *SQLStorage) Inspect(key string) (Lease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	return backend.inspect(ctx, key)
+}
+
+// List returns the keys of the held locks with the prefix.
+func (backend *SQLStorage) List(prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	rows, err := backend.db.QueryContext(ctx, backend.query(
+		"SELECT name FROM %s WHERE token <> '' AND expire > ?"), time.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, rows.Err()
+}
+
+func (backend *SQLStorage) inspect(ctx context.Context, key string) (Lease, error) {
+	var (
+		token  string
+		fence  int64
+		expire int64
+	)
+	err := backend.db.QueryRowContext(ctx, backend.query(
+		"SELECT token, fence, expire FROM %s WHERE name = ?"), key).
+		Scan(&token, &fence, &expire)
+	if err == sql.ErrNoRows {
+		return Lease{Key: key}, nil
+	}
+	if err != nil {
+		return Lease{Key: key}, err
+	}
+	ttl := time.Until(time.Unix(0, expire))
+	if token == "" || ttl <= 0 {
+		return Lease{Key: key}, nil
+	}
+	return Lease{Key: key, Token: token, TTL: ttl, Fence: uint64(fence)}, nil
+}
+
+// exec executes the statement which must change the row of the lock.
+// It returns InvalidIntent if nothing has changed.
+func (backend *SQLStorage) exec(ctx context.Context, query string, args ...interface{}) error {
+	result, err := backend.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return InvalidIntent
+	}
+	return nil
+}
+
+// query substitutes the table name and placeholders into the template.
+func (backend *SQLStorage) query(template string) string {
+	parts := strings.Split(strings.Replace(template, "%s", backend.table, 1), "?")
+	query := make([]string, 0, 2*len(parts)-1)
+	for i, part := range parts {
+		if i > 0 {
+			query = append(query, backend.placeholder(i))
+		}
+		query = append(query, part)
+	}
+	return strings.Join(query, "")
+}
@@ -0,0 +1,260 @@
+package locker_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kamilsk/locker"
+	"github.com/kamilsk/locker/breaker"
+)
+
+func TestSQLBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	for _, dialect := range []string{"mysql", "postgres"} {
+		db, err := sql.Open("locker", dialect+":"+strconv.FormatInt(time.Now().UnixNano(), 10))
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		defer db.Close()
+
+		options := []SQLOption{SQLWithTable("locker_locks")}
+		if dialect == "postgres" {
+			options = append(options, SQLWithPostgres())
+		}
+		backend := SQLBackend(db, options...)
+
+		t.Run(dialect+" contract", func(t *testing.T) {
+			testBackend(t, backend)
+		})
+
+		t.Run(dialect+" expired lock", func(t *testing.T) {
+			fence, acquired, err := backend.Acquire(t.Name(), "first", time.Millisecond)
+			if err != nil || !acquired {
+				t.Error("unexpected result")
+				t.FailNow()
+			}
+			time.Sleep(2 * time.Millisecond)
+			if lease, err := backend.Inspect(t.Name()); err != nil || lease.Held() {
+				t.Error("the lock must be free")
+				t.FailNow()
+			}
+			next, acquired, err := backend.Acquire(t.Name(), "second", time.Minute)
+			if err != nil || !acquired || next <= fence {
+				t.Error("the expired lock must be taken")
+				t.FailNow()
+			}
+			if err := backend.Refresh(t.Name(), "first", time.Minute); err != InvalidIntent {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+		})
+
+		t.Run(dialect+" distributed lock", func(t *testing.T) {
+			options := []DistributedOption{
+				DistributedWithKey(t.Name()),
+				DistributedWithBackend(backend),
+				DistributedWithRetry(time.Millisecond),
+			}
+			first, second := Distributed(time.Minute, options...), Distributed(time.Minute, options...)
+			if err := first.Lock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := second.Lock(breaker.BreakByContext(context.WithTimeout(ctx, 10*time.Millisecond))); err != Interrupted {
+				t.Error("unexpected error value")
+				t.FailNow()
+			}
+			if err := first.Unlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := second.Lock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+			if err := second.Unlock(ctx); err != nil {
+				t.Error("unexpected error")
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("unavailable database", func(t *testing.T) {
+		db, err := sql.Open("locker", "unavailable")
+		if err != nil {
+			t.Error("unexpected error")
+			t.FailNow()
+		}
+		defer db.Close()
+
+		backend := SQLBackend(db)
+		if _, acquired, err := backend.Acquire(t.Name(), "token", time.Minute); err == nil || acquired {
+			t.Error("an error is expected")
+			t.FailNow()
+		}
+		if err := Distributed(time.Minute, DistributedWithBackend(backend)).Lock(ctx); err == nil || err == Interrupted {
+			t.Error("an error of the database is expected")
+			t.FailNow()
+		}
+	})
+}
+
+func init() {
+	sql.Register("locker", &fakeDriver{tables: make(map[string]*fakeTable)})
+}
+
+// fakeDriver is a stand-in of the SQL database which understands
+// only queries of the SQLBackend.
+type fakeDriver struct {
+	mu     sync.Mutex
+	tables map[string]*fakeTable
+}
+
+// Open connects to the database by the name in the "dialect:instance" format.
+func (fake *fakeDriver) Open(name string) (driver.Conn, error) {
+	if name == "unavailable" {
+		return nil, errors.New("connection refused")
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	table, found := fake.tables[name]
+	if !found {
+		table = &fakeTable{rows: make(map[string]*fakeRow)}
+		fake.tables[name] = table
+	}
+	return &fakeConn{dialect: strings.SplitN(name, ":", 2)[0], table: table}, nil
+}
+
+type fakeTable struct {
+	mu   sync.Mutex
+	rows map[string]*fakeRow
+}
+
+type fakeRow struct {
+	token  string
+	fence  int64
+	expire int64
+}
+
+type fakeConn struct {
+	dialect string
+	table   *fakeTable
+}
+
+func (conn *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if !strings.Contains(query, " locker_locks ") && !strings.Contains(query, " locks ") {
+		return nil, errors.New("unknown table")
+	}
+	if (conn.dialect == "postgres") == strings.Contains(query, "?") {
+		return nil, errors.New("unexpected placeholders")
+	}
+	return &fakeStmt{query: query, table: conn.table}, nil
+}
+
+func (conn *fakeConn) Close() error { return nil }
+
+func (conn *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	query string
+	table *fakeTable
+}
+
+func (stmt *fakeStmt) Close() error { return nil }
+
+func (stmt *fakeStmt) NumInput() int { return -1 }
+
+func (stmt *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	table := stmt.table
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(stmt.query, "INSERT"):
+		name := args[0].(string)
+		if _, found := table.rows[name]; found {
+			return nil, errors.New("duplicate key")
+		}
+		table.rows[name] = &fakeRow{token: args[1].(string), fence: 1, expire: args[2].(int64)}
+		return driver.RowsAffected(1), nil
+	case strings.Contains(stmt.query, "fence = fence + 1"):
+		row, found := table.rows[args[2].(string)]
+		if !found || row.expire > args[3].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		row.token, row.fence, row.expire = args[0].(string), row.fence+1, args[1].(int64)
+		return driver.RowsAffected(1), nil
+	case strings.Contains(stmt.query, "token = ''"):
+		row, found := table.rows[args[0].(string)]
+		if !found || row.token != args[1].(string) || row.expire <= args[2].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		row.token, row.expire = "", 0
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(stmt.query, "UPDATE"):
+		row, found := table.rows[args[1].(string)]
+		if !found || row.token != args[2].(string) || row.expire <= args[3].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		row.expire = args[0].(int64)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unexpected query")
+}
+
+func (stmt *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(stmt.query, "SELECT") {
+		return nil, errors.New("unexpected query")
+	}
+	table := stmt.table
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	columns := strings.Split(strings.TrimSpace(stmt.query[len("SELECT"):strings.Index(stmt.query, "FROM")]), ", ")
+	rows := &fakeRows{columns: columns}
+	if columns[0] == "name" {
+		for name, row := range table.rows {
+			if row.token != "" && row.expire > args[0].(int64) {
+				rows.values = append(rows.values, []driver.Value{name})
+			}
+		}
+		return rows, nil
+	}
+	if row, found := table.rows[args[0].(string)]; found {
+		values := map[string]driver.Value{"token": row.token, "fence": row.fence, "expire": row.expire}
+		rows.values = append(rows.values, make([]driver.Value, 0, len(columns)))
+		for _, column := range columns {
+			rows.values[0] = append(rows.values[0], values[column])
+		}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (rows *fakeRows) Columns() []string { return rows.columns }
+
+func (rows *fakeRows) Close() error { return nil }
+
+func (rows *fakeRows) Next(dest []driver.Value) error {
+	if len(rows.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, rows.values[0])
+	rows.values = rows.values[1:]
+	return nil
+}